@@ -18,6 +18,16 @@ crater converts a manifest from gather into a RO-CRATE.
     ...bin
     ./ancillary/   <-- customizable...
     ...bin...
+
+ 4. optionally, export DataCite XML describing the crate.
+
+ 5. optionally, write the crate as an OCFL object in a storage root,
+    adding a new version if the collection already has an object.
+
+ 6. optionally, package the crate into numbered zip parts that fit
+    within Zenodo's record limits.
+
+ 7. optionally, deposit the crate, or its package, on Zenodo.
 */
 package main
 
@@ -29,19 +39,43 @@ import (
 	"os"
 	"path/filepath"
 	"slices"
-	"strings"
 	"time"
 
 	"github.com/ross-spencer/zenodocfl/internal/logformatter"
+	"github.com/ross-spencer/zenodocfl/internal/ocfl"
+	"github.com/ross-spencer/zenodocfl/internal/provenance"
+	"github.com/ross-spencer/zenodocfl/internal/zenodo"
 )
 
 var (
-	crate      string
-	additional string
-	meta       string
-	dryrun     bool
-	debug      bool
-	vers       bool
+	crate           string
+	additional      string
+	meta            string
+	ocflRoot        string
+	message         string
+	update          string
+	retryFailed     string
+	retries         int
+	storageLayout   string
+	rocrateVers     string
+	profiles        string
+	exportDatacite  bool
+	previewTemplate string
+	deposit         bool
+	tokenFile       string
+	sandbox         bool
+	zenodoBase      string
+	publish         bool
+	packageParts    bool
+	partFiles       int
+	partSize        string
+	maxFiles        int
+	maxSize         string
+	workers         int
+	hostRate        float64
+	dryrun          bool
+	debug           bool
+	vers            bool
 
 	// app constants.
 	version = "dev-0.0.0"
@@ -56,6 +90,28 @@ func initFlags() {
 	flag.StringVar(&crate, "crate", "", "collection manifest to convert to RO-CRATE")
 	flag.StringVar(&meta, "meta", "", "metadata for the RO-CRATE")
 	flag.StringVar(&additional, "additional", "", "change name of ancillary directory")
+	flag.StringVar(&update, "update", "", "existing crate to update in place instead of creating a new one")
+	flag.StringVar(&ocflRoot, "ocfl", "", "OCFL storage root to write the crate to as an OCFL object")
+	flag.StringVar(&storageLayout, "layout", ocfl.FlatDirect, "storage layout for a new OCFL storage root")
+	flag.StringVar(&message, "message", "", "message to record with the OCFL version")
+	flag.StringVar(&rocrateVers, "rocrate", defaultRocrate, "version of RO-Crate to write, 1.1 or 1.2")
+	flag.StringVar(&profiles, "profile", "", "profile URIs the crate conforms to (separated by comma: ',')")
+	flag.StringVar(&previewTemplate, "preview-template", "", "Go template to use for ro-crate-preview.html")
+	flag.BoolVar(&exportDatacite, "datacite", false, "export DataCite XML alongside the crate")
+	flag.BoolVar(&deposit, "zenodo", false, "deposit the crate on Zenodo")
+	flag.StringVar(&tokenFile, "zenodo-token", "", fmt.Sprintf("file containing a Zenodo access token (default: $%s)", zenodo.TokenEnv))
+	flag.BoolVar(&sandbox, "sandbox", false, "use the Zenodo sandbox")
+	flag.StringVar(&zenodoBase, "zenodo-url", "", "base URL of the Zenodo instance to use")
+	flag.BoolVar(&publish, "publish", false, "publish the Zenodo deposition once uploaded")
+	flag.BoolVar(&packageParts, "package", false, "package the crate into numbered zip parts")
+	flag.IntVar(&partFiles, "part-files", 0, "maximum number of files in each zip part (0: no limit)")
+	flag.StringVar(&partSize, "part-size", "2GB", "maximum size of each zip part")
+	flag.IntVar(&maxFiles, "max-files", 100, "maximum number of files in a packaged record")
+	flag.StringVar(&maxSize, "max-size", "50GB", "maximum size of a packaged record")
+	flag.IntVar(&workers, "workers", 4, "number of files to download at once")
+	flag.IntVar(&retries, "retries", 3, "number of times to retry a failed download")
+	flag.StringVar(&retryFailed, "retry-failed", "", "failed.jsonl of a crate, only its failed downloads are retried")
+	flag.Float64Var(&hostRate, "rate", 2, "maximum requests per second to each host (0: no limit)")
 	flag.BoolVar(&dryrun, "dry-run", false, "perform a dry-run (dont download files)")
 	flag.BoolVar(&debug, "debug", false, "debug logging")
 	flag.BoolVar(&vers, "version", false, "return version")
@@ -103,16 +159,27 @@ func getMeta(meta string) metaJSON {
 */
 func makeCrate(manifest string, metaJSON metaJSON, dryrun bool) {
 
+	run := provenance.Start(craterApp, version, commit)
+
 	// read the data.
 	collection := readManifest(manifest)
 
-	// create global object.
+	// create global object, or open the crate being updated.
 	crateDir := filepath.Join("output", fmt.Sprintf(
 		"ro-crate-%s-%d",
-		strings.Replace(metaJSON.Name, " ", "-", -1),
+		crateSlug(metaJSON),
 		timestamp(),
 	),
 	)
+	var existing existingCrate
+	updateDir := update
+	if updateDir == "" {
+		updateDir = latestCrate(metaJSON)
+	}
+	if updateDir != "" {
+		crateDir = updateDir
+		existing = updateStage(&metaJSON, crateDir)
+	}
 	log.Printf("output dir: %s", crateDir)
 	recordsDir := filepath.Join(crateDir, "records")
 	mediaDir := filepath.Join(crateDir, "media")
@@ -134,16 +201,79 @@ func makeCrate(manifest string, metaJSON metaJSON, dryrun bool) {
 
 	// move records.
 	recordParts := moveRecords(collection.Items, recordsDir, "records")
-	mediaParts := downloadFile(collection.MediaURLs, mediaDir, "media", dryrun)
-	posterParts := downloadFile(collection.PosterURLs, posterDir, "posters", dryrun)
+	dl := newDownloader(workers, hostRate, retries)
+	dl.formats = expectedFormats(collection)
+	dl.quarantine = quarantineDir(crateDir)
+	names := newCrateNames(existing)
+	media, mediaFailed := downloadFile(dl, names.jobs(crateDir, "media", collection.MediaURLs), crateDir, existing, dryrun)
+	posters, posterFailed := downloadFile(dl, names.jobs(crateDir, "posters", collection.PosterURLs), crateDir, existing, dryrun)
+	downloads := slices.Concat(media, posters)
+	failures := slices.Concat(mediaFailed, posterFailed)
+	if err := writeURLMap(crateDir, downloads); err != nil {
+		log.Println("cannot write url map:", err)
+		os.Exit(1)
+	}
 
 	// get all parts for the manifest.
-	allParts := slices.Concat(recordParts, mediaParts, posterParts)
+	allParts := slices.Concat(recordParts, jobParts(downloads), []string{urlMapName})
 
 	// summary info.
 	log.Println("rocrate parts:", len(allParts))
 
 	metaJSON.parts = allParts
+	// reuse the identifier of an existing OCFL object so that a new
+	// version is added to it.
+	var objectPath string
+	if ocflRoot != "" && metaJSON.identifier != "" {
+		objectPath = findObjectByID(ocflRoot, metaJSON.identifier)
+	} else if ocflRoot != "" {
+		id, existing, err := findCrateObject(ocflRoot, metaJSON)
+		if err != nil {
+			log.Println("cannot read OCFL storage root:", err)
+			os.Exit(1)
+		}
+		if existing != "" {
+			log.Printf("updating existing OCFL object: %s (%s)", id, existing)
+			metaJSON.identifier = id
+			objectPath = existing
+		}
+	}
+	if metaJSON.identifier == "" {
+		metaJSON.identifier = makeULID(metaJSON.IDPrefix)
+	}
+
+	if exportDatacite {
+		dataciteCrate(metaJSON, collection.Items, crateDir)
+		metaJSON.parts = append(metaJSON.parts, dataciteName)
+	}
+
+	sources := collectionSources(collection, recordParts, downloads)
+	files, err := makeFileEntities(crateDir, metaJSON.parts, sources)
+	if err != nil {
+		log.Println("cannot describe crate files:", err)
+		os.Exit(1)
+	}
+	keepStale(files, existing, downloads)
+	metaJSON.files = files
+	persons, personIDs := makePersonEntities(collection.Items)
+	metaJSON.persons = persons
+	metaJSON.records = makeRecordEntities(collection.Items, recordParts, sources, personIDs)
+	metaJSON.pids = makePropertyValues(collection.Items)
+	licenses, report := applyLicenses(metaJSON.License, collection.Items, metaJSON.records, metaJSON.files)
+	metaJSON.licenses = licenses
+	log.Println(report)
+
+	if updateDir != "" {
+		updateFiles(crateDir, existing, metaJSON.parts, dryrun)
+	}
+
+	run.Url = provenance.LastURL(collection.Provenance)
+	if run.Url == "" {
+		run.Url = metaJSON.Url
+	}
+	run.AddInputs(manifest, meta)
+	run.Finish()
+	metaJSON.actions, metaJSON.provenance = makeProvenance(collection.Provenance, run)
 
 	rocrateData := makeCrateObj(metaJSON)
 
@@ -154,7 +284,27 @@ func makeCrate(manifest string, metaJSON metaJSON, dryrun bool) {
 	}
 
 	createCrateObj(filepath.Join(crateDir, crateName), string(data))
+	previewCrate(crateDir, data)
+
+	// an incomplete crate is not preserved or deposited until the
+	// failed downloads have been retried.
+	describeFailures(collection, failures)
+	if !failedStage(crateDir, failures) {
+		return
+	}
+
+	if ocflRoot != "" {
+		ocflCrate(metaJSON, crateDir, objectPath, dryrun)
+	}
+
+	upload := crateFiles(metaJSON, crateDir)
+	if packageParts {
+		upload = packageStage(metaJSON, crateDir, dryrun)
+	}
 
+	if deposit {
+		zenodoCrate(metaJSON, collection.Items, upload, dryrun)
+	}
 }
 
 type inputFields struct {
@@ -262,15 +412,42 @@ func main() {
 	if vers {
 		fmt.Fprintf(os.Stderr, "%s (%s) commit: %s date: %s\n", agent, version, commit, date)
 		os.Exit(0)
-	} else if flag.NFlag() < 1 || crate == "" && meta == "" {
+	} else if flag.NFlag() < 1 || crate == "" && meta == "" && retryFailed == "" {
 		fmt.Fprintln(os.Stderr, "Usage:  ")
 		fmt.Fprintln(os.Stderr, "        REQUIRED: [-crate]  STRING")
 		fmt.Fprintln(os.Stderr, "        REQUIRED: [-meta]  STRING")
 		fmt.Fprintln(os.Stderr, "        OPTIONAL: [-additional]  STRING")
+		fmt.Fprintln(os.Stderr, "        OPTIONAL: [-update]  STRING")
+		fmt.Fprintln(os.Stderr, "        OPTIONAL: [-rocrate]  STRING")
+		fmt.Fprintln(os.Stderr, "        OPTIONAL: [-profile]  STRING")
+		fmt.Fprintln(os.Stderr, "        OPTIONAL: [-preview-template]  STRING")
+		fmt.Fprintln(os.Stderr, "        OPTIONAL: [-datacite] ")
+		fmt.Fprintln(os.Stderr, "        OPTIONAL: [-ocfl]  STRING")
+		fmt.Fprintln(os.Stderr, "        OPTIONAL: [-layout]  STRING")
+		fmt.Fprintln(os.Stderr, "        OPTIONAL: [-message]  STRING")
+		fmt.Fprintln(os.Stderr, "        OPTIONAL: [-zenodo] ")
+		fmt.Fprintln(os.Stderr, "        OPTIONAL: [-zenodo-token]  STRING")
+		fmt.Fprintln(os.Stderr, "        OPTIONAL: [-sandbox] ")
+		fmt.Fprintln(os.Stderr, "        OPTIONAL: [-zenodo-url]  STRING")
+		fmt.Fprintln(os.Stderr, "        OPTIONAL: [-publish] ")
+		fmt.Fprintln(os.Stderr, "        OPTIONAL: [-package] ")
+		fmt.Fprintln(os.Stderr, "        OPTIONAL: [-part-files]  INT")
+		fmt.Fprintln(os.Stderr, "        OPTIONAL: [-part-size]  STRING")
+		fmt.Fprintln(os.Stderr, "        OPTIONAL: [-max-files]  INT")
+		fmt.Fprintln(os.Stderr, "        OPTIONAL: [-max-size]  STRING")
+		fmt.Fprintln(os.Stderr, "        OPTIONAL: [-workers]  INT")
+		fmt.Fprintln(os.Stderr, "        OPTIONAL: [-rate]  FLOAT")
+		fmt.Fprintln(os.Stderr, "        OPTIONAL: [-retries]  INT")
+		fmt.Fprintln(os.Stderr, "        OPTIONAL: [-retry-failed]  STRING")
 		fmt.Fprintln(os.Stderr, "        OPTIONAL: [-dry-run] ")
 		fmt.Fprintln(os.Stderr, "        OPTIONAL: [-version] ")
 		fmt.Fprintln(os.Stderr, "")
 		fmt.Fprintln(os.Stderr, "Output: [DIRECTORY] {ro-crate structure")
+		fmt.Fprintln(os.Stderr, "Output: [FILE] {datacite xml (optional)}")
+		fmt.Fprintln(os.Stderr, "Output: [FILE] {failed downloads (optional)}")
+		fmt.Fprintln(os.Stderr, "Output: [DIRECTORY] {ocfl object (optional)}")
+		fmt.Fprintln(os.Stderr, "Output: [DIRECTORY] {zip parts (optional)}")
+		fmt.Fprintln(os.Stderr, "Output: [URL] {zenodo deposition (optional)}")
 		fmt.Fprintf(os.Stderr, "Output: [STRING] {version: '%s'}\n\n", agent)
 		flag.Usage()
 		os.Exit(0)
@@ -281,6 +458,21 @@ func main() {
 		return
 	}
 
+	// the OCFL, package and deposit stages need the collection and its
+	// metadata, so a crate completed by retrying its failed downloads
+	// is finished by updating it in place.
+	finish := ocflRoot != "" || packageParts || deposit
+	if retryFailed != "" && finish && (crate == "" || meta == "") {
+		log.Println("cannot finish crate: -retry-failed needs -crate and -meta with -ocfl, -package or -zenodo")
+		os.Exit(1)
+	}
+	if retryFailed != "" {
+		if !retryFailedCrate(retryFailed, dryrun) || !finish {
+			os.Exit(0)
+		}
+		update = filepath.Dir(retryFailed)
+	}
+
 	var metaJSON metaJSON
 	if meta != "" {
 		// read metadata.
@@ -290,6 +482,13 @@ func main() {
 		metaJSON = handleInput()
 	}
 
+	if _, err := rocrateVersion(rocrateVers); err != nil {
+		log.Println("cannot create crate:", err)
+		os.Exit(1)
+	}
+	metaJSON.rocrate = rocrateVers
+	metaJSON.Profiles = append(metaJSON.Profiles, parseProfiles(profiles)...)
+
 	fmt.Fprintf(os.Stderr, "---\n\nuser metadata\n=============\n\n%s---------\n\n", metaJSON)
 	var confirm string
 	if dryrun {
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/ross-spencer/zenodocfl/internal/types"
+	"github.com/ross-spencer/zenodocfl/internal/zenodo"
+)
+
+// zenodoType describes the Zenodo upload type a record type maps to.
+type zenodoType struct {
+	upload      string
+	publication string
+	image       string
+}
+
+// recordTypes maps the record type given in the metadata, usually a
+// schema.org type, to a Zenodo upload type.
+var recordTypes = map[string]zenodoType{
+	"dataset":                     {upload: "dataset"},
+	"collection":                  {upload: "dataset"},
+	"creativework":                {upload: "other"},
+	"softwaresourcecode":          {upload: "software"},
+	"softwareapplication":         {upload: "software"},
+	"imageobject":                 {upload: "image", image: "other"},
+	"photograph":                  {upload: "image", image: "photo"},
+	"videoobject":                 {upload: "video"},
+	"book":                        {upload: "publication", publication: "book"},
+	"scholarlyarticle":            {upload: "publication", publication: "article"},
+	"article":                     {upload: "publication", publication: "article"},
+	"thesis":                      {upload: "publication", publication: "thesis"},
+	"report":                      {upload: "publication", publication: "report"},
+	"poster":                      {upload: "poster"},
+	"presentationdigitaldocument": {upload: "presentation"},
+}
+
+// identifierSchemes maps INK identifier types to Zenodo identifier
+// schemes.
+var identifierSchemes = map[string]string{
+	"ark":     "ark",
+	"handle":  "handle",
+	"doi":     "doi",
+	"urn":     "urn",
+	"urn:nbn": "urn",
+}
+
+// licenseID returns the Zenodo license identifier for a license URL.
+// Bare identifiers, e.g. cc-by-4.0, are returned as-is.
+func licenseID(license string) (string, error) {
+	license = strings.TrimSpace(license)
+	if license == "" {
+		return "", fmt.Errorf("no license provided")
+	}
+	parsed, err := url.Parse(license)
+	if err != nil || parsed.Host == "" {
+		return strings.ToLower(license), nil
+	}
+	segments := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+	host := strings.TrimPrefix(strings.ToLower(parsed.Host), "www.")
+	switch host {
+	case "creativecommons.org":
+		if len(segments) >= 3 && segments[0] == "publicdomain" && segments[1] == "zero" {
+			return fmt.Sprintf("cc0-%s", segments[2]), nil
+		}
+		if len(segments) >= 3 && segments[0] == "licenses" {
+			return fmt.Sprintf("cc-%s-%s", segments[1], segments[2]), nil
+		}
+	case "opensource.org", "spdx.org":
+		if len(segments) >= 2 && segments[0] == "licenses" {
+			return strings.ToLower(strings.TrimSuffix(segments[1], ".html")), nil
+		}
+	}
+	return "", fmt.Errorf("license URL cannot be mapped to a Zenodo license: '%s'", license)
+}
+
+// relatedIdentifiers returns the persistent identifiers of every item
+// in the collection as parts of the deposition.
+func relatedIdentifiers(metaJSON metaJSON, items []types.Item) []zenodo.RelatedIdentifier {
+	related := []zenodo.RelatedIdentifier{}
+	seen := []string{}
+	add := func(identifier zenodo.RelatedIdentifier) {
+		if identifier.Identifier == "" || slices.Contains(seen, identifier.Identifier) {
+			return
+		}
+		seen = append(seen, identifier.Identifier)
+		related = append(related, identifier)
+	}
+	if metaJSON.Url != "" {
+		add(zenodo.RelatedIdentifier{Identifier: metaJSON.Url, Relation: "isDerivedFrom", Scheme: "url"})
+	}
+	for _, item := range items {
+		for _, id := range item.Identifiers {
+			scheme, ok := identifierSchemes[strings.ToLower(id.Type)]
+			if !ok || id.Name == "" {
+				add(zenodo.RelatedIdentifier{Identifier: id.Url, Relation: "hasPart", Scheme: "url"})
+				continue
+			}
+			add(zenodo.RelatedIdentifier{Identifier: id.Name, Relation: "hasPart", Scheme: scheme})
+		}
+	}
+	return related
+}
+
+// creatorRoles are the INK person roles that make a person a creator
+// of the deposition.
+var creatorRoles = []string{"composer", "author"}
+
+// orcidID returns the bare ORCID iD of a person, e.g.
+// 0000-0002-1825-0097, or an empty string if they have none.
+func orcidID(person types.Person) string {
+	for _, id := range person.Identifiers {
+		if parsed, err := url.Parse(id.Url); err == nil && strings.TrimPrefix(strings.ToLower(parsed.Host), "www.") == "orcid.org" {
+			return strings.Trim(parsed.Path, "/")
+		}
+		if strings.ToLower(id.Type) == "orcid" && id.Name != "" {
+			return strings.TrimPrefix(id.Name, "orcid:")
+		}
+	}
+	return ""
+}
+
+// zenodoCreators returns the composers and authors of the collection's
+// items as the creators of the deposition, deduplicated as they are in
+// the crate and with the ORCID iD found for them in any record. The
+// publishers are the creators of a collection without either.
+func zenodoCreators(metaJSON metaJSON, items []types.Item) []zenodo.Creator {
+	orcids := map[string]string{}
+	for _, item := range items {
+		for _, person := range item.Persons {
+			key := personKey(person.Name)
+			if orcids[key] == "" {
+				orcids[key] = orcidID(person)
+			}
+		}
+	}
+	creators := []zenodo.Creator{}
+	seen := map[string]bool{}
+	for _, item := range items {
+		for _, person := range item.Persons {
+			key := personKey(person.Name)
+			if key == "" || seen[key] || !slices.Contains(creatorRoles, strings.ToLower(strings.TrimSpace(person.Role))) {
+				continue
+			}
+			seen[key] = true
+			creators = append(creators, zenodo.Creator{Name: person.Name, ORCID: orcids[key]})
+		}
+	}
+	if len(creators) > 0 {
+		return creators
+	}
+	for _, pub := range metaJSON.Publisher {
+		creators = append(creators, zenodo.Creator{Name: pub.PublisherName})
+	}
+	return creators
+}
+
+// zenodoCrosswalk maps the crate metadata and the collection's items
+// to Zenodo deposition metadata. Problems with the user's metadata
+// are returned alongside the Zenodo validation errors and each names
+// the offending field.
+func zenodoCrosswalk(metaJSON metaJSON, items []types.Item) (zenodo.Metadata, []zenodo.FieldError) {
+	problems := []zenodo.FieldError{}
+	metadata := zenodo.Metadata{
+		Title:              metaJSON.Name,
+		Description:        metaJSON.Description,
+		PublicationDate:    publishedDate(metaJSON),
+		AccessRight:        "open",
+		RelatedIdentifiers: relatedIdentifiers(metaJSON, items),
+	}
+	recordType, ok := recordTypes[strings.ToLower(metaJSON.RecordType)]
+	if !ok {
+		problems = append(problems, zenodo.FieldError{
+			Field:   "meta.type",
+			Message: fmt.Sprintf("record type has no Zenodo upload type: '%s'", metaJSON.RecordType),
+		})
+	}
+	metadata.UploadType = recordType.upload
+	metadata.PublicationType = recordType.publication
+	metadata.ImageType = recordType.image
+	metadata.Creators = zenodoCreators(metaJSON, items)
+	for _, keyword := range getKeywords(metaJSON.Keywords) {
+		if keyword == "" {
+			continue
+		}
+		metadata.Keywords = append(metadata.Keywords, keyword)
+	}
+	license, err := licenseID(metaJSON.License)
+	if err != nil {
+		problems = append(problems, zenodo.FieldError{Field: "meta.license", Message: err.Error()})
+	}
+	metadata.License = license
+	return metadata, append(problems, metadata.Validate()...)
+}
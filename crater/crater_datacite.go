@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ross-spencer/zenodocfl/internal/datacite"
+	"github.com/ross-spencer/zenodocfl/internal/types"
+)
+
+// dataciteName is the name of the DataCite export within the crate.
+const dataciteName string = "datacite.xml"
+
+// dataciteTypes maps the record type given in the metadata, usually a
+// schema.org type, to a DataCite resourceTypeGeneral.
+var dataciteTypes = map[string]string{
+	"dataset":                     "Dataset",
+	"collection":                  "Collection",
+	"creativework":                "Other",
+	"softwaresourcecode":          "Software",
+	"softwareapplication":         "Software",
+	"imageobject":                 "Image",
+	"photograph":                  "Image",
+	"videoobject":                 "Audiovisual",
+	"audioobject":                 "Sound",
+	"book":                        "Book",
+	"scholarlyarticle":            "JournalArticle",
+	"article":                     "Text",
+	"thesis":                      "Dissertation",
+	"report":                      "Report",
+	"poster":                      "Text",
+	"presentationdigitaldocument": "Text",
+}
+
+// relatedIdentifierTypes maps INK identifier types to DataCite
+// related identifier types.
+var relatedIdentifierTypes = map[string]string{
+	"ark":    "ARK",
+	"handle": "Handle",
+	"doi":    "DOI",
+	"urn":    "URN",
+}
+
+// rorIdentifier returns a ROR name identifier for a publisher URI
+// if it is a ROR identifier.
+func rorIdentifier(uri string) (string, bool) {
+	parsed, err := url.Parse(uri)
+	if err != nil || strings.TrimPrefix(strings.ToLower(parsed.Host), "www.") != "ror.org" {
+		return "", false
+	}
+	if strings.Trim(parsed.Path, "/") == "" {
+		return "", false
+	}
+	return fmt.Sprintf("https://ror.org/%s", strings.Trim(parsed.Path, "/")), true
+}
+
+// dataciteRights describes the crate's license. The SPDX identifier
+// is only given for licenses licenseID understands.
+func dataciteRights(license string) []datacite.Rights {
+	if license == "" {
+		return nil
+	}
+	rights := datacite.Rights{URI: license, Value: license}
+	if id, err := licenseID(license); err == nil && strings.HasPrefix(id, "cc") {
+		rights.Identifier = strings.ToUpper(id)
+		rights.IdentifierScheme = "SPDX"
+		rights.SchemeURI = "https://spdx.org/licenses/"
+	}
+	return []datacite.Rights{rights}
+}
+
+// dataciteRelated returns the collection URL and the persistent
+// identifiers of every item in the collection as related identifiers.
+func dataciteRelated(metaJSON metaJSON, items []types.Item) []datacite.RelatedIdentifier {
+	related := []datacite.RelatedIdentifier{}
+	for _, rel := range relatedIdentifiers(metaJSON, items) {
+		idType, ok := relatedIdentifierTypes[rel.Scheme]
+		if !ok {
+			idType = "URL"
+		}
+		relation := strings.ToUpper(rel.Relation[:1]) + rel.Relation[1:]
+		related = append(related, datacite.RelatedIdentifier{
+			Type:         idType,
+			RelationType: relation,
+			Value:        rel.Identifier,
+		})
+	}
+	return related
+}
+
+// dataciteCrosswalk maps the crate metadata and the collection's
+// items to a DataCite resource. The DOI is only known once the crate
+// has been deposited and is otherwise left empty.
+func dataciteCrosswalk(metaJSON metaJSON, items []types.Item, doi string) datacite.Resource {
+	published := publishedDate(metaJSON)
+	resource := datacite.Resource{
+		Titles:          []datacite.Title{{Value: metaJSON.Name}},
+		PublicationYear: published[:4],
+		ResourceType: datacite.ResourceType{
+			General: dataciteTypes[strings.ToLower(metaJSON.RecordType)],
+			Value:   metaJSON.RecordType,
+		},
+		Dates:              []datacite.Date{{Type: "Issued", Value: published}},
+		RelatedIdentifiers: dataciteRelated(metaJSON, items),
+		RightsList:         dataciteRights(metaJSON.License),
+	}
+	if metaJSON.dateModified != "" {
+		resource.Dates = append(resource.Dates, datacite.Date{Type: "Updated", Value: metaJSON.dateModified[:10]})
+	}
+	if doi != "" {
+		resource.Identifier = &datacite.Identifier{Type: "DOI", Value: doi}
+	}
+	if metaJSON.identifier != "" {
+		resource.AlternateIdentifiers = []datacite.AlternateIdentifier{
+			{Type: "Local", Value: metaJSON.identifier},
+		}
+	}
+	for idx, pub := range metaJSON.Publisher {
+		creator := datacite.Creator{
+			Name: datacite.CreatorName{NameType: "Organizational", Value: pub.PublisherName},
+		}
+		ror, isROR := rorIdentifier(pub.PublisherIdentifier)
+		if isROR {
+			creator.NameIdentifiers = []datacite.NameIdentifier{
+				{Scheme: "ROR", SchemeURI: "https://ror.org", Value: ror},
+			}
+		}
+		resource.Creators = append(resource.Creators, creator)
+		if idx > 0 {
+			continue
+		}
+		resource.Publisher = datacite.Publisher{Value: pub.PublisherName}
+		if isROR {
+			resource.Publisher.Identifier = ror
+			resource.Publisher.IdentifierScheme = "ROR"
+			resource.Publisher.SchemeURI = "https://ror.org/"
+		}
+	}
+	for _, keyword := range getKeywords(metaJSON.Keywords) {
+		if keyword == "" {
+			continue
+		}
+		resource.Subjects = append(resource.Subjects, datacite.Subject{Value: keyword})
+	}
+	if metaJSON.Description != "" {
+		resource.Descriptions = []datacite.Description{{Type: "Abstract", Value: metaJSON.Description}}
+	}
+	return resource
+}
+
+// writeDataCite writes the DataCite export of the crate and returns
+// the problems found validating it.
+func writeDataCite(path string, resource datacite.Resource) ([]datacite.Problem, error) {
+	problems := resource.Validate()
+	data, err := resource.XML()
+	if err != nil {
+		return problems, err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return problems, fmt.Errorf("error writing datacite xml: %w (%s)", err, path)
+	}
+	return problems, nil
+}
+
+// dataciteCrate writes datacite.xml to the crate. The DOI of a
+// previous Zenodo deposit is used as the identifier if there is one.
+// Any problem other than a missing DOI stops the crate being created.
+func dataciteCrate(metaJSON metaJSON, items []types.Item, crateDir string) {
+	state, err := readZenodoState(zenodoStatePath(crateDir, metaJSON))
+	if err != nil {
+		log.Println("cannot read zenodo state:", err)
+		os.Exit(1)
+	}
+	resource := dataciteCrosswalk(metaJSON, items, state.ConceptDOI)
+	problems, err := writeDataCite(filepath.Join(crateDir, dataciteName), resource)
+	if err != nil {
+		log.Println("cannot export datacite:", err)
+		os.Exit(1)
+	}
+	invalid := false
+	for _, problem := range problems {
+		if problem.Field == "identifier" {
+			log.Println("datacite: no DOI yet, the export has no identifier until the crate is deposited")
+			continue
+		}
+		log.Println("datacite:", problem)
+		invalid = true
+	}
+	if invalid {
+		log.Println("datacite export is invalid:", filepath.Join(crateDir, dataciteName))
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,520 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ross-spencer/zenodocfl/internal/types"
+)
+
+// failedName is the name of the list of downloads that failed, written
+// to the crate until they have been retried.
+const failedName string = "failed.jsonl"
+
+// partExt is added to files while they are downloaded.
+const partExt string = ".part"
+
+// downloadJob is a single file to download into the crate. The
+// digest is known if an existing crate downloaded the file from the
+// same URL and the format is the one expected for the URL, if any. A
+// job is stale if its download failed but the copy an existing crate
+// already held has been kept. Requests the job makes beyond its first
+// are spaced out by the downloader's limiter.
+type downloadJob struct {
+	url     string
+	path    string
+	part    string
+	sha256  string
+	format  string
+	stale   bool
+	limiter *hostLimiter
+}
+
+// jobParts returns the crate parts of a list of downloads.
+func jobParts(jobs []downloadJob) []string {
+	parts := []string{}
+	for _, job := range jobs {
+		parts = append(parts, job.part)
+	}
+	return parts
+}
+
+// hostLimiter spaces out the requests made to each host so that no
+// host receives more than the given number of requests per second.
+type hostLimiter struct {
+	interval time.Duration
+	mu       sync.Mutex
+	next     map[string]time.Time
+}
+
+// newHostLimiter returns a limiter allowing rate requests per second
+// to each host. A rate of zero or less doesn't limit requests.
+func newHostLimiter(rate float64) *hostLimiter {
+	limiter := &hostLimiter{next: map[string]time.Time{}}
+	if rate > 0 {
+		limiter.interval = time.Duration(float64(time.Second) / rate)
+	}
+	return limiter
+}
+
+// wait blocks until a request may be made to the host of the URL. A
+// nil limiter doesn't wait.
+func (limiter *hostLimiter) wait(rawURL string) {
+	if limiter == nil || limiter.interval == 0 {
+		return
+	}
+	host := rawURL
+	if parsed, err := url.Parse(rawURL); err == nil {
+		host = parsed.Host
+	}
+	limiter.mu.Lock()
+	now := time.Now()
+	slot := limiter.next[host]
+	if slot.Before(now) {
+		slot = now
+	}
+	limiter.next[host] = slot.Add(limiter.interval)
+	limiter.mu.Unlock()
+	time.Sleep(slot.Sub(now))
+}
+
+// defaultBackoff is the delay before the first retry of a download,
+// doubled for each retry after it.
+const defaultBackoff time.Duration = time.Second
+
+// statusError is returned when the server responds to a download with
+// an error status.
+type statusError struct {
+	url        string
+	status     int
+	retryAfter time.Duration
+}
+
+func (err statusError) Error() string {
+	return fmt.Sprintf("error downloading url: %s (%s)", http.StatusText(err.status), err.url)
+}
+
+// parseRetryAfter returns the delay a Retry-After header asks for,
+// given either in seconds or as an HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+	return 0
+}
+
+// retryDelay returns how long to wait before retrying a failed
+// download, doubling the backoff for every attempt and honouring the
+// server's Retry-After. Errors the server gives no hope of recovering
+// from are not retried.
+func retryDelay(err error, attempt int, backoff time.Duration) (time.Duration, bool) {
+	delay := backoff << attempt
+	var status statusError
+	if errors.As(err, &status) {
+		if status.status != http.StatusTooManyRequests && status.status < 500 {
+			return 0, false
+		}
+		return max(delay, status.retryAfter), true
+	}
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return 0, false
+	}
+	return delay, true
+}
+
+// downloader downloads files with a bounded pool of workers, retrying
+// failed downloads. Downloads which aren't the format expected for
+// their URL are moved to the quarantine directory.
+type downloader struct {
+	workers    int
+	retries    int
+	backoff    time.Duration
+	limiter    *hostLimiter
+	formats    map[string]string
+	quarantine string
+	fetch      func(job downloadJob) error
+}
+
+// newDownloader returns a downloader using the given number of
+// workers, per-host request rate and number of retries.
+func newDownloader(workers int, rate float64, retries int) *downloader {
+	if workers < 1 {
+		workers = 1
+	}
+	return &downloader{
+		workers: workers,
+		retries: max(retries, 0),
+		backoff: defaultBackoff,
+		limiter: newHostLimiter(rate),
+		fetch:   downloadCrateObj,
+	}
+}
+
+// fetchJob downloads a single job, retrying it until it succeeds or
+// the retries are used up. A download that isn't the format expected
+// is quarantined rather than retried.
+func (dl *downloader) fetchJob(job downloadJob) error {
+	job.format = dl.formats[job.url]
+	job.limiter = dl.limiter
+	var err error
+	for attempt := 0; ; attempt++ {
+		dl.limiter.wait(job.url)
+		err = dl.fetch(job)
+		var formatErr formatError
+		if errors.As(err, &formatErr) {
+			return dl.quarantinePart(job, formatErr)
+		}
+		if err == nil || attempt >= dl.retries {
+			return err
+		}
+		delay, retry := retryDelay(err, attempt, dl.backoff)
+		if !retry {
+			return err
+		}
+		log.Printf("retrying download in %s: %s", delay, err)
+		time.Sleep(delay)
+	}
+}
+
+// download runs the jobs across the pool of workers. The error of each
+// job is returned at the job's index so that results are in the same
+// order as the jobs whatever order they finish in.
+func (dl *downloader) download(jobs []downloadJob) []error {
+	errs := make([]error, len(jobs))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for range min(dl.workers, len(jobs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range queue {
+				errs[idx] = dl.fetchJob(jobs[idx])
+			}
+		}()
+	}
+	for idx := range jobs {
+		queue <- idx
+	}
+	close(queue)
+	wg.Wait()
+	return errs
+}
+
+// remoteSize returns the Content-Length the server gives for a job's
+// URL or -1 if it isn't known. The request waits its turn with the
+// job's limiter like any other.
+func remoteSize(job downloadJob) int64 {
+	job.limiter.wait(job.url)
+	resp, err := http.Head(job.url)
+	if err != nil {
+		return -1
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return -1
+	}
+	return resp.ContentLength
+}
+
+// rangeTotal returns the length of the whole file given by a
+// response's Content-Range or -1 if it isn't known.
+func rangeTotal(resp *http.Response) int64 {
+	_, total, ok := strings.Cut(resp.Header.Get("Content-Range"), "/")
+	if !ok {
+		return -1
+	}
+	size, err := strconv.ParseInt(total, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return size
+}
+
+// complete reports whether a file holds the whole of a download. The
+// digest an existing crate recorded is checked if there is one,
+// otherwise the size is compared with the size of the remote file,
+// requested from the server if it isn't given.
+func complete(job downloadJob, filePath string, size int64, total int64) bool {
+	if job.sha256 != "" {
+		digest, err := fileSHA256(filePath)
+		return err == nil && digest == job.sha256
+	}
+	if total < 0 {
+		total = remoteSize(job)
+	}
+	return total >= 0 && size == total
+}
+
+// discardPart removes a .part file that can't be completed so that the
+// download is started again.
+func discardPart(partPath string, url string, reason string) error {
+	if err := os.Remove(partPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing file: %w (%s)", err, partPath)
+	}
+	return fmt.Errorf("error downloading url: %s (%s)", reason, url)
+}
+
+// downloadCrateObj downloads a job to its path. The download is
+// written to a .part file which is renamed once it is complete, so an
+// interrupted download is resumed from where it stopped rather than
+// left looking complete. A file which is already complete is not
+// downloaded again.
+func downloadCrateObj(job downloadJob) error {
+	url, path := job.url, job.path
+	if info, err := os.Stat(path); err == nil {
+		if complete(job, path, info.Size(), -1) {
+			return nil
+		}
+		// without a digest the size was requested from the server, so
+		// the download waits for another turn.
+		if job.sha256 == "" {
+			job.limiter.wait(url)
+		}
+	}
+	partPath := path + partExt
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil {
+		offset = info.Size()
+	}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w (%s)", err, url)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error downloading url: %w (%s)", err, url)
+	}
+	defer resp.Body.Close()
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	total := resp.ContentLength
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		total = rangeTotal(resp)
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// the .part file may already hold the whole file but is only
+		// promoted if it matches the remote file.
+		if !complete(job, partPath, offset, rangeTotal(resp)) {
+			return discardPart(partPath, url, "partial download doesn't match the remote file")
+		}
+		return promote(job, partPath)
+	case resp.StatusCode != http.StatusOK:
+		return statusError{
+			url:        url,
+			status:     resp.StatusCode,
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+	out, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return fmt.Errorf("error creating path: %w (%s)", err, partPath)
+	}
+	written, err := io.Copy(out, resp.Body)
+	if err != nil {
+		out.Close()
+		return fmt.Errorf("error accessing url data: %w (%s)", err, url)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("error writing file: %w (%s)", err, partPath)
+	}
+	// the .part file is kept so that the rest can be requested.
+	if resp.ContentLength >= 0 && written != resp.ContentLength {
+		return fmt.Errorf("error downloading url: received %d of %d bytes (%s)", written, resp.ContentLength, url)
+	}
+	// a resumed download must add up to the whole file.
+	if flags&os.O_APPEND != 0 && !complete(job, partPath, offset+written, total) {
+		return discardPart(partPath, url, "resumed download doesn't match the remote file")
+	}
+	return promote(job, partPath)
+}
+
+// promote moves a completed .part file into place once it is checked
+// to be the format expected, so that a download which isn't never
+// replaces the copy of the file the crate already holds.
+func promote(job downloadJob, partPath string) error {
+	sniffed := sniffContent(partPath)
+	if !formatMatches(job.format, sniffed) {
+		return formatError{url: job.url, expected: job.format, sniffed: sniffed, path: partPath}
+	}
+	return finishDownload(partPath, job.path)
+}
+
+// finishDownload moves a completed .part file into place.
+func finishDownload(partPath string, path string) error {
+	if err := os.Rename(partPath, path); err != nil {
+		return fmt.Errorf("error completing download: %w (%s)", err, path)
+	}
+	return nil
+}
+
+// failedDownload is a download that failed and can be retried with
+// -retry-failed. The download's name, expected format and the records
+// that link to it are kept so that it can be added to the crate
+// without the collection.
+type failedDownload struct {
+	URL     string   `json:"url"`
+	Part    string   `json:"part"`
+	Error   string   `json:"error"`
+	Name    string   `json:"name,omitempty"`
+	Format  string   `json:"format,omitempty"`
+	Records []string `json:"records,omitempty"`
+}
+
+// writeFailed writes the failed downloads to failed.jsonl in the crate
+// or, if there are none, removes the list left by an earlier run.
+func writeFailed(crateDir string, failures []failedDownload) (string, error) {
+	failedPath := filepath.Join(crateDir, failedName)
+	if len(failures) == 0 {
+		if err := os.Remove(failedPath); err != nil && !os.IsNotExist(err) {
+			return failedPath, fmt.Errorf("error removing failed downloads: %w (%s)", err, failedPath)
+		}
+		return failedPath, nil
+	}
+	out, err := os.Create(failedPath)
+	if err != nil {
+		return failedPath, fmt.Errorf("error creating failed downloads: %w (%s)", err, failedPath)
+	}
+	defer out.Close()
+	encoder := json.NewEncoder(out)
+	for _, failure := range failures {
+		if err := encoder.Encode(failure); err != nil {
+			return failedPath, fmt.Errorf("error writing failed downloads: %w (%s)", err, failedPath)
+		}
+	}
+	return failedPath, nil
+}
+
+// readFailed reads a list of failed downloads.
+func readFailed(failedPath string) ([]failedDownload, error) {
+	data, err := os.ReadFile(failedPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading failed downloads: %w (%s)", err, failedPath)
+	}
+	failures := []failedDownload{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for decoder.More() {
+		var failure failedDownload
+		if err := decoder.Decode(&failure); err != nil {
+			return nil, fmt.Errorf("error parsing failed downloads: %w (%s)", err, failedPath)
+		}
+		failures = append(failures, failure)
+	}
+	return failures, nil
+}
+
+// failedStage records the downloads that failed in the crate and
+// reports whether the crate is complete.
+func failedStage(crateDir string, failures []failedDownload) bool {
+	failedPath, err := writeFailed(crateDir, failures)
+	if err != nil {
+		log.Println("cannot record failed downloads:", err)
+		os.Exit(1)
+	}
+	if len(failures) == 0 {
+		return true
+	}
+	log.Printf("%d downloads failed, retry them with: -retry-failed %s", len(failures), failedPath)
+	return false
+}
+
+// posterFormat is the format expected of every poster.
+const posterFormat string = "image/*"
+
+// expectedFormats returns the media type the collection gives for each
+// URL to download.
+func expectedFormats(collection types.Collection) map[string]string {
+	formats := map[string]string{}
+	for _, url := range collection.PosterURLs {
+		formats[url] = posterFormat
+	}
+	for _, item := range collection.Items {
+		for _, med := range item.Media {
+			formats[med.Url] = stripParams(med.MimeType)
+		}
+	}
+	return formats
+}
+
+// formatMatches reports whether the media type sniffed from a file is
+// consistent with the one expected. Sniffing only recognises a handful
+// of formats so anything it can't tell apart is accepted, but an HTML
+// page, e.g. a server's error page, is only accepted if HTML is
+// expected.
+func formatMatches(expected string, sniffed string) bool {
+	if sniffed == "text/html" {
+		return expected == "text/html" || expected == "application/xhtml+xml"
+	}
+	expectedType, _, _ := strings.Cut(expected, "/")
+	if sniffed == "text/plain" {
+		return !slices.Contains([]string{"image", "audio", "video"}, expectedType)
+	}
+	if expected == "" || sniffed == "" || sniffed == "application/octet-stream" {
+		return true
+	}
+	if expected == sniffed {
+		return true
+	}
+	if strings.HasSuffix(expected, "xml") {
+		return sniffed == "text/xml" || sniffed == "application/xml"
+	}
+	sniffedType, _, _ := strings.Cut(sniffed, "/")
+	return expectedType == sniffedType
+}
+
+// formatError is returned when a download isn't the expected format.
+type formatError struct {
+	url      string
+	expected string
+	sniffed  string
+	path     string
+}
+
+func (err formatError) Error() string {
+	return fmt.Sprintf("error downloading url: expected %s, received %s, quarantined at %s (%s)", err.expected, err.sniffed, err.path, err.url)
+}
+
+// quarantineDir returns the directory downloads that fail validation
+// are moved to, kept outside the crate so that they aren't packaged.
+func quarantineDir(crateDir string) string {
+	return fmt.Sprintf("%s-quarantine", crateDir)
+}
+
+// quarantinePart moves a download that isn't the format expected for
+// its URL from its .part file to quarantine.
+func (dl *downloader) quarantinePart(job downloadJob, formatErr formatError) error {
+	if formatErr.expected == "" {
+		formatErr.expected = "any format but HTML"
+	}
+	quarantinePath := filepath.Join(dl.quarantine, filepath.FromSlash(job.part))
+	if err := os.MkdirAll(filepath.Dir(quarantinePath), 0755); err != nil {
+		return fmt.Errorf("error creating quarantine: %w (%s)", err, dl.quarantine)
+	}
+	if err := os.Rename(formatErr.path, quarantinePath); err != nil {
+		return fmt.Errorf("error quarantining download: %w (%s)", err, job.path)
+	}
+	formatErr.path = quarantinePath
+	return formatErr
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ross-spencer/zenodocfl/internal/types"
+)
+
+// fileSource describes what is known about a crate part before it is
+// written to disk.
+type fileSource struct {
+	url      string
+	name     string
+	mimeType string
+}
+
+// recordFormat is the format of the records redistributed in the
+// crate.
+const recordFormat string = "application/json"
+
+// collectionSources returns what the collection tells us about each
+// of the parts downloaded or written for it. Records are matched to
+// their parts by position as returned by moveRecords, downloads by
+// their URL.
+func collectionSources(collection types.Collection, recordParts []string, downloads []downloadJob) map[string]fileSource {
+	sources := map[string]fileSource{}
+	for idx, item := range collection.Items {
+		if idx < len(recordParts) {
+			sources[recordParts[idx]] = fileSource{name: item.Label, mimeType: recordFormat}
+		}
+	}
+	media := map[string]types.Media{}
+	posters := map[string]string{}
+	for _, item := range collection.Items {
+		for _, med := range item.Media {
+			media[med.Url] = med
+		}
+		posters[item.Poster.Url] = item.Poster.Name
+		for _, rel := range item.Relationship {
+			posters[rel.Poster.Url] = rel.Poster.Name
+		}
+	}
+	for _, download := range downloads {
+		if med, ok := media[download.url]; ok {
+			sources[download.part] = fileSource{url: download.url, name: med.Name, mimeType: med.MimeType}
+			continue
+		}
+		sources[download.part] = fileSource{url: download.url, name: posters[download.url]}
+	}
+	return sources
+}
+
+// sniffFormat returns the media type of a file from its extension or,
+// failing that, from its content.
+func sniffFormat(filePath string) string {
+	if format := mime.TypeByExtension(filepath.Ext(filePath)); format != "" {
+		return stripParams(format)
+	}
+	return sniffContent(filePath)
+}
+
+// sniffContent returns the media type of a file from its content.
+func sniffContent(filePath string) string {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	head := make([]byte, 512)
+	read, _ := io.ReadFull(file, head)
+	if read == 0 {
+		return ""
+	}
+	return stripParams(http.DetectContentType(head[:read]))
+}
+
+// stripParams removes parameters such as charset from a media type.
+func stripParams(format string) string {
+	format, _, _ = strings.Cut(format, ";")
+	return strings.TrimSpace(format)
+}
+
+// fileSHA256 returns the hex encoded SHA-256 digest of a file.
+func fileSHA256(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("error opening file: %w (%s)", err, filePath)
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("error hashing file: %w (%s)", err, filePath)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// makeFileEntity describes a single crate part. Size, checksum and
+// modification date are only added when the file exists, e.g. they
+// are left out in a dry-run.
+func makeFileEntity(crateDir string, part string, source fileSource) (fileEntity, error) {
+	entity := fileEntity{
+		ID:             part,
+		Type:           "File",
+		Name:           source.name,
+		EncodingFormat: stripParams(source.mimeType),
+		ContentURL:     source.url,
+	}
+	if entity.Name == "" {
+		entity.Name = path.Base(part)
+	}
+	filePath := filepath.Join(crateDir, filepath.FromSlash(part))
+	info, err := os.Stat(filePath)
+	if err != nil {
+		if entity.EncodingFormat == "" {
+			entity.EncodingFormat = stripParams(mime.TypeByExtension(filepath.Ext(filePath)))
+		}
+		return entity, nil
+	}
+	if entity.EncodingFormat == "" {
+		entity.EncodingFormat = sniffFormat(filePath)
+	}
+	entity.ContentSize = strconv.FormatInt(info.Size(), 10)
+	entity.DateModified = info.ModTime().UTC().Format(time.RFC3339)
+	entity.SHA256, err = fileSHA256(filePath)
+	if err != nil {
+		return entity, err
+	}
+	return entity, nil
+}
+
+// makeFileEntities returns a File entity for every part of the crate.
+func makeFileEntities(crateDir string, parts []string, sources map[string]fileSource) ([]fileEntity, error) {
+	entities := []fileEntity{}
+	for _, part := range parts {
+		entity, err := makeFileEntity(crateDir, part, sources[part])
+		if err != nil {
+			return entities, err
+		}
+		entities = append(entities, entity)
+	}
+	return entities, nil
+}
@@ -1,20 +1,20 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"math/rand"
-	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/ross-spencer/zenodocfl/internal/types"
 
-	nanoid "github.com/matoous/go-nanoid/v2"
 	ulid "github.com/oklog/ulid/v2"
 )
 
@@ -34,31 +34,10 @@ func readManifest(manifest string) types.Collection {
 
 }
 
-// downloadCrateObj enables us to download material from a given URL
-// and save ti in the given folder.
-func downloadCrateObj(url string, path string) error {
-	out, err := os.Create(path)
-	if err != nil {
-		return fmt.Errorf("error creating path: %w (%s)", err, path)
-	}
-	defer out.Close()
-	resp, err := http.Get(url)
-	if err != nil {
-		return fmt.Errorf("error downloading url: %w (%s)", err, url)
-	}
-	defer resp.Body.Close()
-	_, err = io.Copy(out, resp.Body)
-	if err != nil {
-		return fmt.Errorf("error accessing url data: %w (%s)", err, url)
-	}
-	return nil
-}
-
 // createCrateObj handles the creation of a RO-Crate object based on
 // the information provided by the user.
 func createCrateObj(path string, data string) {
 	log.Println("metadata path:", path)
-	log.Printf("preview with: `rochtml %s` (if installed)", path)
 	err := os.WriteFile(path, []byte(fmt.Sprintf("%s\n", data)), 0755)
 	if err != nil {
 		log.Println("unable to write to file;", err)
@@ -88,26 +67,43 @@ func makeFilename(url string) string {
 }
 
 // downloadFile retrieves media from the server and stores it in the
-// given path.
-func downloadFile(urls []string, path string, partPrefix string, dryrun bool) []string {
-	parts := []string{}
-	for _, url := range urls {
-		fileName := makeFilename(url)
-		filePath := filepath.Join(path, fileName)
+// crate. Files an existing crate already downloaded from the same URL
+// are kept rather than downloaded again. The files of the crate are
+// returned in the order given, without those that failed to download
+// unless the existing crate holds a copy.
+func downloadFile(dl *downloader, files []downloadJob, crateDir string, existing existingCrate, dryrun bool) ([]downloadJob, []failedDownload) {
+	downloads := slices.Clone(files)
+	jobs := []downloadJob{}
+	for _, job := range files {
 		if debug {
-			log.Println(filePath)
+			log.Println(job.path)
 		}
-
-		if !dryrun {
-			err := downloadCrateObj(url, filePath)
-			if err != nil {
-				log.Printf("cannot download object: %s", err)
-				os.Exit(1)
-			}
+		if existing.unchanged(crateDir, job.part, job.url) || dryrun {
+			continue
 		}
-		parts = append(parts, fmt.Sprintf("%s/%s", partPrefix, fileName))
+		if existing.files[job.part] == job.url {
+			job.sha256 = existing.hashes[job.part]
+		}
+		jobs = append(jobs, job)
 	}
-	return parts
+	failures := []failedDownload{}
+	for idx, err := range dl.download(jobs) {
+		if err == nil {
+			continue
+		}
+		job := jobs[idx]
+		log.Printf("cannot download object: %s", err)
+		failures = append(failures, failedDownload{URL: job.url, Part: job.part, Error: err.Error(), Format: dl.formats[job.url]})
+		pos := slices.IndexFunc(downloads, func(download downloadJob) bool { return download.part == job.part })
+		// keep the copy an existing crate already holds rather than
+		// leaving the crate without it.
+		if existing.holds(crateDir, job.part) {
+			downloads[pos].stale = true
+			continue
+		}
+		downloads = slices.Delete(downloads, pos, pos+1)
+	}
+	return downloads, failures
 }
 
 const crateName string = "ro-crate-metadata.json"
@@ -136,8 +132,21 @@ type metaJSON struct {
 	Publisher   []publisher `json:"publisher"`
 	// we might not always have a canonical url.
 	Url string `json:"url"`
+	// profiles the crate conforms to in addition to RO-Crate.
+	Profiles []profile `json:"profiles"`
 	// added automatically.
-	parts []string
+	rocrate       string
+	parts         []string
+	files         []fileEntity
+	records       []recordEntity
+	persons       []personEntity
+	pids          []propertyValue
+	licenses      []licenseEntity
+	actions       []createAction
+	datePublished string
+	dateModified  string
+	provenance    []interface{}
+	identifier    string
 }
 
 func (metaJSON metaJSON) String() string {
@@ -153,6 +162,12 @@ func (metaJSON metaJSON) String() string {
 	)
 }
 
+// crateSlug returns the collection name in a form that can be used
+// in file names.
+func crateSlug(metaJSON metaJSON) string {
+	return strings.Replace(metaJSON.Name, " ", "-", -1)
+}
+
 func getKeywords(values string) []string {
 	keywords := []string{}
 	tmpKeys := strings.Split(values, ",")
@@ -169,9 +184,12 @@ func makeULID(prefix string) string {
 	return fmt.Sprintf("%s-%s", prefix, id)
 }
 
-func makePubID() string {
-	id, _ := nanoid.New()
-	return fmt.Sprintf("_:%s", id[:6])
+// makePubID returns the blank node identifier of a publisher without
+// an identifier of its own. It is derived from the publisher's name so
+// that the crate is the same each time it is built.
+func makePubID(name string) string {
+	digest := sha256.Sum256([]byte(name))
+	return fmt.Sprintf("_:%s", hex.EncodeToString(digest[:3]))
 }
 
 func makePublishedDate() string {
@@ -191,11 +209,11 @@ func makePublisher(metaJSON metaJSON) ([]idPointer, []org) {
 	for _, v := range metaJSON.Publisher {
 		pub := org{}
 		pub.Name = v.PublisherName
+		pub.Type = orgType
 		if v.PublisherIdentifier == "" {
-			pub.ID = makePubID()
+			pub.ID = makePubID(v.PublisherName)
 		} else {
 			pub.ID = v.PublisherIdentifier
-			pub.Type = orgType
 		}
 		ids = append(ids, idPointer{pub.ID})
 		orgs = append(orgs, pub)
@@ -209,33 +227,76 @@ func makeCrateObj(metaJSON metaJSON) rocrate {
 
 	const rootID string = "./"
 
+	// the version is checked when the flags are read.
+	spec, _ := rocrateVersion(metaJSON.rocrate)
+
 	crate := rocrate{}
-	crate.Context = rocrateContext
+	crate.Context = spec.context
 	meta := root{}
 	meta.ID = crateName
-	meta.Identifier = crateName
+	if spec.descriptorIdentifier {
+		meta.Identifier = crateName
+	}
 	meta.Type = creativeWork
 	meta.About = idPointer{rootID}
-	meta.ConformsTo = idPointer{rocrateConform}
+	meta.ConformsTo = idPointer{spec.conformsTo}
 	obj := files{}
 	obj.ID = rootID
-	obj.Identifier = makeULID(metaJSON.IDPrefix)
+	obj.Identifier = metaJSON.identifier
+	if obj.Identifier == "" {
+		obj.Identifier = makeULID(metaJSON.IDPrefix)
+	}
 	obj.Type = metaJSON.RecordType
 	obj.Name = metaJSON.Name
 	obj.Description = metaJSON.Description
-	obj.License = metaJSON.License
-	obj.DatePublished = makePublishedDate()
+	obj.License = pointer(licenseEntityID(metaJSON.License))
+	obj.DatePublished = publishedDate(metaJSON)
+	obj.DateModified = metaJSON.dateModified
 	obj.Keywords = getKeywords(metaJSON.Keywords)
 	obj.ContentURL = metaJSON.Url
 	for _, item := range metaJSON.parts {
 		obj.HasPart = append(obj.HasPart, idPointer{item})
 	}
+	for _, record := range metaJSON.records {
+		if strings.HasPrefix(record.ID, "#") {
+			obj.Mentions = append(obj.Mentions, idPointer{record.ID})
+		}
+	}
+	for _, action := range metaJSON.actions {
+		obj.Mentions = append(obj.Mentions, idPointer{action.ID})
+	}
 	pubIDs, pubOrgs := makePublisher(metaJSON)
 	obj.Publisher = pubIDs
+	profileIDs, profiles := makeProfiles(spec, metaJSON.Profiles)
+	if len(profileIDs) > 0 {
+		obj.ConformsTo = profileIDs
+	}
 	crate.Graph = append(crate.Graph, meta)
 	crate.Graph = append(crate.Graph, obj)
 	for _, org := range pubOrgs {
 		crate.Graph = append(crate.Graph, org)
 	}
+	for _, prof := range profiles {
+		crate.Graph = append(crate.Graph, prof)
+	}
+	for _, license := range metaJSON.licenses {
+		crate.Graph = append(crate.Graph, license)
+	}
+	for _, file := range metaJSON.files {
+		crate.Graph = append(crate.Graph, file)
+	}
+	for _, record := range metaJSON.records {
+		crate.Graph = append(crate.Graph, record)
+	}
+	for _, person := range metaJSON.persons {
+		crate.Graph = append(crate.Graph, person)
+	}
+	for _, pid := range metaJSON.pids {
+		crate.Graph = append(crate.Graph, pid)
+	}
+	for _, action := range metaJSON.actions {
+		crate.Graph = append(crate.Graph, action)
+	}
+	crate.Graph = append(crate.Graph, metaJSON.provenance...)
 	return crate
 }
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/ross-spencer/zenodocfl/internal/types"
+)
+
+// licenseEntityID returns the identifier of the entity describing a
+// license. License URLs are used as-is, anything else is given a
+// local identifier, e.g. #license-in-copyright.
+func licenseEntityID(license string) string {
+	license = strings.TrimSpace(license)
+	if license == "" {
+		return ""
+	}
+	if parsed, err := url.Parse(license); err == nil && parsed.Host != "" {
+		return license
+	}
+	return fmt.Sprintf("#license-%s", personKey(license))
+}
+
+// licenseKey returns the key licenses are compared by so that, e.g.
+// http and https forms of the same Creative Commons license are the
+// same license.
+func licenseKey(license string) string {
+	if id, err := licenseID(license); err == nil {
+		return id
+	}
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(license)), "/")
+}
+
+// licenseName returns a human-readable name for a license, e.g.
+// CC BY 4.0. Licenses licenseID doesn't understand are named by
+// their URL.
+func licenseName(license string) string {
+	license = strings.TrimSpace(license)
+	parsed, err := url.Parse(license)
+	if err != nil || parsed.Host == "" {
+		return license
+	}
+	id, err := licenseID(license)
+	if err != nil {
+		return license
+	}
+	if version, ok := strings.CutPrefix(id, "cc0-"); ok {
+		return fmt.Sprintf("CC0 %s", version)
+	}
+	if terms, ok := strings.CutPrefix(id, "cc-"); ok {
+		idx := strings.LastIndex(terms, "-")
+		if idx > 0 {
+			return fmt.Sprintf("CC %s %s", strings.ToUpper(terms[:idx]), terms[idx+1:])
+		}
+	}
+	// SPDX identifiers keep the case used in the URL, e.g. MIT.
+	return strings.TrimSuffix(path.Base(parsed.Path), ".html")
+}
+
+// makeLicenseEntity describes a license as a contextual entity.
+func makeLicenseEntity(license string) licenseEntity {
+	entity := licenseEntity{
+		ID:   licenseEntityID(license),
+		Type: creativeWork,
+		Name: licenseName(license),
+	}
+	if entity.ID == license {
+		entity.URL = license
+	}
+	return entity
+}
+
+// licenseUsage records the records and files under a license that
+// differs from the collection's.
+type licenseUsage struct {
+	license string
+	records []string
+	files   []string
+}
+
+// licenseReport summarises the licensing of a crate.
+type licenseReport struct {
+	collection string
+	mixed      []licenseUsage
+	// conflicts are files shared by records with different licenses.
+	conflicts []string
+}
+
+// String(er) for the licenseReport.
+func (report licenseReport) String() string {
+	if len(report.mixed) == 0 {
+		return fmt.Sprintf("all records are licensed %s", licenseName(report.collection))
+	}
+	var out strings.Builder
+	fmt.Fprintf(&out, "mixed licensing, collection license: %s (%s)\n", licenseName(report.collection), report.collection)
+	for _, usage := range report.mixed {
+		fmt.Fprintf(&out, "  %s (%s): %d records, %d files: %s\n",
+			licenseName(usage.license),
+			usage.license,
+			len(usage.records),
+			len(usage.files),
+			strings.Join(usage.records, ", "),
+		)
+	}
+	for _, file := range report.conflicts {
+		fmt.Fprintf(&out, "  file shared by records with different licenses, first license kept: %s\n", file)
+	}
+	return strings.TrimSuffix(out.String(), "\n")
+}
+
+// recordFiles returns the crate files belonging to a record.
+func recordFiles(record recordEntity) []string {
+	files := []string{}
+	for _, ptr := range []*idPointer{record.SubjectOf, record.Image} {
+		if ptr != nil {
+			files = append(files, ptr.ID)
+		}
+	}
+	for _, part := range record.HasPart {
+		files = append(files, part.ID)
+	}
+	return files
+}
+
+// applyLicenses describes the collection license and every record
+// license that differs from it as contextual entities. Records with a
+// different license, and their files, are given their own license
+// property. Records are matched to the collection's items by
+// position as returned by makeRecordEntities.
+func applyLicenses(license string, items []types.Item, records []recordEntity, files []fileEntity) ([]licenseEntity, licenseReport) {
+	report := licenseReport{collection: license}
+	entities := []licenseEntity{}
+	if license != "" {
+		entities = append(entities, makeLicenseEntity(license))
+	}
+	fileIndex := map[string]int{}
+	for idx, file := range files {
+		fileIndex[file.ID] = idx
+	}
+	usage := map[string]int{}
+	licensed := map[string]string{}
+	for idx, item := range items {
+		if idx >= len(records) || item.License == "" || licenseKey(item.License) == licenseKey(license) {
+			continue
+		}
+		ptr := &idPointer{licenseEntityID(item.License)}
+		if _, ok := usage[ptr.ID]; !ok {
+			usage[ptr.ID] = len(report.mixed)
+			report.mixed = append(report.mixed, licenseUsage{license: item.License})
+			entities = append(entities, makeLicenseEntity(item.License))
+		}
+		records[idx].License = ptr
+		mixed := &report.mixed[usage[ptr.ID]]
+		mixed.records = append(mixed.records, records[idx].ID)
+		for _, file := range recordFiles(records[idx]) {
+			fileIdx, ok := fileIndex[file]
+			if !ok {
+				continue
+			}
+			if previous, ok := licensed[file]; ok {
+				if previous != ptr.ID && !slices.Contains(report.conflicts, file) {
+					report.conflicts = append(report.conflicts, file)
+				}
+				continue
+			}
+			licensed[file] = ptr.ID
+			files[fileIdx].License = ptr
+			mixed.files = append(mixed.files, file)
+		}
+	}
+	return entities, report
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// urlMapName is the name of the table mapping the URLs downloaded into
+// the crate to their paths.
+const urlMapName string = "url-map.csv"
+
+// maxNameLength is the longest file name, in bytes, given to a
+// download. It leaves room for the crate's directories within the 260
+// character path limit of Windows.
+const maxNameLength int = 128
+
+// reservedNames can't be used as file names on Windows whatever their
+// extension.
+var reservedNames = []string{
+	"CON", "PRN", "AUX", "NUL",
+	"COM1", "COM2", "COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9",
+	"LPT1", "LPT2", "LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9",
+}
+
+// portableRune reports whether a character can be used in a file name
+// on every platform and in an RO-Crate @id without escaping.
+func portableRune(char rune) bool {
+	return unicode.IsLetter(char) || unicode.IsDigit(char) || char == '.' || char == '-' || char == '_'
+}
+
+// truncateName shortens a name to at most length bytes, keeping its
+// extension and cutting on a character boundary.
+func truncateName(name string, length int) string {
+	if len(name) <= length {
+		return name
+	}
+	ext := path.Ext(name)
+	if len(ext) >= length/2 {
+		ext = ""
+	}
+	base := strings.TrimSuffix(name, ext)
+	limit := length - len(ext)
+	for len(base) > limit {
+		_, size := utf8.DecodeLastRuneInString(base)
+		base = base[:len(base)-size]
+	}
+	return base + ext
+}
+
+// portableName returns a file name that is valid on every platform.
+// The name is unescaped and normalised to NFC, any character that
+// isn't a letter, digit, '.', '-' or '_' is replaced with '_' and names
+// reserved by Windows or hidden on Unix are prefixed with '_'.
+func portableName(name string) string {
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		name = unescaped
+	}
+	name = norm.NFC.String(name)
+	name = strings.Map(func(char rune) rune {
+		if portableRune(char) {
+			return char
+		}
+		return '_'
+	}, name)
+	name = strings.TrimRight(name, ".")
+	if name == "" {
+		name = "file"
+	}
+	base, _, _ := strings.Cut(name, ".")
+	for _, reserved := range reservedNames {
+		if strings.EqualFold(base, reserved) {
+			name = "_" + name
+			break
+		}
+	}
+	if strings.HasPrefix(name, ".") {
+		name = "_" + name
+	}
+	return truncateName(name, maxNameLength)
+}
+
+// disambiguate adds the first bytes of a digest of the URL to a name
+// so that it no longer collides with the name given to another URL.
+func disambiguate(name string, rawURL string, size int) string {
+	digest := sha256.Sum256([]byte(rawURL))
+	suffix := "-" + hex.EncodeToString(digest[:min(size, len(digest))])
+	ext := path.Ext(name)
+	base := truncateName(strings.TrimSuffix(name, ext), maxNameLength-len(suffix)-len(ext))
+	return base + suffix + ext
+}
+
+// crateNames gives each URL downloaded into the crate a portable path
+// of its own. Names are compared case insensitively as two names that
+// only differ in case are the same file on Windows and macOS.
+type crateNames struct {
+	used map[string]string
+}
+
+// newCrateNames returns the names for a crate, reserving the parts an
+// existing crate already downloaded from the given URLs so that they
+// keep their names.
+func newCrateNames(existing existingCrate) *crateNames {
+	names := &crateNames{used: map[string]string{}}
+	for part, rawURL := range existing.files {
+		if rawURL != "" {
+			names.used[strings.ToLower(part)] = rawURL
+		}
+	}
+	return names
+}
+
+// taken reports whether a part is already used for another URL.
+func (names *crateNames) taken(part string, rawURL string) bool {
+	used, ok := names.used[strings.ToLower(part)]
+	return ok && used != rawURL
+}
+
+// part returns the path of the part for a URL in the given directory
+// of the crate. A name that is already used for another URL is
+// disambiguated with a digest of the URL, lengthened until the name is
+// unused.
+func (names *crateNames) part(partPrefix string, rawURL string) string {
+	name := portableName(makeFilename(rawURL))
+	part := fmt.Sprintf("%s/%s", partPrefix, name)
+	for size := 4; names.taken(part, rawURL) && size <= sha256.Size; size += 2 {
+		part = fmt.Sprintf("%s/%s", partPrefix, disambiguate(name, rawURL, size))
+	}
+	names.used[strings.ToLower(part)] = rawURL
+	return part
+}
+
+// jobs returns the downloads for the URLs into the given directory of
+// the crate. A URL listed more than once is downloaded once.
+func (names *crateNames) jobs(crateDir string, partPrefix string, urls []string) []downloadJob {
+	jobs := []downloadJob{}
+	seen := map[string]bool{}
+	for _, rawURL := range urls {
+		if seen[rawURL] {
+			continue
+		}
+		seen[rawURL] = true
+		part := names.part(partPrefix, rawURL)
+		jobs = append(jobs, downloadJob{
+			url:  rawURL,
+			path: filepath.Join(crateDir, filepath.FromSlash(part)),
+			part: part,
+		})
+	}
+	return jobs
+}
+
+// writeURLMap writes the table mapping each URL downloaded into the
+// crate to its path.
+func writeURLMap(crateDir string, downloads []downloadJob) error {
+	mapPath := filepath.Join(crateDir, urlMapName)
+	out, err := os.Create(mapPath)
+	if err != nil {
+		return fmt.Errorf("error creating url map: %w (%s)", err, mapPath)
+	}
+	defer out.Close()
+	writer := csv.NewWriter(out)
+	writer.Write([]string{"url", "path"})
+	for _, download := range downloads {
+		writer.Write([]string{download.url, download.part})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing url map: %w (%s)", err, mapPath)
+	}
+	return nil
+}
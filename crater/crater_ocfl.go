@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ross-spencer/zenodocfl/internal/ocfl"
+	ro "github.com/ross-spencer/zenodocfl/internal/rocrate"
+)
+
+// ocflUser is the agent recorded against every version crater writes.
+var ocflUser = ocfl.User{
+	Name:    agent,
+	Address: "https://github.com/ross-spencer/zenodocfl",
+}
+
+// objectID returns the identifier of the OCFL object for a crate in a
+// storage root with the given layout. The flat-direct layout names the
+// object's directory after its identifier and ':' can't be used in a
+// path on Windows, so there the crate identifier is used as-is.
+func objectID(identifier string, layout ocfl.Layout) string {
+	if layout.Name() == ocfl.FlatDirect {
+		return identifier
+	}
+	return ocfl.ObjectURN + identifier
+}
+
+// crateID returns the identifier of the crate stored in an OCFL
+// object. Objects in flat-direct storage roots, or written before
+// their identifiers were URIs, are identified by the crate identifier
+// itself.
+func crateID(id string) string {
+	return strings.TrimPrefix(id, ocfl.ObjectURN)
+}
+
+// rootName returns the name of the root dataset of the crate whose
+// metadata is at the given path. Only the root is decoded as the other
+// entities of the graph vary in shape.
+func rootName(metadataPath string) (string, error) {
+	crate, err := ro.Read(metadataPath)
+	if err != nil {
+		return "", err
+	}
+	root, ok := crate.Entity("./")
+	if !ok {
+		return "", fmt.Errorf("crate has no root dataset: %s", metadataPath)
+	}
+	name, _ := root["name"].(string)
+	return name, nil
+}
+
+// findCrateObject looks for an existing object in the storage root
+// whose head version describes the same collection as metaJSON. The
+// crate's identifier and the object's path are returned if it exists.
+func findCrateObject(root string, metaJSON metaJSON) (string, string, error) {
+	if !ocfl.IsStorageRoot(root) {
+		return "", "", nil
+	}
+	storageRoot, err := ocfl.OpenStorageRoot(root)
+	if err != nil {
+		return "", "", err
+	}
+	objects, err := storageRoot.Objects()
+	if err != nil {
+		return "", "", err
+	}
+	for _, object := range objects {
+		objectPath := object.Path
+		inv, err := ocfl.ReadInventory(objectPath)
+		if err != nil {
+			return "", "", err
+		}
+		if !strings.HasPrefix(crateID(inv.ID), fmt.Sprintf("%s-", metaJSON.IDPrefix)) {
+			continue
+		}
+		contentPath, ok := inv.ContentPath(inv.Head, crateName)
+		if !ok {
+			continue
+		}
+		name, err := rootName(filepath.Join(objectPath, filepath.FromSlash(contentPath)))
+		if err != nil {
+			return "", "", err
+		}
+		if name == metaJSON.Name {
+			return crateID(inv.ID), objectPath, nil
+		}
+	}
+	return "", "", nil
+}
+
+// derivedFiles are rendered from the crate metadata, and the dates
+// in it, so they change whenever it does.
+var derivedFiles = []string{previewName, dataciteName}
+
+// crateContent returns the crate metadata at the given path without
+// what changes every time crater runs: the identifier and times of the
+// CreateAction describing crater's own run and the dates the crate and
+// its files were modified.
+func crateContent(metadataPath string) ([]byte, error) {
+	crate, err := ro.Read(metadataPath)
+	if err != nil {
+		return nil, err
+	}
+	runs := map[string]string{}
+	for _, entity := range crate.Graph {
+		agents := entity.Refs("agent")
+		if entity.HasType("CreateAction") && len(agents) > 0 && strings.HasPrefix(agents[0], fmt.Sprintf("#%s-", craterApp)) {
+			runs[entity.ID()] = fmt.Sprintf("#%s-run", craterApp)
+			delete(entity, "startTime")
+			delete(entity, "endTime")
+		}
+		delete(entity, "dateModified")
+	}
+	for _, entity := range crate.Graph {
+		repoint(map[string]any(entity), runs)
+	}
+	return json.Marshal(map[string]any{"@context": crate.Context, "@graph": crate.Graph})
+}
+
+// sameCrate reports whether the crate directory holds the same crate as
+// the head version of an existing object, ignoring what changes every
+// time crater runs.
+func sameCrate(objectPath string, crateDir string) (bool, error) {
+	inv, err := ocfl.ReadInventory(objectPath)
+	if err != nil {
+		return false, err
+	}
+	head := map[string]string{}
+	for digest, paths := range inv.Versions[inv.Head].State {
+		for _, logical := range paths {
+			head[logical] = digest
+		}
+	}
+	same := true
+	files := 0
+	err = filepath.WalkDir(crateDir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(crateDir, filePath)
+		if err != nil {
+			return err
+		}
+		logical := filepath.ToSlash(rel)
+		files++
+		digest, ok := head[logical]
+		switch {
+		case !ok:
+			same = false
+		case slices.Contains(derivedFiles, logical):
+		case logical == crateName:
+			contentPath, _ := inv.ContentPath(inv.Head, crateName)
+			previous, err := crateContent(filepath.Join(objectPath, filepath.FromSlash(contentPath)))
+			if err != nil {
+				return err
+			}
+			current, err := crateContent(filePath)
+			if err != nil {
+				return err
+			}
+			same = bytes.Equal(previous, current)
+		default:
+			current, err := ocfl.FileDigest(filePath)
+			if err != nil {
+				return fmt.Errorf("error hashing file: %w (%s)", err, filePath)
+			}
+			same = current == digest
+		}
+		if !same {
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return same && files == len(head), nil
+}
+
+// versionMessage returns the message to record with a new version.
+func versionMessage(metaJSON metaJSON, update bool) string {
+	if message != "" {
+		return message
+	}
+	if update {
+		return fmt.Sprintf("update crate: %s (%d parts)", metaJSON.Name, len(metaJSON.parts))
+	}
+	return fmt.Sprintf("create crate: %s (%d parts)", metaJSON.Name, len(metaJSON.parts))
+}
+
+// writeOCFL writes the crate directory to the given storage root. If
+// objectPath is empty a new object is created, otherwise the crate is
+// added to the existing object as a new version unless it is the same
+// crate as the head version.
+func writeOCFL(root string, metaJSON metaJSON, crateDir string, objectPath string) (ocfl.Inventory, error) {
+	commit := ocfl.Commit{
+		Message: versionMessage(metaJSON, objectPath != ""),
+		User:    ocflUser,
+	}
+	if objectPath != "" {
+		same, err := sameCrate(objectPath, crateDir)
+		if err != nil {
+			return ocfl.Inventory{}, err
+		}
+		if same {
+			inv, err := ocfl.ReadInventory(objectPath)
+			if err != nil {
+				return inv, err
+			}
+			return inv, ocfl.ErrUnchanged
+		}
+		return ocfl.AddVersion(objectPath, crateDir, commit)
+	}
+	layout, err := ocfl.NewLayout(storageLayout)
+	if err != nil {
+		return ocfl.Inventory{}, err
+	}
+	storageRoot, err := ocfl.InitStorageRoot(root, layout)
+	if err != nil {
+		return ocfl.Inventory{}, err
+	}
+	if storageRoot.Layout.Name() != storageLayout {
+		log.Printf("using existing storage root layout: %s", storageRoot.Layout.Name())
+	}
+	id := objectID(metaJSON.identifier, storageRoot.Layout)
+	objectPath, err = storageRoot.ObjectPath(id)
+	if err != nil {
+		return ocfl.Inventory{}, err
+	}
+	return ocfl.CreateObject(objectPath, id, crateDir, commit)
+}
+
+// ocflCrate writes the crate to the OCFL storage root given by the
+// user. If objectPath is not empty a new version is added to it.
+func ocflCrate(metaJSON metaJSON, crateDir string, objectPath string, dryrun bool) {
+	if dryrun {
+		log.Println("dry-run: not writing OCFL object to:", ocflRoot)
+		return
+	}
+	inv, err := writeOCFL(ocflRoot, metaJSON, crateDir, objectPath)
+	if errors.Is(err, ocfl.ErrUnchanged) {
+		log.Printf("crate unchanged, ocfl object remains at: %s", inv.Head)
+		return
+	}
+	if err != nil {
+		log.Println("cannot write OCFL object:", err)
+		os.Exit(1)
+	}
+	log.Printf("ocfl object: %s (%s)", inv.ID, inv.Head)
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// packageLimits describes the limits a packaged crate must be split
+// within. A zero value means no limit.
+type packageLimits struct {
+	partFiles int
+	partSize  int64
+	maxFiles  int
+	maxSize   int64
+}
+
+// packagePart is a single zip archive and the logical crate files
+// stored inside it.
+type packagePart struct {
+	name  string
+	files []string
+	size  int64
+}
+
+// zipEpoch is the modification time given to every zip entry so that
+// packaging the same crate twice produces identical archives.
+var zipEpoch = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// sizeUnits are the decimal units accepted by parseSize.
+var sizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"TB", 1000 * 1000 * 1000 * 1000},
+	{"GB", 1000 * 1000 * 1000},
+	{"MB", 1000 * 1000},
+	{"KB", 1000},
+	{"B", 1},
+}
+
+// parseSize converts a size such as "2GB" or "500MB" into bytes.
+func parseSize(size string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(size))
+	multiplier := int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+	num, err := strconv.ParseFloat(value, 64)
+	if err != nil || num < 0 {
+		return 0, fmt.Errorf("invalid size: '%s'", size)
+	}
+	return int64(num * float64(multiplier)), nil
+}
+
+// partName returns the file name of a numbered archive part.
+func partName(metaJSON metaJSON, num int) string {
+	return fmt.Sprintf("%s-part-%03d.zip", crateSlug(metaJSON), num)
+}
+
+// planParts distributes the files of a crate across archive parts in
+// order without exceeding the per-part limits. A file larger than the
+// part size limit is given a part of its own.
+func planParts(metaJSON metaJSON, crateDir string, limits packageLimits) ([]packagePart, error) {
+	parts := []packagePart{}
+	current := packagePart{}
+	for _, file := range slices.Concat(metadataFiles(crateDir), metaJSON.parts) {
+		info, err := os.Stat(filepath.Join(crateDir, filepath.FromSlash(file)))
+		if err != nil {
+			return parts, fmt.Errorf("error reading crate file: %w (%s)", err, file)
+		}
+		full := limits.partFiles > 0 && len(current.files) >= limits.partFiles
+		large := limits.partSize > 0 && current.size+info.Size() > limits.partSize
+		if len(current.files) > 0 && (full || large) {
+			parts = append(parts, current)
+			current = packagePart{}
+		}
+		if limits.partSize > 0 && info.Size() > limits.partSize {
+			log.Printf("file is larger than the part size limit: %s (%d bytes)", file, info.Size())
+		}
+		current.files = append(current.files, file)
+		current.size += info.Size()
+	}
+	if len(current.files) > 0 {
+		parts = append(parts, current)
+	}
+	for idx := range parts {
+		parts[idx].name = partName(metaJSON, idx+1)
+	}
+	return parts, nil
+}
+
+// checkRecordLimits ensures the packaged crate, including its
+// top-level metadata, fits within a single record.
+func checkRecordLimits(parts []packagePart, limits packageLimits) error {
+	if limits.maxFiles > 0 && len(parts)+1 > limits.maxFiles {
+		return fmt.Errorf("package needs %d files, more than the record limit of %d", len(parts)+1, limits.maxFiles)
+	}
+	var total int64
+	for _, part := range parts {
+		total += part.size
+	}
+	if limits.maxSize > 0 && total > limits.maxSize {
+		return fmt.Errorf("package needs %d bytes, more than the record limit of %d", total, limits.maxSize)
+	}
+	return nil
+}
+
+// writePart writes an archive part, keeping the crate's directory
+// structure inside the zip.
+func writePart(crateDir string, packageDir string, part packagePart) (int64, error) {
+	zipPath := filepath.Join(packageDir, part.name)
+	out, err := os.Create(zipPath)
+	if err != nil {
+		return 0, fmt.Errorf("error creating archive: %w (%s)", err, zipPath)
+	}
+	defer out.Close()
+	archive := zip.NewWriter(out)
+	for _, file := range part.files {
+		if err := addToZip(archive, crateDir, file); err != nil {
+			return 0, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return 0, fmt.Errorf("error writing archive: %w (%s)", err, zipPath)
+	}
+	info, err := out.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("error reading archive: %w (%s)", err, zipPath)
+	}
+	return info.Size(), nil
+}
+
+// addToZip adds a single crate file to an archive.
+func addToZip(archive *zip.Writer, crateDir string, file string) error {
+	in, err := os.Open(filepath.Join(crateDir, filepath.FromSlash(file)))
+	if err != nil {
+		return fmt.Errorf("error opening crate file: %w (%s)", err, file)
+	}
+	defer in.Close()
+	header := &zip.FileHeader{
+		Name:     file,
+		Method:   zip.Deflate,
+		Modified: zipEpoch,
+	}
+	writer, err := archive.CreateHeader(header)
+	if err != nil {
+		return fmt.Errorf("error adding file to archive: %w (%s)", err, file)
+	}
+	if _, err := io.Copy(writer, in); err != nil {
+		return fmt.Errorf("error adding file to archive: %w (%s)", err, file)
+	}
+	return nil
+}
+
+// packedID returns the @id given to a file of the crate once it is
+// stored inside an archive part. Files inside a zip don't exist on
+// disk in the package so they are described by a local identifier
+// rather than a path.
+func packedID(partName string, file string) string {
+	return fmt.Sprintf("#%s/%s", partName, file)
+}
+
+// repoint replaces every @id in a JSON value that has been given a new
+// identifier.
+func repoint(value any, ids map[string]string) {
+	switch value := value.(type) {
+	case map[string]any:
+		if id, ok := value["@id"].(string); ok {
+			if packed, ok := ids[id]; ok {
+				value["@id"] = packed
+			}
+		}
+		for _, item := range value {
+			repoint(item, ids)
+		}
+	case []any:
+		for _, item := range value {
+			repoint(item, ids)
+		}
+	}
+}
+
+// packageMetadata returns the top-level RO-CRATE metadata for a
+// packaged crate. The crate's own graph is kept but the files stored
+// inside the archive parts are described by the part they are in:
+// the root dataset points at the archive parts and every part lists
+// the files it contains.
+func packageMetadata(crateDir string, parts []packagePart, sizes []int64) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(crateDir, crateName))
+	if err != nil {
+		return nil, fmt.Errorf("error reading crate metadata: %w", err)
+	}
+	var crate map[string]any
+	if err := json.Unmarshal(data, &crate); err != nil {
+		return nil, fmt.Errorf("error parsing crate metadata: %w", err)
+	}
+	ids := map[string]string{}
+	for _, part := range parts {
+		for _, file := range part.files {
+			if file != crateName && file != previewName {
+				ids[file] = packedID(part.name, file)
+			}
+		}
+	}
+	graph, _ := crate["@graph"].([]any)
+	repoint(graph, ids)
+	partIDs := []idPointer{}
+	for _, part := range parts {
+		partIDs = append(partIDs, idPointer{part.name})
+	}
+	for _, entity := range graph {
+		entity, ok := entity.(map[string]any)
+		if ok && entity["@id"] == "./" {
+			entity["hasPart"] = partIDs
+		}
+	}
+	for idx, part := range parts {
+		contents := []idPointer{}
+		for _, file := range part.files {
+			id := packedID(part.name, file)
+			contents = append(contents, idPointer{id})
+			if _, ok := ids[file]; ok {
+				continue
+			}
+			// the crate's own metadata and preview are only described
+			// as part of the archive.
+			graph = append(graph, fileEntity{
+				ID:             id,
+				Type:           "File",
+				Name:           file,
+				EncodingFormat: stripParams(mime.TypeByExtension(filepath.Ext(file))),
+			})
+		}
+		graph = append(graph, archivePart{
+			ID:             part.name,
+			Type:           "File",
+			Name:           part.name,
+			EncodingFormat: "application/zip",
+			ContentSize:    strconv.FormatInt(sizes[idx], 10),
+			HasPart:        contents,
+		})
+	}
+	crate["@graph"] = graph
+	return json.MarshalIndent(crate, "", " ")
+}
+
+// packageCrate bundles the crate into numbered zip parts within the
+// given limits alongside a top-level ro-crate-metadata.json, returning
+// the files to upload.
+func packageCrate(metaJSON metaJSON, crateDir string, limits packageLimits) (depositFiles, error) {
+	packageDir := fmt.Sprintf("%s-package", crateDir)
+	upload := depositFiles{dir: packageDir}
+	parts, err := planParts(metaJSON, crateDir, limits)
+	if err != nil {
+		return upload, err
+	}
+	if err := checkRecordLimits(parts, limits); err != nil {
+		return upload, err
+	}
+	// parts left by an earlier run, e.g. with a different part size,
+	// must not be uploaded.
+	if err := os.RemoveAll(packageDir); err != nil {
+		return upload, fmt.Errorf("error clearing package directory: %w (%s)", err, packageDir)
+	}
+	if err := os.MkdirAll(packageDir, 0755); err != nil {
+		return upload, fmt.Errorf("error creating package directory: %w (%s)", err, packageDir)
+	}
+	sizes := []int64{}
+	for _, part := range parts {
+		size, err := writePart(crateDir, packageDir, part)
+		if err != nil {
+			return upload, err
+		}
+		sizes = append(sizes, size)
+		upload.files = append(upload.files, part.name)
+	}
+	data, err := packageMetadata(crateDir, parts, sizes)
+	if err != nil {
+		return upload, err
+	}
+	if err := os.WriteFile(filepath.Join(packageDir, crateName), append(data, '\n'), 0644); err != nil {
+		return upload, fmt.Errorf("error writing package metadata: %w", err)
+	}
+	upload.files = append(upload.files, crateName)
+	preview, err := renderPreview(data, previewTemplate)
+	if err != nil {
+		return upload, err
+	}
+	if err := os.WriteFile(filepath.Join(packageDir, previewName), preview, 0644); err != nil {
+		return upload, fmt.Errorf("error writing package preview: %w", err)
+	}
+	upload.files = append(upload.files, previewName)
+	return upload, nil
+}
+
+// packageLimitsFromFlags returns the packaging limits configured by
+// the user.
+func packageLimitsFromFlags() (packageLimits, error) {
+	limits := packageLimits{partFiles: partFiles, maxFiles: maxFiles}
+	var err error
+	if limits.partSize, err = parseSize(partSize); err != nil {
+		return limits, err
+	}
+	if limits.maxSize, err = parseSize(maxSize); err != nil {
+		return limits, err
+	}
+	return limits, nil
+}
+
+// packageStage runs packaging for makeCrate, returning the files that
+// should be deposited.
+func packageStage(metaJSON metaJSON, crateDir string, dryrun bool) depositFiles {
+	upload := crateFiles(metaJSON, crateDir)
+	limits, err := packageLimitsFromFlags()
+	if err != nil {
+		log.Println("cannot package crate:", err)
+		os.Exit(1)
+	}
+	if dryrun {
+		log.Println("dry-run: not packaging crate")
+		return upload
+	}
+	upload, err = packageCrate(metaJSON, crateDir, limits)
+	if err != nil {
+		log.Println("cannot package crate:", err)
+		os.Exit(1)
+	}
+	log.Printf("packaged crate into %d parts: %s", len(upload.files)-len(metadataFiles(upload.dir)), upload.dir)
+	return upload
+}
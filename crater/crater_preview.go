@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// previewName is the name of the HTML preview within the crate.
+const previewName string = "ro-crate-preview.html"
+
+// previewTemplates holds the default preview template.
+//
+//go:embed templates/ro-crate-preview.html.tmpl
+var previewTemplates embed.FS
+
+// defaultPreview is the path of the default template in previewTemplates.
+const defaultPreview string = "templates/ro-crate-preview.html.tmpl"
+
+// previewData is given to the preview template. Root, Publishers,
+// Records and Files are taken from Graph for convenience, custom
+// templates can work with the graph directly. Records are the
+// entities the root dataset mentions.
+type previewData struct {
+	JSON       any
+	Graph      []map[string]any
+	Root       map[string]any
+	Publishers []map[string]any
+	Records    []map[string]any
+	Files      []map[string]any
+
+	entities map[string]map[string]any
+}
+
+// hasType reports whether an entity has the given @type.
+func hasType(entity map[string]any, entityType string) bool {
+	switch value := entity["@type"].(type) {
+	case string:
+		return value == entityType
+	case []any:
+		for _, item := range value {
+			if item == entityType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// previewFuncs returns the functions available to preview templates
+// for a graph.
+func previewFuncs(entities map[string]map[string]any) template.FuncMap {
+	refs := func(value any) []map[string]any {
+		resolved := []map[string]any{}
+		var add func(value any)
+		add = func(value any) {
+			switch value := value.(type) {
+			case []any:
+				for _, item := range value {
+					add(item)
+				}
+			case map[string]any:
+				id, _ := value["@id"].(string)
+				if entity, ok := entities[id]; ok {
+					resolved = append(resolved, entity)
+					return
+				}
+				resolved = append(resolved, value)
+			case string:
+				if entity, ok := entities[value]; ok {
+					resolved = append(resolved, entity)
+					return
+				}
+				resolved = append(resolved, map[string]any{"@id": value})
+			}
+		}
+		add(value)
+		return resolved
+	}
+	text := func(value any) string {
+		switch value := value.(type) {
+		case nil:
+			return ""
+		case []any:
+			items := []string{}
+			for _, item := range value {
+				items = append(items, fmt.Sprint(item))
+			}
+			return strings.Join(items, ", ")
+		}
+		return fmt.Sprint(value)
+	}
+	return template.FuncMap{
+		// entity returns the entity with the given @id.
+		"entity": func(id string) map[string]any {
+			return entities[id]
+		},
+		// refs resolves a property's value to the entities it
+		// points at.
+		"refs": refs,
+		// text renders a property's value as text.
+		"text": text,
+		// label returns the name of an entity or its @id.
+		"label": func(entity map[string]any) string {
+			if name := text(entity["name"]); name != "" {
+				return name
+			}
+			return text(entity["@id"])
+		},
+		// isURL reports whether an @id is an absolute URL.
+		"isURL": func(id any) bool {
+			value := text(id)
+			return strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://")
+		},
+		// anchor returns the fragment of a local @id, e.g. #abc.
+		"anchor": func(id any) string {
+			return strings.TrimPrefix(text(id), "#")
+		},
+	}
+}
+
+// makePreviewData arranges the crate's graph for the preview template.
+func makePreviewData(crate map[string]any) previewData {
+	data := previewData{JSON: crate, Root: map[string]any{}}
+	graph, _ := crate["@graph"].([]any)
+	for _, item := range graph {
+		entity, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		data.Graph = append(data.Graph, entity)
+	}
+	data.entities = map[string]map[string]any{}
+	for _, entity := range data.Graph {
+		if id, ok := entity["@id"].(string); ok {
+			data.entities[id] = entity
+		}
+	}
+	if root, ok := data.entities["./"]; ok {
+		data.Root = root
+	}
+	publishers, _ := data.Root["publisher"].([]any)
+	for _, pub := range publishers {
+		pub, _ := pub.(map[string]any)
+		id, _ := pub["@id"].(string)
+		if entity, ok := data.entities[id]; ok {
+			data.Publishers = append(data.Publishers, entity)
+		}
+	}
+	mentions, _ := data.Root["mentions"].([]any)
+	for _, mention := range mentions {
+		mention, _ := mention.(map[string]any)
+		id, _ := mention["@id"].(string)
+		if entity, ok := data.entities[id]; ok && hasType(entity, recordType) {
+			data.Records = append(data.Records, entity)
+		}
+	}
+	for _, entity := range data.Graph {
+		if hasType(entity, "File") {
+			data.Files = append(data.Files, entity)
+		}
+	}
+	return data
+}
+
+// renderPreview renders the HTML preview of a crate using the default
+// template or, if a path is given, a custom one.
+func renderPreview(crateJSON []byte, templatePath string) ([]byte, error) {
+	var crate map[string]any
+	if err := json.Unmarshal(crateJSON, &crate); err != nil {
+		return nil, fmt.Errorf("error parsing crate metadata: %w", err)
+	}
+	data := makePreviewData(crate)
+	content, err := previewTemplates.ReadFile(defaultPreview)
+	if templatePath != "" {
+		content, err = os.ReadFile(templatePath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading preview template: %w", err)
+	}
+	tmpl, err := template.New(previewName).Funcs(previewFuncs(data.entities)).Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing preview template: %w", err)
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return nil, fmt.Errorf("error rendering preview: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// metadataFiles returns the RO-CRATE metadata and, if it has been
+// written, the preview of the crate.
+func metadataFiles(crateDir string) []string {
+	files := []string{crateName}
+	if _, err := os.Stat(filepath.Join(crateDir, previewName)); err == nil {
+		files = append(files, previewName)
+	}
+	return files
+}
+
+// previewCrate writes ro-crate-preview.html to the crate.
+func previewCrate(crateDir string, crateJSON []byte) {
+	out, err := renderPreview(crateJSON, previewTemplate)
+	if err != nil {
+		log.Println("cannot create crate preview:", err)
+		os.Exit(1)
+	}
+	previewPath := filepath.Join(crateDir, previewName)
+	if err := os.WriteFile(previewPath, out, 0644); err != nil {
+		log.Println("cannot write crate preview:", err)
+		os.Exit(1)
+	}
+	log.Println("preview path:", previewPath)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/ross-spencer/zenodocfl/internal/provenance"
+)
+
+// craterApp is the name crater records its runs with.
+const craterApp string = "INK-crater"
+
+// softwareID returns the identifier of the SoftwareApplication entity
+// describing a version of an app.
+func softwareID(run provenance.Run) string {
+	return fmt.Sprintf("#%s-%s", run.App, run.Version)
+}
+
+// actionID returns the identifier of the CreateAction entity
+// describing a run.
+func actionID(run provenance.Run) string {
+	return fmt.Sprintf("#%s-run-%s", run.App, run.StartTime)
+}
+
+// workflowFileID returns the identifier of a file read or written by
+// a run. The files are not part of the crate, e.g. a lister manifest,
+// so they are given local identifiers.
+func workflowFileID(name string) string {
+	return fmt.Sprintf("#file:%s", name)
+}
+
+// makeProvenance describes the runs that produced the crate, ending
+// with the crater build, as CreateAction entities. The apps and the
+// files passed between them are returned as contextual entities, each
+// described once.
+func makeProvenance(runs []provenance.Run, build provenance.Run) ([]createAction, []interface{}) {
+	actions := []createAction{}
+	entities := []interface{}{}
+	seen := []string{}
+	for _, run := range slices.Concat(runs, []provenance.Run{build}) {
+		action := createAction{
+			ID:        actionID(run),
+			Type:      "CreateAction",
+			Name:      fmt.Sprintf("%s run", run.App),
+			StartTime: run.StartTime,
+			EndTime:   run.EndTime,
+			Agent:     idPointer{softwareID(run)},
+			URL:       run.Url,
+		}
+		if !slices.Contains(seen, action.Agent.ID) {
+			seen = append(seen, action.Agent.ID)
+			entities = append(entities, softwareApplication{
+				ID:         action.Agent.ID,
+				Type:       "SoftwareApplication",
+				Name:       run.App,
+				Version:    run.Version,
+				Identifier: run.Commit,
+			})
+		}
+		for _, name := range slices.Concat(run.Inputs, run.Outputs) {
+			id := workflowFileID(name)
+			if slices.Contains(run.Inputs, name) {
+				action.Object = append(action.Object, idPointer{id})
+			} else {
+				action.Result = append(action.Result, idPointer{id})
+			}
+			if slices.Contains(seen, id) {
+				continue
+			}
+			seen = append(seen, id)
+			entities = append(entities, workflowFile{ID: id, Type: creativeWork, Name: name})
+		}
+		actions = append(actions, action)
+	}
+	actions[len(actions)-1].Result = []idPointer{{"./"}}
+	return actions, entities
+}
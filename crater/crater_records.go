@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/ross-spencer/zenodocfl/internal/types"
+)
+
+// recordType is the type given to the entity describing each record.
+const recordType string = "CreativeWork"
+
+// recordID returns the identifier of the entity describing a record
+// using its INK signature or, failing that, its file name.
+func recordID(item types.Item) string {
+	if item.Signature != "" {
+		return fmt.Sprintf("#%s", item.Signature)
+	}
+	return fmt.Sprintf("#%s", strings.TrimSuffix(path.Base(item.File), path.Ext(item.File)))
+}
+
+// partsByURL returns the crate part downloaded from each URL.
+func partsByURL(sources map[string]fileSource) map[string]string {
+	parts := map[string]string{}
+	for part, source := range sources {
+		if source.url != "" {
+			parts[source.url] = part
+		}
+	}
+	return parts
+}
+
+// pointer returns a pointer to an entity or nil if the id is empty.
+func pointer(id string) *idPointer {
+	if id == "" {
+		return nil
+	}
+	return &idPointer{id}
+}
+
+// nonAlphanumeric matches the characters replaced in person slugs.
+var nonAlphanumeric = regexp.MustCompile(`[^a-z0-9]+`)
+
+// propertyValueID returns the identifier of the entity describing a
+// persistent identifier, e.g. #ark:/15737/p657-67kd-93sh or
+// #handle:20.500.11806/med/3hjc-05sv-4w.
+func propertyValueID(id types.Identifier) string {
+	scheme := strings.ToLower(id.Type)
+	if strings.HasPrefix(strings.ToLower(id.Name), scheme+":") {
+		return fmt.Sprintf("#%s", id.Name)
+	}
+	return fmt.Sprintf("#%s:%s", scheme, id.Name)
+}
+
+// makePropertyValues returns a PropertyValue entity for every
+// persistent identifier of the records in the collection.
+func makePropertyValues(items []types.Item) []propertyValue {
+	values := []propertyValue{}
+	seen := map[string]bool{}
+	for _, item := range items {
+		for _, id := range item.Identifiers {
+			entityID := propertyValueID(id)
+			if seen[entityID] {
+				continue
+			}
+			seen[entityID] = true
+			values = append(values, propertyValue{
+				ID:         entityID,
+				Type:       "PropertyValue",
+				PropertyID: id.Type,
+				Value:      id.Name,
+				URL:        id.Url,
+			})
+		}
+	}
+	return values
+}
+
+// personKey returns the key persons are deduplicated by.
+func personKey(name string) string {
+	return strings.Trim(nonAlphanumeric.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// makePersonEntities returns a deduplicated Person entity for every
+// person in the collection and the identifier of each entity by
+// person key. A person is identified by the first identifier URL
+// found for them in any record.
+func makePersonEntities(items []types.Item) ([]personEntity, map[string]string) {
+	persons := []personEntity{}
+	index := map[string]int{}
+	for _, item := range items {
+		for _, person := range item.Persons {
+			key := personKey(person.Name)
+			if key == "" {
+				continue
+			}
+			idx, ok := index[key]
+			if !ok {
+				entity := personEntity{Type: "Person", Name: person.Name}
+				family, given, found := strings.Cut(person.Name, ",")
+				if found {
+					entity.FamilyName = strings.TrimSpace(family)
+					entity.GivenName = strings.TrimSpace(given)
+				}
+				persons = append(persons, entity)
+				idx = len(persons) - 1
+				index[key] = idx
+			}
+			for _, id := range person.Identifiers {
+				value := id.Url
+				if value == "" {
+					value = id.Name
+				}
+				if !slices.Contains(persons[idx].Identifier, value) {
+					persons[idx].Identifier = append(persons[idx].Identifier, value)
+				}
+				if persons[idx].ID == "" && id.Url != "" {
+					persons[idx].ID = id.Url
+				}
+			}
+		}
+	}
+	ids := map[string]string{}
+	for key, idx := range index {
+		if persons[idx].ID == "" {
+			persons[idx].ID = fmt.Sprintf("#person-%s", key)
+		}
+		ids[key] = persons[idx].ID
+	}
+	return persons, ids
+}
+
+// linkPersons links a record to the persons associated with it using
+// the property appropriate to each person's role. Roles other than
+// composer and author are linked as contributors.
+func linkPersons(record *recordEntity, persons []types.Person, ids map[string]string) {
+	for _, person := range persons {
+		id, ok := ids[personKey(person.Name)]
+		if !ok {
+			continue
+		}
+		var links *[]idPointer
+		switch strings.ToLower(strings.TrimSpace(person.Role)) {
+		case "composer":
+			links = &record.Composer
+		case "author":
+			links = &record.Author
+		default:
+			links = &record.Contributor
+		}
+		if !slices.Contains(*links, idPointer{id}) {
+			*links = append(*links, idPointer{id})
+		}
+	}
+}
+
+// relation returns the links of a record that a related record is
+// added to. INK doesn't type its relationships so the property follows
+// from the types of the records: a work, e.g. a motet, isPartOf the
+// collections it is related to, a collection, e.g. a cycle, which has
+// no type, hasPart the works related to it and any other relationship
+// is a citation.
+func relation(record *recordEntity, item types.Item, rel types.Relationship) *[]idPointer {
+	switch {
+	case item.Type != "" && rel.Type == "":
+		return &record.IsPartOf
+	case item.Type == "" && rel.Type != "":
+		return &record.HasPart
+	}
+	return &record.Citation
+}
+
+// makeRecordEntities returns an entity for every record in the
+// collection linked to its record file, media, poster and related
+// records. Related records that aren't part of the collection are
+// described by their URL.
+func makeRecordEntities(items []types.Item, recordParts []string, sources map[string]fileSource, persons map[string]string) []recordEntity {
+	downloads := partsByURL(sources)
+	bySignature := map[string]string{}
+	byURL := map[string]string{}
+	for _, item := range items {
+		if item.Signature != "" {
+			bySignature[item.Signature] = recordID(item)
+		}
+		if item.Url != "" {
+			byURL[item.Url] = recordID(item)
+		}
+	}
+	records := []recordEntity{}
+	external := []recordEntity{}
+	seen := map[string]bool{}
+	for idx, item := range items {
+		record := recordEntity{
+			ID:          recordID(item),
+			Type:        recordType,
+			Name:        item.Label,
+			Description: item.Description,
+			Publisher:   item.Publisher,
+			URL:         item.Url,
+			Image:       pointer(downloads[item.Poster.Url]),
+		}
+		if idx < len(recordParts) {
+			record.SubjectOf = pointer(recordParts[idx])
+		}
+		for _, id := range item.Identifiers {
+			record.Identifier = append(record.Identifier, idPointer{propertyValueID(id)})
+			if id.Url != "" {
+				record.SameAs = append(record.SameAs, idPointer{id.Url})
+			}
+		}
+		linkPersons(&record, item.Persons, persons)
+		for _, med := range item.Media {
+			if part, ok := downloads[med.Url]; ok {
+				record.HasPart = append(record.HasPart, idPointer{part})
+			}
+		}
+		for _, rel := range item.Relationship {
+			target, internal := bySignature[rel.Signature]
+			if !internal {
+				target, internal = byURL[rel.Url]
+			}
+			if !internal {
+				target = rel.Url
+			}
+			if target == "" {
+				continue
+			}
+			links := relation(&record, item, rel)
+			*links = append(*links, idPointer{target})
+			if internal || seen[target] {
+				continue
+			}
+			seen[target] = true
+			external = append(external, recordEntity{
+				ID:    target,
+				Type:  recordType,
+				Name:  rel.Label,
+				Image: pointer(downloads[rel.Poster.Url]),
+			})
+		}
+		records = append(records, record)
+	}
+	return append(records, external...)
+}
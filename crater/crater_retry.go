@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ross-spencer/zenodocfl/internal/types"
+)
+
+// describeFailures records the name of each failed download and the
+// records that link to it so that it can be added to the crate when
+// it is retried.
+func describeFailures(collection types.Collection, failures []failedDownload) {
+	jobs := []downloadJob{}
+	for _, failure := range failures {
+		jobs = append(jobs, downloadJob{url: failure.URL, part: failure.Part})
+	}
+	sources := collectionSources(collection, nil, jobs)
+	records := makeRecordEntities(collection.Items, nil, sources, nil)
+	for idx := range failures {
+		part := failures[idx].Part
+		failures[idx].Name = sources[part].name
+		for _, record := range records {
+			image := record.Image != nil && record.Image.ID == part
+			if image || slices.Contains(record.HasPart, idPointer{part}) {
+				failures[idx].Records = append(failures[idx].Records, record.ID)
+			}
+		}
+	}
+}
+
+// addRef adds a reference to an entity's property if it isn't already
+// there.
+func addRef(entity map[string]any, property string, id string) {
+	values, _ := entity[property].([]any)
+	if single, ok := entity[property].(map[string]any); ok {
+		values = []any{single}
+	}
+	for _, value := range values {
+		if value, ok := value.(map[string]any); ok && value["@id"] == id {
+			return
+		}
+	}
+	entity[property] = append(values, map[string]any{"@id": id})
+}
+
+// addRetried adds the downloads that succeeded when retried to the
+// crate's metadata, linking them from the root dataset and the records
+// that use them, and to the crate's url map.
+func addRetried(crateDir string, retried []failedDownload) ([]byte, error) {
+	metadataPath := filepath.Join(crateDir, crateName)
+	data, err := os.ReadFile(metadataPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading crate metadata: %w", err)
+	}
+	var crate map[string]any
+	if err := json.Unmarshal(data, &crate); err != nil {
+		return nil, fmt.Errorf("error parsing crate metadata: %w", err)
+	}
+	graph, _ := crate["@graph"].([]any)
+	entities := map[string]map[string]any{}
+	for _, entity := range graph {
+		if entity, ok := entity.(map[string]any); ok {
+			id, _ := entity["@id"].(string)
+			entities[id] = entity
+		}
+	}
+	for _, download := range retried {
+		mimeType := download.Format
+		if strings.Contains(mimeType, "*") {
+			mimeType = ""
+		}
+		file, err := makeFileEntity(crateDir, download.Part, fileSource{url: download.URL, name: download.Name, mimeType: mimeType})
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(file)
+		if err != nil {
+			return nil, fmt.Errorf("error describing file: %w (%s)", err, download.Part)
+		}
+		var entity map[string]any
+		json.Unmarshal(data, &entity)
+		// a stale copy kept by an update is replaced.
+		if _, ok := entities[download.Part]; ok {
+			idx := slices.IndexFunc(graph, func(item any) bool {
+				existing, ok := item.(map[string]any)
+				return ok && existing["@id"] == download.Part
+			})
+			graph[idx] = entity
+		} else {
+			graph = append(graph, entity)
+		}
+		entities[download.Part] = entity
+		if root, ok := entities["./"]; ok {
+			addRef(root, "hasPart", download.Part)
+		}
+		for _, id := range download.Records {
+			record, ok := entities[id]
+			if !ok {
+				continue
+			}
+			if download.Format == posterFormat {
+				record["image"] = map[string]any{"@id": download.Part}
+				continue
+			}
+			addRef(record, "hasPart", download.Part)
+		}
+	}
+	crate["@graph"] = graph
+	data, err = json.MarshalIndent(crate, "", " ")
+	if err != nil {
+		return nil, fmt.Errorf("error writing crate metadata: %w", err)
+	}
+	return data, appendURLMap(crateDir, retried)
+}
+
+// appendURLMap adds the retried downloads to the crate's url map.
+func appendURLMap(crateDir string, retried []failedDownload) error {
+	mapPath := filepath.Join(crateDir, urlMapName)
+	out, err := os.OpenFile(mapPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening url map: %w (%s)", err, mapPath)
+	}
+	defer out.Close()
+	writer := csv.NewWriter(out)
+	for _, download := range retried {
+		writer.Write([]string{download.URL, download.Part})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing url map: %w (%s)", err, mapPath)
+	}
+	return nil
+}
+
+// retryFailedCrate retries only the downloads listed in a crate's
+// failed.jsonl. Those that succeed are added to the crate and the list
+// is rewritten with those that still fail. Whether the crate is now
+// complete is returned.
+func retryFailedCrate(failedPath string, dryrun bool) bool {
+	crateDir := filepath.Dir(failedPath)
+	failures, err := readFailed(failedPath)
+	if err != nil {
+		log.Println("cannot retry failed downloads:", err)
+		os.Exit(1)
+	}
+	log.Printf("retrying %d failed downloads: %s", len(failures), failedPath)
+	if dryrun {
+		log.Println("dry-run: not retrying downloads")
+		return false
+	}
+	dl := newDownloader(workers, hostRate, retries)
+	dl.formats = map[string]string{}
+	dl.quarantine = quarantineDir(crateDir)
+	jobs := []downloadJob{}
+	for _, failure := range failures {
+		dl.formats[failure.URL] = failure.Format
+		jobs = append(jobs, downloadJob{
+			url:  failure.URL,
+			path: filepath.Join(crateDir, filepath.FromSlash(failure.Part)),
+			part: failure.Part,
+		})
+	}
+	retried := []failedDownload{}
+	remaining := []failedDownload{}
+	for idx, err := range dl.download(jobs) {
+		if err != nil {
+			log.Printf("cannot download object: %s", err)
+			failures[idx].Error = err.Error()
+			remaining = append(remaining, failures[idx])
+			continue
+		}
+		retried = append(retried, failures[idx])
+	}
+	data, err := addRetried(crateDir, retried)
+	if err != nil {
+		log.Println("cannot add retried downloads to crate:", err)
+		os.Exit(1)
+	}
+	createCrateObj(filepath.Join(crateDir, crateName), string(data))
+	previewCrate(crateDir, data)
+	log.Printf("retried downloads: %d succeeded, %d failed", len(retried), len(remaining))
+	if !failedStage(crateDir, remaining) {
+		return false
+	}
+	log.Println("crate complete:", crateDir)
+	return true
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// rocrateSpec describes a version of the RO-Crate specification.
+type rocrateSpec struct {
+	context    string
+	conformsTo string
+	// profileType is the @type given to Profile contextual entities.
+	profileType []string
+	// descriptorIdentifier records whether the metadata descriptor is
+	// given an identifier, kept for 1.1 so that existing crates are
+	// reproduced exactly.
+	descriptorIdentifier bool
+}
+
+// defaultRocrate is the version of RO-Crate written by default.
+const defaultRocrate string = "1.1"
+
+// rocrateVersions are the versions of RO-Crate crater can write.
+var rocrateVersions = map[string]rocrateSpec{
+	"1.1": {
+		context:              rocrateContext,
+		conformsTo:           rocrateConform,
+		profileType:          []string{creativeWork},
+		descriptorIdentifier: true,
+	},
+	"1.2": {
+		context:     "https://w3id.org/ro/crate/1.2/context",
+		conformsTo:  "https://w3id.org/ro/crate/1.2",
+		profileType: []string{creativeWork, "Profile"},
+	},
+}
+
+// rocrateVersion returns the specification for a version of RO-Crate,
+// an empty version selects the default.
+func rocrateVersion(version string) (rocrateSpec, error) {
+	if version == "" {
+		version = defaultRocrate
+	}
+	spec, ok := rocrateVersions[version]
+	if !ok {
+		versions := []string{}
+		for key := range rocrateVersions {
+			versions = append(versions, key)
+		}
+		slices.Sort(versions)
+		return spec, fmt.Errorf("unsupported RO-Crate version: '%s' (supported: %s)", version, strings.Join(versions, ", "))
+	}
+	return spec, nil
+}
+
+// profile describes a profile the crate conforms to.
+type profile struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// makeProfiles returns the Profile contextual entities of a crate and
+// the pointers used in the root dataset's conformsTo. Profiles given
+// more than once are described once.
+func makeProfiles(spec rocrateSpec, profiles []profile) ([]idPointer, []profileEntity) {
+	ids := []idPointer{}
+	entities := []profileEntity{}
+	for _, prof := range profiles {
+		id := strings.TrimSpace(prof.ID)
+		if id == "" || slices.Contains(ids, idPointer{id}) {
+			continue
+		}
+		ids = append(ids, idPointer{id})
+		entities = append(entities, profileEntity{
+			ID:      id,
+			Type:    spec.profileType,
+			Name:    prof.Name,
+			Version: prof.Version,
+		})
+	}
+	return ids, entities
+}
+
+// parseProfiles converts a comma separated list of profile URIs given
+// on the command line into profiles.
+func parseProfiles(values string) []profile {
+	profiles := []profile{}
+	for _, value := range strings.Split(values, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		profiles = append(profiles, profile{ID: value})
+	}
+	return profiles
+}
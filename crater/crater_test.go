@@ -0,0 +1,1477 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ross-spencer/zenodocfl/internal/ocfl"
+	"github.com/ross-spencer/zenodocfl/internal/provenance"
+	ro "github.com/ross-spencer/zenodocfl/internal/rocrate"
+	"github.com/ross-spencer/zenodocfl/internal/types"
+	"github.com/ross-spencer/zenodocfl/internal/zenodo"
+	"github.com/ross-spencer/zenodocfl/internal/zenodo/zenodotest"
+)
+
+var testMeta = metaJSON{
+	IDPrefix:    "FHNW",
+	Description: "The Motet Cycles project.",
+	Name:        "Motet Cycles",
+	RecordType:  "Dataset",
+	License:     "https://creativecommons.org/publicdomain/zero/1.0/",
+	Keywords:    "renaissance, music, motet",
+	Publisher: []publisher{
+		{
+			PublisherIdentifier: "https://ror.org/04mq2g308",
+			PublisherName:       "FHNW University of Applied Sciences and Arts",
+		},
+	},
+	Url: "https://ink.sammlung.cc/detail/motetcycles-research/",
+}
+
+// makeTestCrateDir creates a small crate on disk returning its
+// directory and the metadata describing it.
+func makeTestCrateDir(t *testing.T) (string, metaJSON) {
+	t.Helper()
+	crateDir := t.TempDir()
+	files := map[string]string{
+		"ro-crate-metadata.json":       "{}\n",
+		"records/motetcycle-0955.json": "{\"a\": 1}\n",
+		"media/M001.xml":               "<mei/>\n",
+	}
+	for name, content := range files {
+		filePath := filepath.Join(crateDir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(filePath), 0755)
+		os.WriteFile(filePath, []byte(content), 0644)
+	}
+	meta := testMeta
+	meta.parts = []string{"records/motetcycle-0955.json", "media/M001.xml"}
+	return crateDir, meta
+}
+
+// TestDepositCrate ensures every crate part is uploaded to Zenodo and
+// the deposition is described and published.
+func TestDepositCrate(t *testing.T) {
+	server := zenodotest.NewServer("token")
+	defer server.Close()
+	crateDir, meta := makeTestCrateDir(t)
+	client := zenodo.NewClient(server.URL, "token")
+	metadata, _ := zenodoCrosswalk(meta, nil)
+	dep, err := depositCrate(client, metadata, crateFiles(meta, crateDir), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dep.Submitted {
+		t.Errorf("deposition should be published")
+	}
+	uploads := server.Uploads[filepath.Base(dep.Links.Bucket)]
+	for _, key := range []string{"ro-crate-metadata.json", "records_motetcycle-0955.json", "media_M001.xml"} {
+		if _, ok := uploads[key]; !ok {
+			t.Errorf("crate part not uploaded: %s", key)
+		}
+	}
+	if dep.Metadata.Title != meta.Name || len(dep.Metadata.Creators) != 1 {
+		t.Errorf("deposition metadata not set: %+v", dep.Metadata)
+	}
+}
+
+// TestUpdateCrate ensures a regenerated crate is published as a new
+// version of the existing record and that only changed parts are
+// uploaded.
+func TestUpdateCrate(t *testing.T) {
+	server := zenodotest.NewServer("token")
+	defer server.Close()
+	crateDir, meta := makeTestCrateDir(t)
+	client := zenodo.NewClient(server.URL, "token")
+	metadata, _ := zenodoCrosswalk(meta, nil)
+	first, err := depositCrate(client, metadata, crateFiles(meta, crateDir), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statePath := zenodoStatePath(crateDir, meta)
+	if err := writeZenodoState(statePath, server.URL, first); err != nil {
+		t.Fatal(err)
+	}
+	state, err := readZenodoState(statePath)
+	if err != nil || state.DepositionID != first.ID || state.ConceptDOI != first.ConceptDOI {
+		t.Fatalf("state not recorded: %+v (%v)", state, err)
+	}
+
+	// change one part, remove another and add a new one.
+	os.WriteFile(filepath.Join(crateDir, "records", "motetcycle-0955.json"), []byte("{\"a\": 2}\n"), 0644)
+	os.WriteFile(filepath.Join(crateDir, "media", "M002.xml"), []byte("<mei>2</mei>\n"), 0644)
+	meta.parts = []string{"records/motetcycle-0955.json", "media/M002.xml"}
+
+	second, err := updateCrate(client, state, metadata, crateFiles(meta, crateDir), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.ID == first.ID || second.ConceptDOI != first.ConceptDOI || second.DOI == first.DOI {
+		t.Errorf("expected a new version of the same concept: %+v", second)
+	}
+	names := []string{}
+	for _, file := range second.Files {
+		names = append(names, file.Name())
+	}
+	slices.Sort(names)
+	expected := []string{"media_M002.xml", "records_motetcycle-0955.json", "ro-crate-metadata.json"}
+	if !slices.Equal(names, expected) {
+		t.Errorf("new version files incorrect: %v expected: %v", names, expected)
+	}
+	uploads := server.Uploads[filepath.Base(second.Links.Bucket)]
+	if string(uploads["records_motetcycle-0955.json"]) != "{\"a\": 2}\n" {
+		t.Errorf("changed part not uploaded: %s", uploads["records_motetcycle-0955.json"])
+	}
+}
+
+var licenseTests = []struct {
+	url      string
+	expected string
+}{
+	{"https://creativecommons.org/publicdomain/zero/1.0/", "cc0-1.0"},
+	{"https://creativecommons.org/licenses/by/4.0/", "cc-by-4.0"},
+	{"http://creativecommons.org/licenses/by-nc-sa/4.0/deed.de", "cc-by-nc-sa-4.0"},
+	{"https://opensource.org/licenses/MIT", "mit"},
+	{"cc-by-4.0", "cc-by-4.0"},
+}
+
+// TestLicenseID ensures license URLs are mapped to Zenodo licenses.
+func TestLicenseID(t *testing.T) {
+	for _, test := range licenseTests {
+		res, err := licenseID(test.url)
+		if err != nil || res != test.expected {
+			t.Errorf("license not mapped: '%s' expected: '%s' (%v)", res, test.expected, err)
+		}
+	}
+	if _, err := licenseID("https://example.com/license"); err == nil {
+		t.Errorf("unknown license URL should return an error")
+	}
+}
+
+// TestZenodoCrosswalk ensures the crate metadata and items are mapped
+// to Zenodo metadata and that problems name the offending field.
+func TestZenodoCrosswalk(t *testing.T) {
+	items := []types.Item{
+		{
+			Label: "M001 Beata progenies",
+			Identifiers: []types.Identifier{
+				{Type: "ark", Name: "ark:/15737/p657-67kd-93sh", Url: "https://n2t.net/ark:/15737/p657-67kd-93sh"},
+				{Type: "handle", Name: "20.500.11806/med/3hjc-05sv-4w", Url: "https://hdl.handle.net/20.500.11806/med/3hjc-05sv-4w"},
+			},
+		},
+	}
+	metadata, problems := zenodoCrosswalk(testMeta, items)
+	if len(problems) > 0 {
+		t.Fatalf("unexpected problems: %v", problems)
+	}
+	if metadata.UploadType != "dataset" || metadata.License != "cc0-1.0" {
+		t.Errorf("upload type or license incorrect: %s %s", metadata.UploadType, metadata.License)
+	}
+	if len(metadata.Keywords) != 3 || len(metadata.Creators) != 1 {
+		t.Errorf("keywords or creators incorrect: %v %v", metadata.Keywords, metadata.Creators)
+	}
+	if len(metadata.RelatedIdentifiers) != 3 {
+		t.Fatalf("related identifiers incorrect: %+v", metadata.RelatedIdentifiers)
+	}
+	ark := metadata.RelatedIdentifiers[1]
+	if ark.Scheme != "ark" || ark.Relation != "hasPart" || ark.Identifier != "ark:/15737/p657-67kd-93sh" {
+		t.Errorf("ark not mapped: %+v", ark)
+	}
+
+	items[0].Persons = []types.Person{
+		{Name: "Gaffurius, Franchinus", Role: "Composer"},
+		{Name: "Cassia, Cristina", Role: "editor", Identifiers: []types.Identifier{
+			{Type: "orcid", Url: "https://orcid.org/0000-0002-1825-0097"},
+		}},
+	}
+	items = append(items, types.Item{Persons: []types.Person{
+		{Name: "Gaffurius, Franchinus", Role: "composer"},
+		{Name: "Cassia, Cristina", Role: "author"},
+	}})
+	metadata, _ = zenodoCrosswalk(testMeta, items)
+	creators := []zenodo.Creator{
+		{Name: "Gaffurius, Franchinus"},
+		{Name: "Cassia, Cristina", ORCID: "0000-0002-1825-0097"},
+	}
+	if !slices.Equal(metadata.Creators, creators) {
+		t.Errorf("composers and authors should be the creators: %+v", metadata.Creators)
+	}
+
+	invalid := testMeta
+	invalid.RecordType = "Motet"
+	invalid.License = "https://example.com/license"
+	invalid.Publisher = nil
+	_, problems = zenodoCrosswalk(invalid, nil)
+	fields := []string{}
+	for _, problem := range problems {
+		fields = append(fields, problem.Field)
+	}
+	for _, field := range []string{"meta.type", "meta.license", "metadata.upload_type", "metadata.creators"} {
+		if !slices.Contains(fields, field) {
+			t.Errorf("problem not reported for field: %s (%v)", field, fields)
+		}
+	}
+}
+
+var sizeTests = []struct {
+	size     string
+	expected int64
+}{
+	{"2GB", 2000000000},
+	{"1.5 MB", 1500000},
+	{"50gb", 50000000000},
+	{"300", 300},
+	{"10B", 10},
+}
+
+// TestParseSize ensures sizes with units are converted to bytes.
+func TestParseSize(t *testing.T) {
+	for _, test := range sizeTests {
+		res, err := parseSize(test.size)
+		if err != nil || res != test.expected {
+			t.Errorf("size not parsed: '%s' %d expected: %d (%v)", test.size, res, test.expected, err)
+		}
+	}
+	if _, err := parseSize("lots"); err == nil {
+		t.Errorf("invalid size should return an error")
+	}
+}
+
+// TestPackageCrate ensures a crate is split into zip parts within the
+// part limits and that the top-level metadata describes which files
+// are in which part.
+func TestPackageCrate(t *testing.T) {
+	crateDir, meta := makeTestCrateDir(t)
+	meta.identifier = "FHNW-1234"
+	meta.files, _ = makeFileEntities(crateDir, meta.parts, nil)
+	data, _ := json.Marshal(makeCrateObj(meta))
+	os.WriteFile(filepath.Join(crateDir, crateName), data, 0644)
+
+	upload, err := packageCrate(meta, crateDir, packageLimits{partFiles: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"Motet-Cycles-part-001.zip", "Motet-Cycles-part-002.zip", crateName, previewName}
+	if !slices.Equal(upload.files, expected) {
+		t.Fatalf("package files incorrect: %v expected: %v", upload.files, expected)
+	}
+	archive, err := zip.OpenReader(filepath.Join(upload.dir, expected[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, file := range archive.File {
+		names = append(names, file.Name)
+	}
+	archive.Close()
+	if !slices.Equal(names, []string{crateName, "records/motetcycle-0955.json"}) {
+		t.Errorf("first part contents incorrect: %v", names)
+	}
+
+	data, _ = os.ReadFile(filepath.Join(upload.dir, crateName))
+	var crate struct {
+		Graph []struct {
+			ID      string      `json:"@id"`
+			Type    string      `json:"@type"`
+			HasPart []idPointer `json:"hasPart"`
+		} `json:"@graph"`
+	}
+	if err := json.Unmarshal(data, &crate); err != nil {
+		t.Fatal(err)
+	}
+	parts := map[string][]idPointer{}
+	for _, entity := range crate.Graph {
+		parts[entity.ID] = entity.HasPart
+	}
+	if len(parts["./"]) != 2 || parts["./"][0].ID != expected[0] {
+		t.Errorf("root should point at the zip parts: %v", parts["./"])
+	}
+	if len(parts[expected[1]]) != 1 || parts[expected[1]][0].ID != "#Motet-Cycles-part-002.zip/media/M001.xml" {
+		t.Errorf("second part should describe its contents: %v", parts[expected[1]])
+	}
+	if _, ok := parts["media/M001.xml"]; ok {
+		t.Errorf("files inside the parts should not be described as files of the package")
+	}
+	if report := ro.Validate(upload.dir, ro.Required); !report.Valid() {
+		t.Errorf("package should be a valid crate: %v", report.Issues)
+	}
+
+	// packaging is deterministic.
+	first, _ := os.ReadFile(filepath.Join(upload.dir, expected[0]))
+	if _, err := packageCrate(meta, crateDir, packageLimits{partFiles: 2}); err != nil {
+		t.Fatal(err)
+	}
+	second, _ := os.ReadFile(filepath.Join(upload.dir, expected[0]))
+	if !bytes.Equal(first, second) {
+		t.Errorf("packaging the same crate should produce identical archives")
+	}
+
+	// a rerun with other limits leaves no stale parts behind.
+	if _, err := packageCrate(meta, crateDir, packageLimits{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(upload.dir, expected[1])); !os.IsNotExist(err) {
+		t.Errorf("stale part left in the package directory")
+	}
+
+	if _, err := packageCrate(meta, crateDir, packageLimits{partFiles: 1, maxFiles: 3}); err == nil {
+		t.Errorf("package exceeding the record file limit should return an error")
+	}
+}
+
+// TestDataciteCrosswalk ensures the crate metadata and items are
+// mapped to a valid DataCite resource.
+func TestDataciteCrosswalk(t *testing.T) {
+	items := []types.Item{
+		{
+			Identifiers: []types.Identifier{
+				{Type: "ark", Name: "ark:/15737/p657-67kd-93sh", Url: "https://n2t.net/ark:/15737/p657-67kd-93sh"},
+				{Type: "handle", Name: "20.500.11806/med/3hjc-05sv-4w", Url: "https://hdl.handle.net/20.500.11806/med/3hjc-05sv-4w"},
+			},
+		},
+	}
+	resource := dataciteCrosswalk(testMeta, items, "10.5072/zenodo.1234")
+	if problems := resource.Validate(); len(problems) > 0 {
+		t.Fatalf("unexpected problems: %v", problems)
+	}
+	if resource.ResourceType.General != "Dataset" || len(resource.Subjects) != 3 {
+		t.Errorf("resource type or subjects incorrect: %+v %+v", resource.ResourceType, resource.Subjects)
+	}
+	if resource.Publisher.Identifier != "https://ror.org/04mq2g308" || resource.Publisher.IdentifierScheme != "ROR" {
+		t.Errorf("publisher ROR not mapped: %+v", resource.Publisher)
+	}
+	if len(resource.Creators) != 1 || len(resource.Creators[0].NameIdentifiers) != 1 {
+		t.Errorf("creator ROR not mapped: %+v", resource.Creators)
+	}
+	if len(resource.RightsList) != 1 || resource.RightsList[0].Identifier != "CC0-1.0" {
+		t.Errorf("rights not mapped: %+v", resource.RightsList)
+	}
+	relations := []string{}
+	for _, rel := range resource.RelatedIdentifiers {
+		relations = append(relations, rel.Type+" "+rel.RelationType)
+	}
+	if !slices.Equal(relations, []string{"URL IsDerivedFrom", "ARK HasPart", "Handle HasPart"}) {
+		t.Errorf("related identifiers incorrect: %v", relations)
+	}
+
+	resource = dataciteCrosswalk(testMeta, items, "")
+	problems := resource.Validate()
+	if len(problems) != 1 || problems[0].Field != "identifier" {
+		t.Errorf("only the missing DOI should be reported: %v", problems)
+	}
+}
+
+// TestMakeFileEntities ensures every crate part is described with its
+// size, format, checksum and source.
+func TestMakeFileEntities(t *testing.T) {
+	crateDir, meta := makeTestCrateDir(t)
+	os.MkdirAll(filepath.Join(crateDir, "posters"), 0755)
+	os.WriteFile(filepath.Join(crateDir, "posters", "poster"), []byte("\x89PNG\r\n\x1a\n0000"), 0644)
+	collection := types.Collection{
+		Items: []types.Item{
+			{
+				Label: "M001 Beata progenies",
+				Media: []types.Media{{Name: "M001.xml", MimeType: "application/mei+xml", Url: "https://example.com/media/M001.xml/master"}},
+			},
+		},
+		MediaURLs:  []string{"https://example.com/media/M001.xml/master"},
+		PosterURLs: []string{"https://example.com/poster$$poster/master"},
+	}
+	meta.parts = append(meta.parts, "posters/poster", "media/M002.xml")
+	downloads := []downloadJob{
+		{url: collection.MediaURLs[0], part: meta.parts[1]},
+		{url: collection.PosterURLs[0], part: meta.parts[2]},
+	}
+	sources := collectionSources(collection, meta.parts[:1], downloads)
+	files, err := makeFileEntities(crateDir, meta.parts, sources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 4 {
+		t.Fatalf("expected an entity for each part: %+v", files)
+	}
+	record, media, poster, missing := files[0], files[1], files[2], files[3]
+	if record.Name != "M001 Beata progenies" || record.EncodingFormat != "application/json" || record.ContentSize != "9" {
+		t.Errorf("record not described: %+v", record)
+	}
+	digest := sha256.Sum256([]byte("{\"a\": 1}\n"))
+	if record.SHA256 != hex.EncodeToString(digest[:]) {
+		t.Errorf("record checksum not set: %+v", record)
+	}
+	if media.EncodingFormat != "application/mei+xml" || media.ContentURL != collection.MediaURLs[0] || media.DateModified == "" {
+		t.Errorf("media not described: %+v", media)
+	}
+	if poster.EncodingFormat != "image/png" || poster.Type != "File" {
+		t.Errorf("poster format not sniffed: %+v", poster)
+	}
+	if missing.SHA256 != "" || missing.ContentSize != "" || missing.Name != "M002.xml" {
+		t.Errorf("missing file should only be named: %+v", missing)
+	}
+}
+
+// TestMakeRecordEntities ensures each record is described and linked
+// to its files and to related records inside and outside the crate.
+func TestMakeRecordEntities(t *testing.T) {
+	items := []types.Item{
+		{
+			Label:     "M001 Beata progenies",
+			Signature: "motetcycle-0955",
+			Url:       "https://www.motetcycles.org/motet/955",
+			File:      "motetcycle-0955.json",
+			License:   "https://creativecommons.org/publicdomain/zero/1.0/",
+			Publisher: "Mediathek HGK FHNW",
+			Type:      "motet",
+			Identifiers: []types.Identifier{
+				{Type: "ark", Name: "ark:/15737/p657-67kd-93sh", Url: "https://n2t.net/ark:/15737/p657-67kd-93sh"},
+			},
+			Media:  []types.Media{{Url: "https://example.com/M001.xml/master"}},
+			Poster: types.Poster{Url: "https://example.com/M001.png/master"},
+			Relationship: []types.Relationship{
+				{Label: "C02 Beata progenies", Signature: "motetcycle-0399", Url: "https://www.motetcycles.ch/cycle/399"},
+				{Label: "External", Url: "https://example.com/external", Type: "motet"},
+			},
+		},
+		{
+			Label:     "C02 Beata progenies",
+			Signature: "motetcycle-0399",
+			File:      "motetcycle-0399.json",
+			Relationship: []types.Relationship{
+				{Label: "M001 Beata progenies", Url: "https://www.motetcycles.org/motet/955", Type: "motet"},
+				{Label: "Motet Cycles", Url: "https://www.motetcycles.ch/research"},
+			},
+		},
+	}
+	sources := map[string]fileSource{
+		"media/M001.xml":   {url: "https://example.com/M001.xml/master"},
+		"posters/M001.png": {url: "https://example.com/M001.png/master"},
+	}
+	records := makeRecordEntities(items, []string{"records/motetcycle-0955.json", "records/motetcycle-0399.json"}, sources, nil)
+	if len(records) != 4 {
+		t.Fatalf("expected two records and two external entities: %+v", records)
+	}
+	motet, cycle, external := records[0], records[1], records[2]
+	if motet.ID != "#motetcycle-0955" || motet.Type != "CreativeWork" || motet.SubjectOf.ID != "records/motetcycle-0955.json" {
+		t.Errorf("motet not described: %+v", motet)
+	}
+	if len(motet.HasPart) != 1 || motet.HasPart[0].ID != "media/M001.xml" || motet.Image.ID != "posters/M001.png" {
+		t.Errorf("motet files not linked: %+v", motet)
+	}
+	if !slices.Equal(motet.Identifier, []idPointer{{"#ark:/15737/p657-67kd-93sh"}}) {
+		t.Errorf("motet identifiers incorrect: %v", motet.Identifier)
+	}
+	if !slices.Equal(motet.SameAs, []idPointer{{"https://n2t.net/ark:/15737/p657-67kd-93sh"}}) {
+		t.Errorf("motet should be the same as its resolver URL: %v", motet.SameAs)
+	}
+	if !slices.Equal(motet.IsPartOf, []idPointer{{"#motetcycle-0399"}}) || !slices.Equal(motet.Citation, []idPointer{{"https://example.com/external"}}) {
+		t.Errorf("motet relationships incorrect: %v %v", motet.IsPartOf, motet.Citation)
+	}
+	if !slices.Equal(cycle.HasPart, []idPointer{{"#motetcycle-0955"}}) {
+		t.Errorf("cycle should have the motet, linked by url, as a part: %v", cycle.HasPart)
+	}
+	if !slices.Equal(cycle.Citation, []idPointer{{"https://www.motetcycles.ch/research"}}) {
+		t.Errorf("cycle should cite the other collection: %v", cycle.Citation)
+	}
+	if external.ID != "https://example.com/external" || external.Name != "External" {
+		t.Errorf("external record not described: %+v", external)
+	}
+
+	crate := makeCrateObj(metaJSON{records: records})
+	root := crate.Graph[1].(files)
+	if !slices.Equal(root.Mentions, []idPointer{{"#motetcycle-0955"}, {"#motetcycle-0399"}}) {
+		t.Errorf("root should mention the records: %v", root.Mentions)
+	}
+}
+
+// TestPersonEntities ensures persons are deduplicated across records
+// and linked using the property for their role.
+func TestPersonEntities(t *testing.T) {
+	items := []types.Item{
+		{
+			Signature: "motetcycle-0955",
+			Persons: []types.Person{
+				{Name: "Gaffurius, Franchinus", Role: "Composer"},
+				{Name: "Cassia, Cristina", Role: "author"},
+			},
+		},
+		{
+			Signature: "motetcycle-0399",
+			Persons: []types.Person{
+				{Name: "Gaffurius, Franchinus", Role: "composer"},
+				{
+					Name: "Cassia, Cristina",
+					Role: "editor",
+					Identifiers: []types.Identifier{
+						{Type: "orcid", Url: "https://orcid.org/0000-0002-1825-0097"},
+					},
+				},
+			},
+		},
+	}
+	persons, ids := makePersonEntities(items)
+	if len(persons) != 2 {
+		t.Fatalf("persons should be deduplicated: %+v", persons)
+	}
+	gaffurius, cassia := persons[0], persons[1]
+	if gaffurius.ID != "#person-gaffurius-franchinus" || gaffurius.Type != "Person" || gaffurius.FamilyName != "Gaffurius" || gaffurius.GivenName != "Franchinus" {
+		t.Errorf("person not described: %+v", gaffurius)
+	}
+	if cassia.ID != "https://orcid.org/0000-0002-1825-0097" {
+		t.Errorf("person should be identified by their identifier: %+v", cassia)
+	}
+	records := makeRecordEntities(items, nil, nil, ids)
+	motet, cycle := records[0], records[1]
+	if !slices.Equal(motet.Composer, []idPointer{{gaffurius.ID}}) || !slices.Equal(motet.Author, []idPointer{{cassia.ID}}) {
+		t.Errorf("motet persons not linked: %+v", motet)
+	}
+	if !slices.Equal(cycle.Composer, []idPointer{{gaffurius.ID}}) || !slices.Equal(cycle.Contributor, []idPointer{{cassia.ID}}) {
+		t.Errorf("cycle persons not linked: %+v", cycle)
+	}
+}
+
+// TestMakePropertyValues ensures persistent identifiers are described
+// once by PropertyValue entities.
+func TestMakePropertyValues(t *testing.T) {
+	handle := types.Identifier{Type: "handle", Name: "20.500.11806/med/3hjc-05sv-4w", Url: "https://hdl.handle.net/20.500.11806/med/3hjc-05sv-4w"}
+	items := []types.Item{
+		{Identifiers: []types.Identifier{{Type: "ark", Name: "ark:/15737/p657-67kd-93sh", Url: "https://n2t.net/ark:/15737/p657-67kd-93sh"}, handle}},
+		{Identifiers: []types.Identifier{handle}},
+	}
+	values := makePropertyValues(items)
+	if len(values) != 2 {
+		t.Fatalf("identifiers should be deduplicated: %+v", values)
+	}
+	expected := propertyValue{
+		ID:         "#handle:20.500.11806/med/3hjc-05sv-4w",
+		Type:       "PropertyValue",
+		PropertyID: "handle",
+		Value:      "20.500.11806/med/3hjc-05sv-4w",
+		URL:        "https://hdl.handle.net/20.500.11806/med/3hjc-05sv-4w",
+	}
+	if values[0].ID != "#ark:/15737/p657-67kd-93sh" || values[1] != expected {
+		t.Errorf("property values incorrect: %+v", values)
+	}
+}
+
+// TestRenderPreview ensures the preview describes the root dataset and
+// its records, and that a custom template can be used instead.
+func TestRenderPreview(t *testing.T) {
+	items := []types.Item{
+		{
+			Label:     "M001 <Beata progenies>",
+			Signature: "motetcycle-0955",
+			Persons:   []types.Person{{Name: "Gaffurius, Franchinus", Role: "Composer"}},
+		},
+	}
+	sources := map[string]fileSource{"posters/M001.png": {url: "https://example.com/M001.png/master"}}
+	items[0].Poster = types.Poster{Url: "https://example.com/M001.png/master"}
+	persons, ids := makePersonEntities(items)
+	meta := testMeta
+	meta.persons = persons
+	meta.records = makeRecordEntities(items, []string{"records/motetcycle-0955.json"}, sources, ids)
+	meta.files = []fileEntity{{ID: "records/motetcycle-0955.json", Type: "File", Name: "M001"}}
+	data, err := json.Marshal(makeCrateObj(meta))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := renderPreview(data, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"<title>Motet Cycles</title>",
+		`<a href="https://ror.org/04mq2g308">FHNW University of Applied Sciences and Arts</a>`,
+		`<div class="record" id="motetcycle-0955">`,
+		`<img src="posters/M001.png" alt="">`,
+		"<h3>M001 &lt;Beata progenies&gt;</h3>",
+		"<dt>Composer</dt><dd>Gaffurius, Franchinus<br></dd>",
+		`<a href="records/motetcycle-0955.json">records/motetcycle-0955.json</a>`,
+		`"@graph":`,
+	} {
+		if !bytes.Contains(out, []byte(expected)) {
+			t.Errorf("preview is missing %s:\n%s", expected, out)
+		}
+	}
+
+	templatePath := filepath.Join(t.TempDir(), "custom.html.tmpl")
+	custom := `{{ range .Records }}{{ label . }}: {{ range refs (index . "composer") }}{{ label . }}{{ end }}{{ end }}`
+	if err := os.WriteFile(templatePath, []byte(custom), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err = renderPreview(data, templatePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "M001 &lt;Beata progenies&gt;: Gaffurius, Franchinus" {
+		t.Errorf("custom template not used: %s", out)
+	}
+	if _, err := renderPreview(data, filepath.Join(t.TempDir(), "missing.tmpl")); err == nil {
+		t.Error("expected an error for a missing template")
+	}
+}
+
+// TestRocrateVersions ensures the context and metadata descriptor
+// follow the selected version of RO-Crate and that profiles are
+// declared by the root dataset.
+func TestRocrateVersions(t *testing.T) {
+	meta := testMeta
+	meta.identifier = "FHNW-1234"
+	crate := makeCrateObj(meta)
+	descriptor := crate.Graph[0].(root)
+	if crate.Context != "https://w3id.org/ro/crate/1.1/context" || descriptor.ConformsTo.ID != "https://w3id.org/ro/crate/1.1" {
+		t.Errorf("RO-Crate 1.1 should be written by default: %s %+v", crate.Context, descriptor)
+	}
+	if descriptor.Identifier != crateName {
+		t.Errorf("1.1 metadata descriptor should be unchanged: %+v", descriptor)
+	}
+	if rootData := crate.Graph[1].(files); rootData.ConformsTo != nil {
+		t.Errorf("root dataset should not conform to any profile: %+v", rootData.ConformsTo)
+	}
+
+	meta.rocrate = "1.2"
+	meta.Profiles = slices.Concat(
+		[]profile{{ID: "https://example.org/profiles/ink-collection/0.1", Name: "INK collection", Version: "0.1"}},
+		parseProfiles("https://example.org/profiles/ink-collection/0.1, https://w3id.org/ro/wfrun/process/0.5"),
+	)
+	crate = makeCrateObj(meta)
+	descriptor = crate.Graph[0].(root)
+	if crate.Context != "https://w3id.org/ro/crate/1.2/context" || descriptor.ConformsTo.ID != "https://w3id.org/ro/crate/1.2" {
+		t.Errorf("RO-Crate 1.2 not written: %s %+v", crate.Context, descriptor)
+	}
+	if descriptor.Identifier != "" {
+		t.Errorf("1.2 metadata descriptor should not have an identifier: %+v", descriptor)
+	}
+	rootData := crate.Graph[1].(files)
+	expected := []idPointer{{"https://example.org/profiles/ink-collection/0.1"}, {"https://w3id.org/ro/wfrun/process/0.5"}}
+	if !slices.Equal(rootData.ConformsTo, expected) {
+		t.Errorf("root dataset profiles incorrect: %v", rootData.ConformsTo)
+	}
+	ink := crate.Graph[3].(profileEntity)
+	if ink.Name != "INK collection" || ink.Version != "0.1" || !slices.Equal(ink.Type, []string{"CreativeWork", "Profile"}) {
+		t.Errorf("profile entity incorrect: %+v", ink)
+	}
+	if _, err := rocrateVersion("1.0"); err == nil {
+		t.Error("expected an error for an unsupported version")
+	}
+}
+
+// TestMakeProvenance ensures each run is described by a CreateAction
+// linking the app that ran to the files passed between the apps and
+// that the crater build results in the crate.
+func TestMakeProvenance(t *testing.T) {
+	lister := provenance.Run{
+		App:       "INK-lister",
+		Version:   "1.0.0",
+		Commit:    "abc123",
+		StartTime: "2026-02-13T15:00:00Z",
+		EndTime:   "2026-02-13T15:00:05Z",
+		Url:       "https://ink.sammlung.cc/table/de?search=motetcycle",
+		Outputs:   []string{"demo.manifest"},
+	}
+	gather := lister
+	gather.App = "INK-gather"
+	gather.Inputs, gather.Outputs = []string{"demo.manifest"}, nil
+	build := provenance.Run{App: craterApp, Version: "1.0.0", Commit: "abc123", StartTime: "2026-02-13T16:00:00Z", Inputs: []string{"demo.collection", "meta.json"}}
+	actions, entities := makeProvenance([]provenance.Run{lister, gather}, build)
+	if len(actions) != 3 {
+		t.Fatalf("expected an action for every run: %+v", actions)
+	}
+	if actions[0].ID != "#INK-lister-run-2026-02-13T15:00:00Z" || actions[0].Agent.ID != "#INK-lister-1.0.0" || actions[0].URL != lister.Url {
+		t.Errorf("lister action incorrect: %+v", actions[0])
+	}
+	if !slices.Equal(actions[0].Result, actions[1].Object) || actions[1].Object[0].ID != "#file:demo.manifest" {
+		t.Errorf("gather should use the lister's manifest: %+v %+v", actions[0], actions[1])
+	}
+	if !slices.Equal(actions[2].Result, []idPointer{{"./"}}) || len(actions[2].Object) != 2 {
+		t.Errorf("crater should create the crate from its inputs: %+v", actions[2])
+	}
+	// three apps and three files.
+	if len(entities) != 6 {
+		t.Errorf("apps and files should be described once: %+v", entities)
+	}
+	app := entities[0].(softwareApplication)
+	if app.Type != "SoftwareApplication" || app.Version != "1.0.0" || app.Identifier != "abc123" {
+		t.Errorf("app not described: %+v", app)
+	}
+
+	meta := testMeta
+	meta.actions, meta.provenance = makeProvenance(nil, build)
+	root := makeCrateObj(meta).Graph[1].(files)
+	if !slices.Equal(root.Mentions, []idPointer{{actions[2].ID}}) {
+		t.Errorf("root should mention the actions: %v", root.Mentions)
+	}
+}
+
+var licenseNameTests = []struct {
+	license  string
+	expected string
+}{
+	{"https://creativecommons.org/publicdomain/zero/1.0/", "CC0 1.0"},
+	{"https://creativecommons.org/licenses/by/4.0/", "CC BY 4.0"},
+	{"http://creativecommons.org/licenses/by-nc-sa/4.0/deed.de", "CC BY-NC-SA 4.0"},
+	{"https://opensource.org/licenses/MIT", "MIT"},
+	{"http://rightsstatements.org/vocab/InC/1.0/", "http://rightsstatements.org/vocab/InC/1.0/"},
+	{"In Copyright", "In Copyright"},
+}
+
+// TestLicenseName ensures licenses are given human-readable names.
+func TestLicenseName(t *testing.T) {
+	for _, test := range licenseNameTests {
+		if res := licenseName(test.license); res != test.expected {
+			t.Errorf("license name incorrect: '%s' expected: '%s'", res, test.expected)
+		}
+	}
+}
+
+// TestApplyLicenses ensures only records, and their files, licensed
+// differently to the collection are given their own license and that
+// the mixed licensing is reported.
+func TestApplyLicenses(t *testing.T) {
+	items := []types.Item{
+		{Signature: "motetcycle-0955", License: "http://creativecommons.org/publicdomain/zero/1.0/"},
+		{Signature: "motetcycle-0399", License: "https://creativecommons.org/licenses/by/4.0/"},
+		{Signature: "motetcycle-0400", License: "In Copyright"},
+		{Signature: "motetcycle-0401"},
+	}
+	records := []recordEntity{
+		{ID: "#motetcycle-0955", SubjectOf: &idPointer{"records/motetcycle-0955.json"}, Image: &idPointer{"posters/shared.png"}},
+		{ID: "#motetcycle-0399", SubjectOf: &idPointer{"records/motetcycle-0399.json"}, HasPart: []idPointer{{"media/C02.xml"}}, Image: &idPointer{"posters/shared.png"}},
+		{ID: "#motetcycle-0400", Image: &idPointer{"posters/shared.png"}},
+		{ID: "#motetcycle-0401"},
+	}
+	parts := []fileEntity{
+		{ID: "records/motetcycle-0955.json"},
+		{ID: "records/motetcycle-0399.json"},
+		{ID: "media/C02.xml"},
+		{ID: "posters/shared.png"},
+	}
+	licenses, report := applyLicenses(testMeta.License, items, records, parts)
+	expected := []licenseEntity{
+		{ID: testMeta.License, Type: "CreativeWork", Name: "CC0 1.0", URL: testMeta.License},
+		{ID: "https://creativecommons.org/licenses/by/4.0/", Type: "CreativeWork", Name: "CC BY 4.0", URL: "https://creativecommons.org/licenses/by/4.0/"},
+		{ID: "#license-in-copyright", Type: "CreativeWork", Name: "In Copyright"},
+	}
+	if !slices.Equal(licenses, expected) {
+		t.Errorf("license entities incorrect: %+v", licenses)
+	}
+	if records[0].License != nil || records[3].License != nil || parts[0].License != nil {
+		t.Errorf("records under the collection license should not have their own: %+v %+v", records, parts)
+	}
+	if records[1].License.ID != expected[1].ID || parts[1].License.ID != expected[1].ID || parts[2].License.ID != expected[1].ID {
+		t.Errorf("record and files should be given their license: %+v %+v", records[1], parts)
+	}
+	if parts[3].License.ID != expected[1].ID || !slices.Equal(report.conflicts, []string{"posters/shared.png"}) {
+		t.Errorf("shared poster should keep the first license and be reported: %+v %v", parts[3], report.conflicts)
+	}
+	if len(report.mixed) != 2 || !slices.Equal(report.mixed[0].records, []string{"#motetcycle-0399"}) || len(report.mixed[0].files) != 3 {
+		t.Errorf("mixed licensing not reported: %+v", report)
+	}
+
+	meta := testMeta
+	meta.licenses = licenses
+	crate := makeCrateObj(meta)
+	if root := crate.Graph[1].(files); root.License.ID != testMeta.License {
+		t.Errorf("root should point at the license entity: %+v", root.License)
+	}
+}
+
+// TestUpdateExistingCrate ensures an existing crate keeps its
+// identifier and publication date and that files no longer in the
+// collection are removed.
+func TestUpdateExistingCrate(t *testing.T) {
+	crateDir := t.TempDir()
+	os.MkdirAll(filepath.Join(crateDir, "media"), 0755)
+	os.WriteFile(filepath.Join(crateDir, "media", "M001.xml"), []byte("<mei/>"), 0644)
+	os.WriteFile(filepath.Join(crateDir, "media", "M002.xml"), []byte("<mei/>"), 0644)
+	meta := testMeta
+	meta.identifier = "ink_01ABC"
+	meta.datePublished = "2024-01-02"
+	meta.parts = []string{"media/M001.xml", "media/M002.xml"}
+	meta.files = []fileEntity{
+		{ID: "media/M001.xml", Type: "File", ContentURL: "https://example.com/media/M001.xml/master"},
+		{ID: "media/M002.xml", Type: "File", ContentURL: "https://example.com/media/M002.xml/master"},
+	}
+	data, err := json.Marshal(makeCrateObj(meta))
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(crateDir, crateName), data, 0644)
+
+	updated := testMeta
+	existing := updateStage(&updated, crateDir)
+	if updated.identifier != "ink_01ABC" || updated.datePublished != "2024-01-02" || updated.dateModified == "" {
+		t.Fatalf("identifier and dates not kept: %+v", existing)
+	}
+	if !existing.unchanged(crateDir, "media/M001.xml", "https://example.com/media/M001.xml/master") {
+		t.Error("unchanged media should be kept")
+	}
+	if existing.unchanged(crateDir, "media/M001.xml", "https://example.com/media/M001.xml/v2") {
+		t.Error("media from a new URL should be replaced")
+	}
+	existing.hashes["media/M001.xml"] = "0000"
+	if existing.unchanged(crateDir, "media/M001.xml", "https://example.com/media/M001.xml/master") {
+		t.Error("media not matching its digest should be replaced")
+	}
+	removed, err := removeStale(crateDir, existing, []string{"media/M001.xml", "media/M003.xml"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(removed, []string{"media/M002.xml"}) {
+		t.Errorf("unexpected files removed: %v", removed)
+	}
+	if _, err := os.Stat(filepath.Join(crateDir, "media", "M002.xml")); !os.IsNotExist(err) {
+		t.Error("removed file still on disk")
+	}
+	obj := makeCrateObj(updated).Graph[1].(files)
+	if obj.DatePublished != "2024-01-02" || obj.DateModified != updated.dateModified {
+		t.Errorf("root dates not set: %+v", obj)
+	}
+}
+
+// TestDownloader ensures downloads are spread across workers, limited
+// per host and returned in the order they were given.
+func TestDownloader(t *testing.T) {
+	var mu sync.Mutex
+	fetched := map[string][]time.Time{}
+	dl := newDownloader(3, 20, 0)
+	dl.fetch = func(job downloadJob) error {
+		url := job.url
+		mu.Lock()
+		defer mu.Unlock()
+		host := strings.Split(url, "/")[2]
+		fetched[host] = append(fetched[host], time.Now())
+		if strings.HasSuffix(url, "missing") {
+			return fmt.Errorf("not found: %s", url)
+		}
+		return nil
+	}
+	jobs := []downloadJob{
+		{url: "https://a.example.com/1"},
+		{url: "https://a.example.com/missing"},
+		{url: "https://a.example.com/3"},
+		{url: "https://b.example.com/1"},
+	}
+	start := time.Now()
+	errs := dl.download(jobs)
+	if len(errs) != 4 || errs[0] != nil || errs[1] == nil || errs[2] != nil || errs[3] != nil {
+		t.Fatalf("errors not returned in job order: %v", errs)
+	}
+	if len(fetched["a.example.com"]) != 3 || len(fetched["b.example.com"]) != 1 {
+		t.Fatalf("not every job was fetched: %v", fetched)
+	}
+	slices.SortFunc(fetched["a.example.com"], func(a, b time.Time) int { return a.Compare(b) })
+	if last := fetched["a.example.com"][2]; last.Sub(start) < 90*time.Millisecond {
+		t.Errorf("requests to a host not limited: %v", last.Sub(start))
+	}
+	if first := fetched["b.example.com"][0]; first.Sub(start) > 40*time.Millisecond {
+		t.Errorf("requests to another host delayed: %v", first.Sub(start))
+	}
+}
+
+// TestDownloadCrateObj ensures downloads are resumed from .part files
+// and complete files aren't downloaded again.
+func TestDownloadCrateObj(t *testing.T) {
+	content := []byte("<mei>Beata progenies</mei>")
+	ranges := []string{}
+	gets := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			gets++
+			ranges = append(ranges, r.Header.Get("Range"))
+		}
+		http.ServeContent(w, r, "M001.xml", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "M001.xml")
+	os.WriteFile(path+partExt, content[:5], 0644)
+	if err := downloadCrateObj(downloadJob{url: server.URL, path: path}); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if !bytes.Equal(data, content) || ranges[0] != "bytes=5-" {
+		t.Errorf("download not resumed: %q (range: %q)", data, ranges)
+	}
+	if _, err := os.Stat(path + partExt); !os.IsNotExist(err) {
+		t.Error(".part file not renamed")
+	}
+	if err := downloadCrateObj(downloadJob{url: server.URL, path: path}); err != nil || gets != 1 {
+		t.Errorf("complete file downloaded again: %v (%d requests)", err, gets)
+	}
+	os.WriteFile(path, content[:3], 0644)
+	if err := downloadCrateObj(downloadJob{url: server.URL, path: path}); err != nil || gets != 2 {
+		t.Errorf("truncated file not downloaded again: %v (%d requests)", err, gets)
+	}
+	data, _ = os.ReadFile(path)
+	if !bytes.Equal(data, content) {
+		t.Errorf("unexpected content: %q", data)
+	}
+
+	// a .part file already the whole size is promoted when the server
+	// can't satisfy the range, an oversized one is discarded.
+	other := filepath.Join(filepath.Dir(path), "M002.xml")
+	os.WriteFile(other+partExt, content, 0644)
+	if err := downloadCrateObj(downloadJob{url: server.URL, path: other}); err != nil {
+		t.Errorf("complete .part file not promoted: %v", err)
+	}
+	os.Remove(other)
+	os.WriteFile(other+partExt, append(slices.Clone(content), "extra"...), 0644)
+	if err := downloadCrateObj(downloadJob{url: server.URL, path: other}); err == nil {
+		t.Error("oversized .part file promoted")
+	}
+	if _, err := os.Stat(other); !os.IsNotExist(err) {
+		t.Error("oversized .part file promoted")
+	}
+	if _, err := os.Stat(other + partExt); !os.IsNotExist(err) {
+		t.Error("oversized .part file not discarded")
+	}
+
+	// a resumed download must match the digest an existing crate
+	// recorded.
+	os.WriteFile(other+partExt, []byte("<xxx>"), 0644)
+	digest := sha256.Sum256(content)
+	job := downloadJob{url: server.URL, path: other, sha256: hex.EncodeToString(digest[:])}
+	if err := downloadCrateObj(job); err == nil {
+		t.Error("resumed download not matching its digest promoted")
+	}
+	if err := downloadCrateObj(job); err != nil {
+		t.Errorf("download not restarted: %v", err)
+	}
+	data, _ = os.ReadFile(other)
+	if !bytes.Equal(data, content) {
+		t.Errorf("unexpected content: %q", data)
+	}
+}
+
+// TestDownloadLimitsSize ensures the size of a file requested from
+// the server waits its turn with the downloader's limiter.
+func TestDownloadLimitsSize(t *testing.T) {
+	content := []byte("<mei>Beata progenies</mei>")
+	var mu sync.Mutex
+	requests := []time.Time{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, time.Now())
+		mu.Unlock()
+		http.ServeContent(w, r, "M001.xml", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "M001.xml")
+	os.WriteFile(path, content[:3], 0644)
+	dl := newDownloader(1, 10, 0)
+	if errs := dl.download([]downloadJob{{url: server.URL, path: path}}); errs[0] != nil {
+		t.Fatal(errs[0])
+	}
+	if len(requests) != 2 {
+		t.Fatalf("expected the size and the file to be requested: %v", requests)
+	}
+	if gap := requests[1].Sub(requests[0]); gap < 90*time.Millisecond {
+		t.Errorf("requests to the host not limited: %v", gap)
+	}
+	data, _ := os.ReadFile(path)
+	if !bytes.Equal(data, content) {
+		t.Errorf("unexpected content: %q", data)
+	}
+}
+
+// TestDownloadRetries ensures failed downloads are retried, honouring
+// Retry-After, and recorded once the retries are used up.
+func TestDownloadRetries(t *testing.T) {
+	if delay, retry := retryDelay(statusError{status: 429, retryAfter: 3 * time.Second}, 1, time.Second); !retry || delay != 3*time.Second {
+		t.Errorf("Retry-After not honoured: %s", delay)
+	}
+	if delay, _ := retryDelay(fmt.Errorf("connection reset"), 2, time.Second); delay != 4*time.Second {
+		t.Errorf("backoff not doubled: %s", delay)
+	}
+	if _, retry := retryDelay(&os.PathError{Op: "open", Path: "media", Err: os.ErrPermission}, 0, time.Second); retry {
+		t.Error("file errors should not be retried")
+	}
+	if parseRetryAfter("120") != 2*time.Minute || parseRetryAfter("soon") != 0 {
+		t.Error("Retry-After not parsed")
+	}
+
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+		if r.URL.Path == "/busy.png" && requests[r.URL.Path] < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path == "/down.png" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("\x89PNG\r\n\x1a\n"))
+	}))
+	defer server.Close()
+	crateDir := t.TempDir()
+	os.MkdirAll(filepath.Join(crateDir, "posters"), 0755)
+	dl := newDownloader(1, 0, 2)
+	dl.backoff = time.Millisecond
+	urls := []string{server.URL + "/busy.png", server.URL + "/down.png"}
+	downloads, failures := downloadFile(dl, newCrateNames(existingCrate{}).jobs(crateDir, "posters", urls), crateDir, existingCrate{}, false)
+	if parts := jobParts(downloads); !slices.Equal(parts, []string{"posters/busy.png"}) || requests["/busy.png"] != 3 {
+		t.Errorf("download not retried: %v (%v)", downloads, requests)
+	}
+	if len(failures) != 1 || failures[0].Part != "posters/down.png" || requests["/down.png"] != 3 {
+		t.Fatalf("failure not recorded: %+v (%v)", failures, requests)
+	}
+	failedPath, err := writeFailed(crateDir, failures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := readFailed(failedPath)
+	if err != nil || !reflect.DeepEqual(read, failures) {
+		t.Errorf("failed downloads not read back: %+v (%v)", read, err)
+	}
+	if _, err := writeFailed(crateDir, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(failedPath); !os.IsNotExist(err) {
+		t.Error("failed downloads not removed once retried")
+	}
+}
+
+// TestFormatMatches ensures sniffed formats are compared leniently
+// but error pages are caught.
+func TestFormatMatches(t *testing.T) {
+	tests := []struct {
+		expected string
+		sniffed  string
+		matches  bool
+	}{
+		{"application/mei+xml", "text/xml", true},
+		{"application/mei+xml", "text/html", false},
+		{"image/*", "image/png", true},
+		{"image/*", "text/plain", false},
+		{"image/*", "text/html", false},
+		{"audio/mpeg", "audio/mpeg", true},
+		{"audio/mpeg", "application/pdf", false},
+		{"application/json", "text/plain", true},
+		{"", "application/octet-stream", true},
+		{"", "text/html", false},
+		{"text/html", "text/html", true},
+	}
+	for _, test := range tests {
+		if matches := formatMatches(test.expected, test.sniffed); matches != test.matches {
+			t.Errorf("%s as %s: expected %v", test.sniffed, test.expected, test.matches)
+		}
+	}
+}
+
+// TestVerifyDownloads ensures error responses aren't written to the
+// crate and downloads of the wrong format are quarantined.
+func TestVerifyDownloads(t *testing.T) {
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+		switch r.URL.Path {
+		case "/missing.png":
+			http.NotFound(w, r)
+		case "/page.png":
+			w.Write([]byte("<!DOCTYPE html><html><body>Server error</body></html>"))
+		default:
+			w.Write([]byte("\x89PNG\r\n\x1a\n"))
+		}
+	}))
+	defer server.Close()
+	crateDir := t.TempDir()
+	posterDir := filepath.Join(crateDir, "posters")
+	os.MkdirAll(posterDir, 0755)
+	urls := []string{server.URL + "/missing.png", server.URL + "/page.png", server.URL + "/poster.png"}
+	dl := newDownloader(1, 0, 2)
+	dl.backoff = time.Millisecond
+	dl.quarantine = quarantineDir(crateDir)
+	dl.formats = expectedFormats(types.Collection{PosterURLs: urls})
+	downloads, failures := downloadFile(dl, newCrateNames(existingCrate{}).jobs(crateDir, "posters", urls), crateDir, existingCrate{}, false)
+	if parts := jobParts(downloads); !slices.Equal(parts, []string{"posters/poster.png"}) {
+		t.Errorf("invalid downloads listed: %v", parts)
+	}
+	if len(failures) != 2 || requests["/missing.png"] != 1 {
+		t.Fatalf("error responses not reported: %+v (%v)", failures, requests)
+	}
+	for _, name := range []string{"missing.png", "page.png"} {
+		if _, err := os.Stat(filepath.Join(posterDir, name)); !os.IsNotExist(err) {
+			t.Errorf("invalid download written to the crate: %s", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dl.quarantine, "posters", "page.png")); err != nil {
+		t.Errorf("error page not quarantined: %v (%s)", err, failures[1].Error)
+	}
+}
+
+// TestPortableName ensures downloads are given names that are valid on
+// every platform.
+func TestPortableName(t *testing.T) {
+	tests := map[string]string{
+		"M001.xml":                        "M001.xml",
+		"Beata%20progenies.mei":           "Beata_progenies.mei",
+		"Kyrie\u0301.xml":                 "Kyri\u00e9.xml",
+		"a<b>c:d|e?f*.png":                "a_b_c_d_e_f_.png",
+		"con.png":                         "_con.png",
+		".hidden":                         "_.hidden",
+		"poster.":                         "poster",
+		"":                                "file",
+		strings.Repeat("ä", 100) + ".xml": strings.Repeat("ä", 62) + ".xml",
+	}
+	for name, expected := range tests {
+		if portable := portableName(name); portable != expected {
+			t.Errorf("%q: expected %q, got %q", name, expected, portable)
+		}
+	}
+	if portable := portableName(strings.Repeat("a", 300) + ".png"); len(portable) > maxNameLength {
+		t.Errorf("name not truncated: %d bytes", len(portable))
+	}
+}
+
+// TestCrateNames ensures URLs with the same name are given distinct
+// paths, the same each time, and that the mapping is written.
+func TestCrateNames(t *testing.T) {
+	urls := []string{
+		"https://example.com/media/a/M001.xml/master",
+		"https://example.com/media/b/M001.xml/master",
+		"https://example.com/media/c/m001.XML/master",
+		"https://example.com/media/a/M001.xml/master",
+	}
+	jobs := newCrateNames(existingCrate{}).jobs("crate", "media", urls)
+	parts := jobParts(jobs)
+	if len(parts) != 3 {
+		t.Fatalf("a URL listed twice should be downloaded once: %v", parts)
+	}
+	if parts[0] != "media/M001.xml" {
+		t.Errorf("name not kept for its URL: %v", parts)
+	}
+	if parts[1] == parts[0] || strings.EqualFold(parts[2], parts[0]) || parts[1] == parts[2] {
+		t.Errorf("collision not disambiguated: %v", parts)
+	}
+	again := jobParts(newCrateNames(existingCrate{}).jobs("crate", "media", urls))
+	if !slices.Equal(parts, again) {
+		t.Errorf("names not deterministic: %v %v", parts, again)
+	}
+	existing := existingCrate{files: map[string]string{"media/M001.xml": urls[1]}}
+	updated := jobParts(newCrateNames(existing).jobs("crate", "media", urls[:2]))
+	if updated[1] != "media/M001.xml" || updated[0] == updated[1] {
+		t.Errorf("existing names not kept: %v", updated)
+	}
+	short := "media/" + disambiguate("M001.xml", urls[1], 4)
+	existing = existingCrate{files: map[string]string{
+		"media/M001.xml": urls[0],
+		short:            "https://example.com/media/d/M001.xml/master",
+	}}
+	longer := jobParts(newCrateNames(existing).jobs("crate", "media", urls[1:2]))
+	if longer[0] == short || longer[0] != "media/"+disambiguate("M001.xml", urls[1], 6) {
+		t.Errorf("disambiguated name should be lengthened when taken: %v", longer)
+	}
+
+	crateDir := t.TempDir()
+	if err := writeURLMap(crateDir, jobs[:2]); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(filepath.Join(crateDir, urlMapName))
+	expected := "url,path\n" + urls[0] + "," + parts[0] + "\n" + urls[1] + "," + parts[1] + "\n"
+	if string(data) != expected {
+		t.Errorf("unexpected url map: %q", data)
+	}
+}
+
+// TestCrateValidates ensures the metadata crater writes for the
+// shipped meta.json, whose second publisher has no identifier, is a
+// valid crate.
+func TestCrateValidates(t *testing.T) {
+	data, err := os.ReadFile("meta.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := metaJSON{}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		t.Fatal(err)
+	}
+	crateDir, parts := makeTestCrateDir(t)
+	meta.parts = parts.parts
+	meta.identifier = makeULID(meta.IDPrefix)
+	meta.files, err = makeFileEntities(crateDir, meta.parts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta.licenses, _ = applyLicenses(meta.License, nil, nil, meta.files)
+	crateJSON, err := json.MarshalIndent(makeCrateObj(meta), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(crateDir, crateName), crateJSON, 0644)
+	previewCrate(crateDir, crateJSON)
+	if report := ro.Validate(crateDir, ro.Recommended); !report.Valid() {
+		t.Errorf("crate should be valid: %v", report.Issues)
+	}
+}
+
+// TestMakePublisher ensures a publisher without an identifier is given
+// the same blank node each time the crate is built.
+func TestMakePublisher(t *testing.T) {
+	meta := testMeta
+	meta.Publisher = append(slices.Clone(meta.Publisher), publisher{PublisherName: "Institute Experimental Design and Media Cultures (IXDM)"})
+	ids, orgs := makePublisher(meta)
+	again, _ := makePublisher(meta)
+	if len(ids) != 2 || !strings.HasPrefix(ids[1].ID, "_:") || !slices.Equal(ids, again) {
+		t.Errorf("publisher identifiers should be deterministic: %v %v", ids, again)
+	}
+	if orgs[1].Type != "Organization" {
+		t.Errorf("publisher should be an Organization: %+v", orgs[1])
+	}
+}
+
+// TestRecrateOCFL ensures re-crating a collection whose records carry
+// identifiers adds a new version to the existing OCFL object.
+func TestRecrateOCFL(t *testing.T) {
+	layout := storageLayout
+	storageLayout = ocfl.FlatDirect
+	defer func() { storageLayout = layout }()
+	root := filepath.Join(t.TempDir(), "store")
+	crateDir, meta := makeTestCrateDir(t)
+	meta.identifier = "FHNW-01JABCDEFGHJKMNPQRSTVWXYZ"
+	meta.records = []recordEntity{
+		{
+			ID:         "#motetcycle-0955",
+			Type:       recordType,
+			Name:       "M001 Beata progenies",
+			Identifier: []idPointer{{"#ark-ark:/15737/p657-67kd-93sh"}},
+		},
+	}
+	data, err := json.Marshal(makeCrateObj(meta))
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(crateDir, crateName), data, 0644)
+	first, err := writeOCFL(root, meta, crateDir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, objectPath, err := findCrateObject(root, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ID != meta.identifier || objectPath != filepath.Join(root, meta.identifier) {
+		t.Errorf("flat-direct object should be identified by the crate identifier: %s", first.ID)
+	}
+	if id != meta.identifier || objectPath == "" {
+		t.Fatalf("existing object not found: %q %q", id, objectPath)
+	}
+	if findObjectByID(root, meta.identifier) != objectPath {
+		t.Errorf("object not found by the crate identifier")
+	}
+	os.WriteFile(filepath.Join(crateDir, "media", "M001.xml"), []byte("<mei>2</mei>\n"), 0644)
+	second, err := writeOCFL(root, meta, crateDir, objectPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.ID != first.ID || second.Head != "v2" {
+		t.Errorf("expected a new version of the same object: %s (%s)", second.ID, second.Head)
+	}
+
+	for idx, start := range []string{"2026-02-13T15:00:00Z", "2026-02-14T09:30:00Z"} {
+		run := provenance.Run{App: craterApp, Version: "1.0.0", StartTime: start, EndTime: start}
+		meta.actions, meta.provenance = makeProvenance(nil, run)
+		meta.dateModified = start
+		data, _ := json.Marshal(makeCrateObj(meta))
+		os.WriteFile(filepath.Join(crateDir, crateName), data, 0644)
+		os.WriteFile(filepath.Join(crateDir, previewName), []byte(start), 0644)
+		rerun, err := writeOCFL(root, meta, crateDir, objectPath)
+		if idx == 0 && (err != nil || rerun.Head != "v3") {
+			t.Fatalf("expected provenance to be added as a new version: %s (%v)", rerun.Head, err)
+		}
+		if idx == 1 && (!errors.Is(err, ocfl.ErrUnchanged) || rerun.Head != "v3") {
+			t.Errorf("a rerun of an unchanged crate should not add a version: %s (%v)", rerun.Head, err)
+		}
+	}
+
+	storageLayout = ocfl.HashAndIDNTuple
+	hashed := filepath.Join(t.TempDir(), "hashed")
+	inv, err := writeOCFL(hashed, meta, crateDir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.ID != "urn:zenodocfl:FHNW-01JABCDEFGHJKMNPQRSTVWXYZ" {
+		t.Errorf("object should be identified by a URI: %s", inv.ID)
+	}
+	id, objectPath, err = findCrateObject(hashed, meta)
+	if err != nil || id != meta.identifier || findObjectByID(hashed, meta.identifier) != objectPath {
+		t.Errorf("object not found by the crate identifier: %q %q (%v)", id, objectPath, err)
+	}
+	result := ocfl.ValidateObject(objectPath)
+	if !result.Valid() || slices.ContainsFunc(result.Warnings, func(issue ocfl.Issue) bool { return issue.Code == "W005" }) {
+		t.Errorf("object id should not be reported: %+v", result.Warnings)
+	}
+	if strings.Contains(strings.TrimPrefix(objectPath, hashed), ":") {
+		t.Errorf("object path should encode the identifier: %s", objectPath)
+	}
+}
+
+// TestRetryFailed ensures only the downloads listed in failed.jsonl are
+// retried, that those which succeed are added to the crate and that
+// the list is rewritten with those that still fail.
+func TestRetryFailed(t *testing.T) {
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+		switch r.URL.Path {
+		case "/M001.png":
+			w.Write([]byte("\x89PNG\r\n\x1a\n"))
+		case "/M001.xml":
+			w.Write([]byte("<?xml version=\"1.0\"?><mei/>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	crateDir, meta := makeTestCrateDir(t)
+	os.MkdirAll(filepath.Join(crateDir, "posters"), 0755)
+	meta.identifier = "FHNW-1234"
+	meta.parts = meta.parts[:1]
+	meta.files, _ = makeFileEntities(crateDir, meta.parts, nil)
+	meta.records = []recordEntity{{ID: "#motetcycle-0955", Type: recordType, Name: "M001 Beata progenies"}}
+	data, _ := json.Marshal(makeCrateObj(meta))
+	os.WriteFile(filepath.Join(crateDir, crateName), data, 0644)
+	failures := []failedDownload{
+		{URL: server.URL + "/M001.png", Part: "posters/M001.png", Format: posterFormat, Records: []string{"#motetcycle-0955"}},
+		{URL: server.URL + "/M001.xml", Part: "media/M002.xml", Format: "application/mei+xml", Name: "M001.xml", Records: []string{"#motetcycle-0955"}},
+		{URL: server.URL + "/M003.xml", Part: "media/M003.xml", Format: "application/mei+xml"},
+	}
+	failedPath, _ := writeFailed(crateDir, failures)
+
+	if retryFailedCrate(failedPath, false) {
+		t.Error("crate with a remaining failure reported as complete")
+	}
+	if len(requests) != 3 {
+		t.Errorf("only the failed downloads should be requested: %v", requests)
+	}
+	remaining, err := readFailed(failedPath)
+	if err != nil || len(remaining) != 1 || remaining[0].Part != "media/M003.xml" {
+		t.Errorf("failed downloads not rewritten: %+v (%v)", remaining, err)
+	}
+	crate, err := ro.Read(crateDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, _ := crate.Entity("./")
+	if refs := root.Refs("hasPart"); !slices.Contains(refs, "posters/M001.png") || !slices.Contains(refs, "media/M002.xml") {
+		t.Errorf("retried downloads not listed: %v", refs)
+	}
+	record, _ := crate.Entity("#motetcycle-0955")
+	if record.Refs("image")[0] != "posters/M001.png" || record.Refs("hasPart")[0] != "media/M002.xml" {
+		t.Errorf("record not linked to its retried downloads: %v", record)
+	}
+	media, ok := crate.Entity("media/M002.xml")
+	if !ok || media["encodingFormat"] != "application/mei+xml" || media["name"] != "M001.xml" || media["sha256"] == nil {
+		t.Errorf("retried download not described: %v", media)
+	}
+	if report := ro.Validate(crateDir, ro.Required); !report.Valid() {
+		t.Errorf("crate should remain valid: %v", report.Issues)
+	}
+}
+
+// TestDownloadKeepsStale ensures a part an existing crate holds is kept
+// when downloading it again fails.
+func TestDownloadKeepsStale(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	crateDir := t.TempDir()
+	os.MkdirAll(filepath.Join(crateDir, "posters"), 0755)
+	os.WriteFile(filepath.Join(crateDir, "posters", "poster.png"), []byte("\x89PNG\r\n\x1a\n"), 0644)
+	existing := existingCrate{
+		files:    map[string]string{"posters/poster.png": "https://example.com/poster.png"},
+		entities: map[string]fileEntity{"posters/poster.png": {ID: "posters/poster.png", Type: "File", ContentURL: "https://example.com/poster.png"}},
+	}
+	dl := newDownloader(1, 0, 0)
+	jobs := []downloadJob{{url: server.URL + "/poster.png", path: filepath.Join(crateDir, "posters", "poster.png"), part: "posters/poster.png"}}
+	downloads, failures := downloadFile(dl, jobs, crateDir, existing, false)
+	if len(failures) != 1 || len(downloads) != 1 || !downloads[0].stale {
+		t.Fatalf("existing copy not kept: %+v %+v", downloads, failures)
+	}
+	files, _ := makeFileEntities(crateDir, jobParts(downloads), nil)
+	keepStale(files, existing, downloads)
+	if files[0].ContentURL != "https://example.com/poster.png" {
+		t.Errorf("existing entity not kept: %+v", files[0])
+	}
+	removed, _ := removeStale(crateDir, existing, jobParts(downloads), false)
+	if len(removed) != 0 {
+		t.Errorf("existing copy removed: %v", removed)
+	}
+}
+
+// TestUpdateKeepsVerified ensures a download of the wrong format
+// doesn't replace the copy the crate being updated already holds.
+func TestUpdateKeepsVerified(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<!DOCTYPE html><html><body>Server error</body></html>"))
+	}))
+	defer server.Close()
+	crateDir := t.TempDir()
+	posterPath := filepath.Join(crateDir, "posters", "poster.png")
+	os.MkdirAll(filepath.Dir(posterPath), 0755)
+	os.WriteFile(posterPath, []byte("\x89PNG\r\n\x1a\n"), 0644)
+	existing := existingCrate{
+		files:    map[string]string{"posters/poster.png": "https://example.com/poster.png"},
+		entities: map[string]fileEntity{"posters/poster.png": {ID: "posters/poster.png", Type: "File"}},
+	}
+	urls := []string{server.URL + "/poster.png"}
+	dl := newDownloader(1, 0, 0)
+	dl.quarantine = quarantineDir(crateDir)
+	dl.formats = expectedFormats(types.Collection{PosterURLs: urls})
+	jobs := []downloadJob{{url: urls[0], path: posterPath, part: "posters/poster.png"}}
+	downloads, failures := downloadFile(dl, jobs, crateDir, existing, false)
+	if len(failures) != 1 || !strings.Contains(failures[0].Error, "expected image/*") || !downloads[0].stale {
+		t.Fatalf("wrong format not reported: %+v %+v", downloads, failures)
+	}
+	if data, _ := os.ReadFile(posterPath); !bytes.HasPrefix(data, []byte("\x89PNG")) {
+		t.Errorf("existing copy replaced: %q", data)
+	}
+	if _, err := os.Stat(posterPath + partExt); !os.IsNotExist(err) {
+		t.Errorf(".part file should be quarantined: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dl.quarantine, "posters", "poster.png")); !bytes.Contains(data, []byte("Server error")) {
+		t.Errorf("download not quarantined: %q", data)
+	}
+}
+
+// TestLatestCrate ensures the latest crate of a collection is reused
+// whether or not its run finished.
+func TestLatestCrate(t *testing.T) {
+	t.Chdir(t.TempDir())
+	for _, dir := range []string{"ro-crate-Motet-Cycles-100", "ro-crate-Motet-Cycles-200", "ro-crate-Motet-Cycles-200-package"} {
+		os.MkdirAll(filepath.Join("output", dir), 0755)
+	}
+	os.WriteFile(filepath.Join("output", "ro-crate-Motet-Cycles-100", crateName), []byte("{}"), 0644)
+	if dir := latestCrate(testMeta); dir != filepath.Join("output", "ro-crate-Motet-Cycles-200") {
+		t.Errorf("latest crate not found: %q", dir)
+	}
+	os.RemoveAll(filepath.Join("output", "ro-crate-Motet-Cycles-200"))
+	if dir := latestCrate(testMeta); dir != filepath.Join("output", "ro-crate-Motet-Cycles-100") {
+		t.Errorf("finished crate should be reused: %q", dir)
+	}
+	incomplete := filepath.Join("output", "ro-crate-Motet-Cycles-300")
+	os.MkdirAll(incomplete, 0755)
+	os.WriteFile(filepath.Join(incomplete, crateName), []byte("{}"), 0644)
+	if incompleteCrate(incomplete) {
+		t.Errorf("crate without failed downloads reported as incomplete: %s", incomplete)
+	}
+	writeFailed(incomplete, []failedDownload{{URL: "https://example.com/M001.png", Part: "posters/M001.png"}})
+	if dir := latestCrate(testMeta); dir != incomplete || !incompleteCrate(dir) {
+		t.Errorf("crate with failed downloads should be resumed: %q", dir)
+	}
+	if dir := latestCrate(metaJSON{Name: "Other"}); dir != "" {
+		t.Errorf("crate of another collection should not be reused: %q", dir)
+	}
+}
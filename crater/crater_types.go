@@ -23,12 +23,15 @@ type files struct {
 	Type          string      `json:"@type,omitempty"`
 	ContentURL    string      `json:"contentUrl,omitempty"`
 	DatePublished string      `json:"datePublished,omitempty"`
+	DateModified  string      `json:"dateModified,omitempty"`
 	Description   string      `json:"description,omitempty"`
 	HasPart       []idPointer `json:"hasPart,omitempty"`
 	Identifier    string      `json:"identifier,omitempty"`
 	Keywords      []string    `json:"keywords,omitempty"`
-	License       string      `json:"license,omitempty"`
+	License       *idPointer  `json:"license,omitempty"`
+	Mentions      []idPointer `json:"mentions,omitempty"`
 	Publisher     []idPointer `json:"publisher,omitempty"`
+	ConformsTo    []idPointer `json:"conformsTo,omitempty"`
 }
 
 type org struct {
@@ -36,3 +39,103 @@ type org struct {
 	Type string `json:"@type,omitempty"`
 	Name string `json:"name,omitempty"`
 }
+
+type archivePart struct {
+	ID             string      `json:"@id"`
+	Type           string      `json:"@type"`
+	Name           string      `json:"name,omitempty"`
+	EncodingFormat string      `json:"encodingFormat,omitempty"`
+	ContentSize    string      `json:"contentSize,omitempty"`
+	HasPart        []idPointer `json:"hasPart,omitempty"`
+}
+
+type fileEntity struct {
+	ID             string     `json:"@id"`
+	Type           string     `json:"@type"`
+	Name           string     `json:"name,omitempty"`
+	ContentSize    string     `json:"contentSize,omitempty"`
+	EncodingFormat string     `json:"encodingFormat,omitempty"`
+	SHA256         string     `json:"sha256,omitempty"`
+	DateModified   string     `json:"dateModified,omitempty"`
+	ContentURL     string     `json:"contentUrl,omitempty"`
+	License        *idPointer `json:"license,omitempty"`
+}
+
+type recordEntity struct {
+	ID          string      `json:"@id"`
+	Type        string      `json:"@type"`
+	Name        string      `json:"name,omitempty"`
+	Description string      `json:"description,omitempty"`
+	License     *idPointer  `json:"license,omitempty"`
+	Publisher   string      `json:"publisher,omitempty"`
+	Identifier  []idPointer `json:"identifier,omitempty"`
+	SameAs      []idPointer `json:"sameAs,omitempty"`
+	URL         string      `json:"url,omitempty"`
+	Composer    []idPointer `json:"composer,omitempty"`
+	Author      []idPointer `json:"author,omitempty"`
+	Contributor []idPointer `json:"contributor,omitempty"`
+	SubjectOf   *idPointer  `json:"subjectOf,omitempty"`
+	Image       *idPointer  `json:"image,omitempty"`
+	HasPart     []idPointer `json:"hasPart,omitempty"`
+	IsPartOf    []idPointer `json:"isPartOf,omitempty"`
+	Citation    []idPointer `json:"citation,omitempty"`
+}
+
+type personEntity struct {
+	ID         string   `json:"@id"`
+	Type       string   `json:"@type"`
+	Name       string   `json:"name,omitempty"`
+	GivenName  string   `json:"givenName,omitempty"`
+	FamilyName string   `json:"familyName,omitempty"`
+	Identifier []string `json:"identifier,omitempty"`
+}
+
+type propertyValue struct {
+	ID         string `json:"@id"`
+	Type       string `json:"@type"`
+	PropertyID string `json:"propertyID"`
+	Value      string `json:"value"`
+	URL        string `json:"url,omitempty"`
+}
+
+type profileEntity struct {
+	ID      string   `json:"@id"`
+	Type    []string `json:"@type"`
+	Name    string   `json:"name,omitempty"`
+	Version string   `json:"version,omitempty"`
+}
+
+type createAction struct {
+	ID        string      `json:"@id"`
+	Type      string      `json:"@type"`
+	Name      string      `json:"name,omitempty"`
+	StartTime string      `json:"startTime,omitempty"`
+	EndTime   string      `json:"endTime,omitempty"`
+	Agent     idPointer   `json:"agent"`
+	Object    []idPointer `json:"object,omitempty"`
+	Result    []idPointer `json:"result,omitempty"`
+	URL       string      `json:"url,omitempty"`
+}
+
+// softwareApplication describes an app of the workflow. The commit
+// the app was built from is recorded as its identifier.
+type softwareApplication struct {
+	ID         string `json:"@id"`
+	Type       string `json:"@type"`
+	Name       string `json:"name,omitempty"`
+	Version    string `json:"version,omitempty"`
+	Identifier string `json:"identifier,omitempty"`
+}
+
+type workflowFile struct {
+	ID   string `json:"@id"`
+	Type string `json:"@type"`
+	Name string `json:"name,omitempty"`
+}
+
+type licenseEntity struct {
+	ID   string `json:"@id"`
+	Type string `json:"@type"`
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url,omitempty"`
+}
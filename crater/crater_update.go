@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ross-spencer/zenodocfl/internal/ocfl"
+	ro "github.com/ross-spencer/zenodocfl/internal/rocrate"
+)
+
+// existingCrate is what crater needs to know about a crate it is
+// updating.
+type existingCrate struct {
+	identifier    string
+	datePublished string
+	// files maps the parts of the crate to the URL they were
+	// downloaded from, if any.
+	files map[string]string
+	// hashes maps the parts of the crate to their SHA-256 digest.
+	hashes map[string]string
+	// entities are the File entities describing the parts.
+	entities map[string]fileEntity
+}
+
+// readExistingCrate reads the crate to update.
+func readExistingCrate(crateDir string) (existingCrate, error) {
+	existing := existingCrate{
+		files:    map[string]string{},
+		hashes:   map[string]string{},
+		entities: map[string]fileEntity{},
+	}
+	metadata, err := ro.Load(crateDir)
+	if err != nil {
+		return existing, err
+	}
+	root, ok := metadata.Root()
+	if !ok {
+		return existing, fmt.Errorf("crate has no root dataset: %s", crateDir)
+	}
+	if len(root.Identifier) > 0 {
+		existing.identifier = root.Identifier[0].String()
+	}
+	if existing.identifier == "" {
+		return existing, fmt.Errorf("crate has no identifier: %s", crateDir)
+	}
+	existing.datePublished = string(root.DatePublished)
+	for _, node := range metadata.Graph {
+		if node.HasType("File") && ro.IsDataPath(node.ID) {
+			existing.files[node.ID] = string(node.ContentURL)
+			existing.hashes[node.ID] = string(node.SHA256)
+		}
+	}
+	crate, err := ro.Read(crateDir)
+	if err != nil {
+		return existing, err
+	}
+	for _, entity := range crate.Graph {
+		if _, ok := existing.files[entity.ID()]; !ok {
+			continue
+		}
+		data, err := json.Marshal(entity)
+		if err != nil {
+			return existing, fmt.Errorf("error reading file entity: %w (%s)", err, entity.ID())
+		}
+		var file fileEntity
+		if err := json.Unmarshal(data, &file); err != nil {
+			return existing, fmt.Errorf("error reading file entity: %w (%s)", err, entity.ID())
+		}
+		existing.entities[file.ID] = file
+	}
+	return existing, nil
+}
+
+// holds reports whether the existing crate has a copy of a part on
+// disk.
+func (existing existingCrate) holds(crateDir string, part string) bool {
+	if _, ok := existing.entities[part]; !ok {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(crateDir, filepath.FromSlash(part)))
+	return err == nil
+}
+
+// keepStale describes the parts whose download failed, but which the
+// existing crate holds a copy of, as the existing crate did.
+func keepStale(files []fileEntity, existing existingCrate, downloads []downloadJob) {
+	for _, download := range downloads {
+		if !download.stale {
+			continue
+		}
+		idx := slices.IndexFunc(files, func(file fileEntity) bool { return file.ID == download.part })
+		if idx >= 0 {
+			files[idx] = existing.entities[download.part]
+		}
+	}
+}
+
+// unchanged reports whether a part was already downloaded from the
+// same URL and can be kept. If the crate recorded the part's digest
+// the file must still match it.
+func (existing existingCrate) unchanged(crateDir string, part string, url string) bool {
+	previous, ok := existing.files[part]
+	if !ok || previous != url {
+		return false
+	}
+	filePath := filepath.Join(crateDir, filepath.FromSlash(part))
+	if _, err := os.Stat(filePath); err != nil {
+		return false
+	}
+	if existing.hashes[part] == "" {
+		return true
+	}
+	digest, err := fileSHA256(filePath)
+	return err == nil && digest == existing.hashes[part]
+}
+
+// removeStale removes the files the crate described that are no longer
+// part of it, returning the parts removed.
+func removeStale(crateDir string, existing existingCrate, parts []string, dryrun bool) ([]string, error) {
+	removed := []string{}
+	stale := []string{}
+	for part := range existing.files {
+		if !slices.Contains(parts, part) {
+			stale = append(stale, part)
+		}
+	}
+	slices.Sort(stale)
+	for _, part := range stale {
+		removed = append(removed, part)
+		if dryrun {
+			continue
+		}
+		err := os.Remove(filepath.Join(crateDir, filepath.FromSlash(part)))
+		if err != nil && !os.IsNotExist(err) {
+			return removed, fmt.Errorf("error removing file: %w (%s)", err, part)
+		}
+	}
+	return removed, nil
+}
+
+// findObjectByID returns the path of the object in the storage root
+// for the crate with the given identifier or an empty string if there
+// isn't one.
+func findObjectByID(root string, id string) string {
+	if !ocfl.IsStorageRoot(root) {
+		return ""
+	}
+	storageRoot, err := ocfl.OpenStorageRoot(root)
+	if err != nil {
+		return ""
+	}
+	objectPath, err := storageRoot.ResolveObject(id)
+	if err != nil {
+		return ""
+	}
+	return objectPath
+}
+
+// latestCrate returns the most recent crate directory for the
+// collection so that it is updated in place, keeping its downloads, or
+// resumed if its run didn't finish. An empty string is returned if
+// there isn't one.
+func latestCrate(metaJSON metaJSON) string {
+	prefix := filepath.Join("output", fmt.Sprintf("ro-crate-%s-", crateSlug(metaJSON)))
+	matches, _ := filepath.Glob(prefix + "*")
+	latest, dir := int64(-1), ""
+	for _, match := range matches {
+		created, err := strconv.ParseInt(strings.TrimPrefix(match, prefix), 10, 64)
+		if err != nil || created <= latest {
+			continue
+		}
+		latest, dir = created, match
+	}
+	return dir
+}
+
+// incompleteCrate reports whether some of the crate's downloads failed
+// and are listed in its failed.jsonl.
+func incompleteCrate(crateDir string) bool {
+	_, err := os.Stat(filepath.Join(crateDir, failedName))
+	return err == nil
+}
+
+// updateStage prepares makeCrate to update the crate in crateDir,
+// keeping its identifier and publication date. A crate whose run
+// didn't finish, and so has no metadata yet, is resumed, as is one
+// with failed downloads, which are downloaded again.
+func updateStage(metaJSON *metaJSON, crateDir string) existingCrate {
+	if _, err := os.Stat(filepath.Join(crateDir, crateName)); os.IsNotExist(err) {
+		log.Printf("resuming unfinished crate: %s", crateDir)
+		return existingCrate{}
+	}
+	if incompleteCrate(crateDir) {
+		log.Printf("resuming incomplete crate, its failed downloads are retried: %s", crateDir)
+	}
+	existing, err := readExistingCrate(crateDir)
+	if err != nil {
+		log.Println("cannot update crate:", err)
+		os.Exit(1)
+	}
+	log.Printf("updating crate: %s (%s)", existing.identifier, crateDir)
+	metaJSON.identifier = existing.identifier
+	metaJSON.datePublished = existing.datePublished
+	metaJSON.dateModified = time.Now().UTC().Format(time.RFC3339)
+	return existing
+}
+
+// publishedDate returns the date the crate was first published, or
+// today for a new crate.
+func publishedDate(metaJSON metaJSON) string {
+	if metaJSON.datePublished != "" {
+		return metaJSON.datePublished
+	}
+	return makePublishedDate()
+}
+
+// updateFiles removes the files dropped from an updated crate and
+// summarises what changed.
+func updateFiles(crateDir string, existing existingCrate, parts []string, dryrun bool) {
+	removed, err := removeStale(crateDir, existing, parts, dryrun)
+	if err != nil {
+		log.Println("cannot update crate:", err)
+		os.Exit(1)
+	}
+	added := 0
+	for _, part := range parts {
+		if _, ok := existing.files[part]; !ok {
+			added++
+		}
+	}
+	log.Printf("crate updated: %d files added, %d kept or replaced, %d removed", added, len(parts)-added, len(removed))
+}
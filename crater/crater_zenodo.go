@@ -0,0 +1,291 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ross-spencer/zenodocfl/internal/types"
+	"github.com/ross-spencer/zenodocfl/internal/zenodo"
+)
+
+// zenodoURL returns the base URL of the Zenodo instance selected by
+// the user.
+func zenodoURL() string {
+	if zenodoBase != "" {
+		return zenodoBase
+	}
+	if sandbox {
+		return zenodo.SandboxURL
+	}
+	return zenodo.ProductionURL
+}
+
+// zenodoKey returns the file name used for a crate part in a
+// deposition. Zenodo does not support directories so the crate's
+// structure is flattened.
+func zenodoKey(part string) string {
+	return strings.ReplaceAll(part, "/", "_")
+}
+
+// depositFiles describes the files uploaded to a deposition relative
+// to the directory they are found in.
+type depositFiles struct {
+	dir   string
+	files []string
+}
+
+// crateFiles returns every part of the crate, including the RO-CRATE
+// metadata and preview, for upload.
+func crateFiles(metaJSON metaJSON, crateDir string) depositFiles {
+	files := slices.Clone(metaJSON.parts)
+	return depositFiles{dir: crateDir, files: append(files, metadataFiles(crateDir)...)}
+}
+
+// depositCrate uploads every part of the crate to a new deposition
+// and sets its metadata. The deposition is published if requested.
+func depositCrate(client *zenodo.Client, metadata zenodo.Metadata, upload depositFiles, publish bool) (zenodo.Deposition, error) {
+	dep, err := client.CreateDeposition()
+	if err != nil {
+		return dep, fmt.Errorf("cannot create deposition: %w", err)
+	}
+	log.Printf("zenodo deposition: %d (%s)", dep.ID, dep.Links.HTML)
+	for _, part := range upload.files {
+		if debug {
+			log.Println("uploading:", part)
+		}
+		_, err := client.UploadFile(dep.Links.Bucket, zenodoKey(part), filepath.Join(upload.dir, filepath.FromSlash(part)))
+		if err != nil {
+			return dep, fmt.Errorf("cannot upload crate part: %w (%s)", err, part)
+		}
+	}
+	dep, err = client.UpdateMetadata(dep.ID, metadata)
+	if err != nil {
+		return dep, fmt.Errorf("cannot set deposition metadata: %w", err)
+	}
+	if !publish {
+		return dep, nil
+	}
+	dep, err = client.Publish(dep.ID)
+	if err != nil {
+		return dep, fmt.Errorf("cannot publish deposition: %w", err)
+	}
+	return dep, nil
+}
+
+// zenodoState records the deposition belonging to a collection so
+// that later runs can publish new versions of the same record.
+type zenodoState struct {
+	BaseURL      string `json:"base_url"`
+	DepositionID int    `json:"deposition_id"`
+	ConceptRecID string `json:"concept_rec_id"`
+	DOI          string `json:"doi,omitempty"`
+	ConceptDOI   string `json:"concept_doi,omitempty"`
+	Published    bool   `json:"published"`
+	URL          string `json:"url,omitempty"`
+	Updated      string `json:"updated"`
+}
+
+// zenodoStatePath returns the path of the state file kept next to the
+// crates created for a collection.
+func zenodoStatePath(dir string, metaJSON metaJSON) string {
+	return filepath.Join(filepath.Dir(dir), fmt.Sprintf("zenodo-%s.json", crateSlug(metaJSON)))
+}
+
+// readZenodoState reads the state file for a collection. An empty
+// state is returned if the collection hasn't been deposited before.
+func readZenodoState(path string) (zenodoState, error) {
+	var state zenodoState
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("error reading zenodo state: %w", err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("error parsing zenodo state: %w (%s)", err, path)
+	}
+	return state, nil
+}
+
+// writeZenodoState records a deposition in the collection's state
+// file.
+func writeZenodoState(path string, baseURL string, dep zenodo.Deposition) error {
+	state := zenodoState{
+		BaseURL:      baseURL,
+		DepositionID: dep.ID,
+		ConceptRecID: dep.ConceptRecID,
+		DOI:          dep.DOI,
+		ConceptDOI:   dep.ConceptDOI,
+		Published:    dep.Submitted,
+		URL:          dep.Links.HTML,
+		Updated:      time.Now().UTC().Format(time.RFC3339),
+	}
+	data, err := json.MarshalIndent(state, "", " ")
+	if err != nil {
+		return fmt.Errorf("error creating zenodo state: %w", err)
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// fileMD5 returns the hex encoded md5 checksum Zenodo uses for files.
+func fileMD5(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := md5.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// syncFiles makes the files of a draft deposition match the crate,
+// uploading only new or changed parts and removing parts that no
+// longer exist. The number of uploaded and removed files is returned.
+func syncFiles(client *zenodo.Client, draft zenodo.Deposition, upload depositFiles) (int, int, error) {
+	local := map[string]string{}
+	paths := map[string]string{}
+	for _, part := range upload.files {
+		path := filepath.Join(upload.dir, filepath.FromSlash(part))
+		checksum, err := fileMD5(path)
+		if err != nil {
+			return 0, 0, fmt.Errorf("cannot read crate part: %w (%s)", err, part)
+		}
+		local[zenodoKey(part)] = checksum
+		paths[zenodoKey(part)] = path
+	}
+	remote := map[string]string{}
+	removed := 0
+	for _, file := range draft.Files {
+		checksum, ok := local[file.Name()]
+		if ok && checksum == file.MD5() {
+			remote[file.Name()] = file.MD5()
+			continue
+		}
+		if err := client.DeleteFile(draft.ID, file.ID); err != nil {
+			return 0, removed, fmt.Errorf("cannot remove file from deposition: %w (%s)", err, file.Name())
+		}
+		removed++
+	}
+	uploaded := 0
+	for _, key := range slices.Sorted(maps.Keys(local)) {
+		if _, ok := remote[key]; ok {
+			continue
+		}
+		if debug {
+			log.Println("uploading:", key)
+		}
+		if _, err := client.UploadFile(draft.Links.Bucket, key, paths[key]); err != nil {
+			return uploaded, removed, fmt.Errorf("cannot upload crate part: %w (%s)", err, key)
+		}
+		uploaded++
+	}
+	return uploaded, removed, nil
+}
+
+// updateCrate publishes the crate as a new version of an existing
+// record, keeping the concept DOI stable. Only changed parts are
+// uploaded. An unpublished draft from an earlier run is reused.
+func updateCrate(client *zenodo.Client, state zenodoState, metadata zenodo.Metadata, upload depositFiles, publish bool) (zenodo.Deposition, error) {
+	previous, err := client.GetDeposition(state.DepositionID)
+	if err != nil {
+		return previous, fmt.Errorf("cannot retrieve deposition %d: %w", state.DepositionID, err)
+	}
+	draft := previous
+	if previous.Submitted {
+		draft, err = client.NewVersion(previous.ID)
+		if err != nil {
+			return draft, fmt.Errorf("cannot create new version of deposition %d: %w", previous.ID, err)
+		}
+		log.Printf("zenodo new version: %d (concept: %s)", draft.ID, draft.ConceptRecID)
+	} else {
+		log.Printf("zenodo reusing draft deposition: %d", draft.ID)
+	}
+	uploaded, removed, err := syncFiles(client, draft, upload)
+	if err != nil {
+		return draft, err
+	}
+	log.Printf("zenodo files uploaded: %d, removed: %d", uploaded, removed)
+	draft, err = client.UpdateMetadata(draft.ID, metadata)
+	if err != nil {
+		return draft, fmt.Errorf("cannot set deposition metadata: %w", err)
+	}
+	if !publish {
+		return draft, nil
+	}
+	draft, err = client.Publish(draft.ID)
+	if err != nil {
+		return draft, fmt.Errorf("cannot publish deposition: %w", err)
+	}
+	return draft, nil
+}
+
+// zenodoCrate deposits the crate on the Zenodo instance selected by
+// the user. If the collection has been deposited before a new version
+// of its record is created.
+func zenodoCrate(metaJSON metaJSON, items []types.Item, upload depositFiles, dryrun bool) {
+	metadata, problems := zenodoCrosswalk(metaJSON, items)
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			log.Printf("zenodo metadata: %s: %s", problem.Field, problem.Message)
+		}
+		log.Println("cannot deposit crate: zenodo metadata is invalid")
+		os.Exit(1)
+	}
+	if dryrun {
+		log.Println("dry-run: not depositing crate on:", zenodoURL())
+		return
+	}
+	token, err := zenodo.LoadToken(tokenFile)
+	if err != nil {
+		log.Println("cannot deposit crate:", err)
+		os.Exit(1)
+	}
+	statePath := zenodoStatePath(upload.dir, metaJSON)
+	state, err := readZenodoState(statePath)
+	if err != nil {
+		log.Println("cannot deposit crate:", err)
+		os.Exit(1)
+	}
+	if state.DepositionID != 0 && state.BaseURL != zenodoURL() {
+		log.Printf("zenodo state belongs to a different instance: %s (%s)", state.BaseURL, statePath)
+		os.Exit(1)
+	}
+	client := zenodo.NewClient(zenodoURL(), token)
+	client.UserAgent = agent
+	var dep zenodo.Deposition
+	if state.DepositionID != 0 {
+		dep, err = updateCrate(client, state, metadata, upload, publish)
+	} else {
+		dep, err = depositCrate(client, metadata, upload, publish)
+	}
+	if dep.ID != 0 {
+		if err := writeZenodoState(statePath, zenodoURL(), dep); err != nil {
+			log.Println("cannot record zenodo state:", err)
+		}
+		log.Println("zenodo state:", statePath)
+	}
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+	if dep.Submitted {
+		log.Printf("zenodo record published: %s (concept: %s)", dep.DOI, dep.ConceptDOI)
+		return
+	}
+	log.Printf("zenodo deposition ready for review: %s", dep.Links.HTML)
+}
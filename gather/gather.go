@@ -23,13 +23,16 @@ import (
 	"strings"
 	"time"
 
+	"github.com/ross-spencer/zenodocfl/internal/identifiers"
 	"github.com/ross-spencer/zenodocfl/internal/logformatter"
+	"github.com/ross-spencer/zenodocfl/internal/provenance"
 	"github.com/ross-spencer/zenodocfl/internal/types"
 )
 
 var (
 	download  string
 	allowlist string
+	pidConfig string
 	output    string
 	list      bool
 	vers      bool
@@ -43,10 +46,18 @@ var (
 
 var agent string = fmt.Sprintf("INK-gather/%s", version)
 
+// dataProvenance records the runs that produced the data directory.
+var dataProvenance string = filepath.Join("data", provenance.Ext)
+
+// registry holds the persistent identifier schemes recognised in the
+// extra metadata of INK records.
+var registry = identifiers.NewRegistry()
+
 // initFlags initializes the flags we use with this app.
 func initFlags() {
 	flag.StringVar(&download, "download", "", "download items in the given manifest")
 	flag.StringVar(&allowlist, "allowlist", "", "allowlist to compare against the manifest")
+	flag.StringVar(&pidConfig, "identifiers", "", "JSON config of additional identifier schemes")
 	flag.StringVar(&output, "o", "", "filename to output results to")
 	flag.BoolVar(&list, "list", false, "list records in the JSON directoru already downloaded")
 	flag.BoolVar(&debug, "debug", false, "debug logging")
@@ -193,9 +204,12 @@ func addItemMD(record inkRecord) (types.Item, error) {
 		return item, fmt.Errorf("cannot retrieve title from record")
 	}
 	item.Label = title
+	item.Signature = record.Base.Signature
+	item.Url = record.Base.Url
 	item.File = record.FileName
 	item.License = record.Base.License
 	item.Publisher = record.Base.Publisher
+	item.Type = record.Base.Type
 	item.Poster.Name = record.Base.Poster.Name
 	item.Poster.Url = convertMediaServerURI(record.Base.Poster.Url)
 	description, err := getDescription(record.Notes)
@@ -220,7 +234,9 @@ func addItemRelationships(item types.Item, record inkRecord) (types.Item, error)
 			return item, fmt.Errorf("cannot retrieve relationship title from record")
 		}
 		rel.Label = title
+		rel.Signature = value.Signature
 		rel.Url = value.Url
+		rel.Type = value.Type
 		rels = append(rels, rel)
 	}
 	item.Relationship = rels
@@ -245,26 +261,56 @@ func addMedia(item types.Item, record inkRecord) types.Item {
 }
 
 // addIdentifiers ensures identifiers are associated with the
-// record. These will all be displayed in the RO-CRATE.
+// record. These will all be displayed in the RO-CRATE. Only keys with
+// a scheme in the registry are identifiers, values that don't meet
+// their scheme's syntax are reported and left out.
 func addIdentifiers(item types.Item, record inkRecord) types.Item {
 	ids := []types.Identifier{}
 	for _, value := range record.Extra {
-		id := types.Identifier{}
-		switch value.Key {
-		case "ark":
-		case "handle":
-			id.Type = value.Key
-			id.Name = value.Value
-			id.Url = convertIdentifier(value.Key, value.Value)
-			ids = append(ids, id)
-		default:
+		if _, ok := registry.Lookup(value.Key); !ok {
+			continue
+		}
+		id, err := registry.Identifier(value.Key, value.Value)
+		if err != nil {
+			log.Printf("skipping identifier: %s (%s)", err, record.FileName)
 			continue
 		}
+		ids = append(ids, id)
 	}
 	item.Identifiers = ids
 	return item
 }
 
+// addPersons carries the persons associated with the record, and
+// their roles and identifiers, through to the collection.
+func addPersons(item types.Item, record inkRecord) types.Item {
+	persons := []types.Person{}
+	for _, value := range record.Base.Person {
+		if strings.TrimSpace(value.Name) == "" {
+			continue
+		}
+		person := types.Person{}
+		person.Name = strings.TrimSpace(value.Name)
+		person.Role = strings.TrimSpace(value.Role)
+		for _, personID := range value.Identifier {
+			id := types.Identifier{}
+			id.Type = personID.Type
+			id.Name = personID.Value
+			id.Url = personID.Url
+			if id.Url == "" && strings.HasPrefix(id.Name, "http") {
+				id.Url = id.Name
+			}
+			if id.Name == "" && id.Url == "" {
+				continue
+			}
+			person.Identifiers = append(person.Identifiers, id)
+		}
+		persons = append(persons, person)
+	}
+	item.Persons = persons
+	return item
+}
+
 // makeCollection returns a more complete collection manifest that can
 // be given to crater to create a RO-CRATE package.
 func makeCollection(manifest []inkRecord) types.Collection {
@@ -282,6 +328,7 @@ func makeCollection(manifest []inkRecord) types.Collection {
 		}
 		item = addMedia(item, record)
 		item = addIdentifiers(item, record)
+		item = addPersons(item, record)
 		item.Source = record.Source
 		collection.Items = append(collection.Items, item)
 	}
@@ -333,6 +380,21 @@ func listJSON() []inkRecord {
 	return manifest
 }
 
+// downloadProvenance records the download alongside the data, after
+// the lister run that produced the manifest, if it was recorded.
+func downloadProvenance(run provenance.Run, download string, allowlist string) {
+	runs, err := provenance.Read(provenance.Path(download))
+	if err != nil {
+		log.Println("problem reading provenance:", err)
+	}
+	run.Url = provenance.LastURL(runs)
+	run.AddInputs(download, allowlist)
+	run.Finish()
+	if err := provenance.Write(dataProvenance, append(runs, run)); err != nil {
+		log.Println("problem writing provenance:", err)
+	}
+}
+
 func main() {
 
 	logformatter.Set("gather", true)
@@ -347,6 +409,7 @@ func main() {
 		fmt.Fprintln(os.Stderr, "Usage:  ")
 		fmt.Fprintln(os.Stderr, "        REQUIRED: [-download]  STRING | [-list] BOOL")
 		fmt.Fprintln(os.Stderr, "        OPTIONAL: [-allowlist] STRING")
+		fmt.Fprintln(os.Stderr, "        OPTIONAL: [-identifiers] STRING")
 		fmt.Fprintln(os.Stderr, "        OPTIONAL: [-version] ")
 		fmt.Fprintln(os.Stderr, "        OPTIONAL: [-o] ")
 		fmt.Fprintln(os.Stderr, "")
@@ -362,15 +425,29 @@ func main() {
 		return
 	}
 
+	if pidConfig != "" {
+		if err := registry.LoadConfig(pidConfig); err != nil {
+			log.Println("cannot load identifier schemes:", err)
+			os.Exit(1)
+		}
+	}
+
 	if download != "" {
+		run := provenance.Start("INK-gather", version, commit)
 		files := downloadManifest(download, allowlist)
 		downloadFiles(files)
+		downloadProvenance(run, download, allowlist)
 		return
 	}
 
 	if list {
 		manifest := listJSON()
 		collection := makeCollection(manifest)
+		runs, err := provenance.Read(dataProvenance)
+		if err != nil {
+			log.Println("problem reading provenance:", err)
+		}
+		collection.Provenance = runs
 		printCollection(collection, output)
 		return
 	}
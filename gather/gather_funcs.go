@@ -43,21 +43,3 @@ func convertMediaServerURI(url string) string {
 	const newPrefix string = "https://ba14ns21403-sec1.fhnw.ch/mediasrv/"
 	return fmt.Sprintf("%s/master", strings.Replace(url, oldPrefix, newPrefix, 1))
 }
-
-// convertIdentifier creates a URL from a given identivier.
-func convertIdentifier(key string, value string) string {
-	/*
-	   ark: 	ark:/15737/p658-sjm6-66z4 == https://n2t.net/ark:/15737/p658-sjm6-66z4
-	   handle: 	20.500.11806/med/3jzx-tf3s-g1 == https://hdl.handle.net/20.500.11806/med/3jzx-tf3s-g1
-	*/
-
-	switch key {
-	case "ark":
-		return fmt.Sprintf("https://n2t.net/%s", value)
-	case "handle":
-		return fmt.Sprintf("https://hdl.handle.net/%s", value)
-	default:
-		log.Println("unknown identifier type:", key)
-	}
-	return value
-}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/ross-spencer/zenodocfl/internal/types"
@@ -61,16 +62,34 @@ func TestConvertIdentifier(t *testing.T) {
 	inputKey := "ark"
 	inputValue := "ark:/15737/p655-cz83-8mxn"
 	outputValue := "https://n2t.net/ark:/15737/p655-cz83-8mxn"
-	res := convertIdentifier(inputKey, inputValue)
-	if res != outputValue {
-		t.Errorf("ark conversion failed: '%s' expected: '%s'", res, outputValue)
+	res, err := registry.Identifier(inputKey, inputValue)
+	if err != nil || res.Url != outputValue {
+		t.Errorf("ark conversion failed: '%s' expected: '%s' (%v)", res.Url, outputValue, err)
 	}
 	inputKey = "handle"
 	inputValue = "20.500.11806/med/3h1x-65hq-1w"
 	outputValue = "https://hdl.handle.net/20.500.11806/med/3h1x-65hq-1w"
-	res = convertIdentifier(inputKey, inputValue)
-	if res != outputValue {
-		t.Errorf("handle conversion failed: '%s' expected: '%s'", res, outputValue)
+	res, err = registry.Identifier(inputKey, inputValue)
+	if err != nil || res.Url != outputValue {
+		t.Errorf("handle conversion failed: '%s' expected: '%s' (%v)", res.Url, outputValue, err)
+	}
+}
+
+func TestAddIdentifiers(t *testing.T) {
+	record := inkRecord{
+		Extra: []extra{
+			{Key: "ark", Value: "ark:/15737/p655-cz83-8mxn"},
+			{Key: "handle", Value: "20.500.11806/med/3h1x-65hq-1w"},
+			{Key: "doi", Value: "not-a-doi"},
+			{Key: "shelfmark", Value: "MS 123"},
+		},
+	}
+	item := addIdentifiers(types.Item{}, record)
+	if len(item.Identifiers) != 2 {
+		t.Fatalf("expected the ark and handle only: %+v", item.Identifiers)
+	}
+	if item.Identifiers[0].Type != "ark" || item.Identifiers[0].Name != "ark:/15737/p655-cz83-8mxn" {
+		t.Errorf("ark not added: %+v", item.Identifiers[0])
 	}
 }
 
@@ -112,3 +131,58 @@ func TestGetURLS(t *testing.T) {
 		t.Errorf("urls length should be two: %d", len(collection.PosterURLs))
 	}
 }
+
+func TestPersons(t *testing.T) {
+	record, _, _ := readJSON("testdata/m001.json")
+	item := addPersons(types.Item{}, record)
+	if len(item.Persons) != 1 {
+		t.Fatalf("persons not carried through: %+v", item.Persons)
+	}
+	if item.Persons[0].Name != "Gaffurius, Franchinus" || item.Persons[0].Role != "Composer" {
+		t.Errorf("person incorrect: %+v", item.Persons[0])
+	}
+	data := []byte(`{"base": {"person": [
+		{"name": "Cassia, Cristina", "role": "author", "identifier": ["https://orcid.org/0000-0002-1825-0097"]},
+		{"name": "Pavanello, Agnese", "role": "author", "identifier": [{"type": "gnd", "value": "1012345678"}]},
+		{"name": "", "role": "author", "identifier": []}
+	]}}`)
+	if err := json.Unmarshal(data, &record); err != nil {
+		t.Fatal(err)
+	}
+	item = addPersons(types.Item{}, record)
+	if len(item.Persons) != 2 {
+		t.Fatalf("persons without names should be skipped: %+v", item.Persons)
+	}
+	orcid := item.Persons[0].Identifiers
+	if len(orcid) != 1 || orcid[0].Url != "https://orcid.org/0000-0002-1825-0097" {
+		t.Errorf("string identifier not carried through: %+v", orcid)
+	}
+	gnd := item.Persons[1].Identifiers
+	if len(gnd) != 1 || gnd[0].Type != "gnd" || gnd[0].Name != "1012345678" {
+		t.Errorf("object identifier not carried through: %+v", gnd)
+	}
+}
+
+// TestRecordTypes ensures the INK types of a record and its related
+// records are carried through so the direction of a relationship can
+// be determined.
+func TestRecordTypes(t *testing.T) {
+	record, _, _ := readJSON("testdata/m001.json")
+	item, err := addItemMD(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item, err = addItemRelationships(item, record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Type != "motet" || len(item.Relationship) == 0 || item.Relationship[0].Type != "" {
+		t.Errorf("motet types not carried through: %s %+v", item.Type, item.Relationship)
+	}
+	record, _, _ = readJSON("testdata/c02.json")
+	item, _ = addItemMD(record)
+	item, _ = addItemRelationships(item, record)
+	if item.Type != "" || len(item.Relationship) == 0 || item.Relationship[0].Type != "motet" {
+		t.Errorf("cycle types not carried through: %s %+v", item.Type, item.Relationship)
+	}
+}
@@ -3,6 +3,8 @@
 
 package main
 
+import "encoding/json"
+
 type title struct {
 	Lang  string `json:"lang"`
 	Value string `json:"value"`
@@ -13,12 +15,44 @@ type base struct {
 	Title []title `json:"title"`
 	// Signature / slug of the record.
 	Signature string `json:"signature"`
+	// Url of the record outside of INK.
+	Url string `json:"url"`
 	// License belonging to the item.
 	License string `json:"license"`
 	// Publisher is the item's publisher.
 	Publisher string `json:"publisher"`
+	// Type of the record, e.g. motet. Cycles and other collections
+	// have no type.
+	Type string `json:"type"`
 	// Poster belonging to the main item.
 	Poster poster `json:"poster"`
+	// Person lists composers, authors and other contributors.
+	Person []person `json:"person"`
+}
+
+type person struct {
+	Name       string             `json:"name"`
+	Role       string             `json:"role"`
+	Identifier []personIdentifier `json:"identifier"`
+}
+
+// personIdentifier identifies a person, e.g. through GND or ORCID.
+// INK provides these either as a plain string or as an object.
+type personIdentifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+	Url   string `json:"url"`
+}
+
+// UnmarshalJSON accepts identifiers given as strings or objects.
+func (id *personIdentifier) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err == nil {
+		id.Value = value
+		return nil
+	}
+	type plain personIdentifier
+	return json.Unmarshal(data, (*plain)(id))
 }
 
 type poster struct {
@@ -30,6 +64,7 @@ type references struct {
 	Signature string  `json:"signature"`
 	Title     []title `json:"title"`
 	Url       string  `json:"url"`
+	Type      string  `json:"type"`
 	Poster    poster  `json:"poster"`
 	License   string  `json:"license"`
 	Media     media   `json:"media"`
@@ -3,7 +3,7 @@ module github.com/ross-spencer/zenodocfl
 go 1.25
 
 require (
-	github.com/matoous/go-nanoid/v2 v2.1.0
 	github.com/oklog/ulid/v2 v2.1.1
 	golang.org/x/net v0.48.0
+	golang.org/x/text v0.32.0
 )
@@ -0,0 +1,223 @@
+/*
+Package datacite provides types for the DataCite Metadata Schema 4.5
+and renders them as XML.
+
+See: https://schema.datacite.org/meta/kernel-4.5/
+*/
+package datacite
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+// Namespace and schema location of the DataCite 4.5 kernel.
+const (
+	Namespace      string = "http://datacite.org/schema/kernel-4"
+	SchemaLocation string = "http://schema.datacite.org/meta/kernel-4.5/metadata.xsd"
+	xsiNamespace   string = "http://www.w3.org/2001/XMLSchema-instance"
+)
+
+// Identifier is the DOI of the resource.
+type Identifier struct {
+	Type  string `xml:"identifierType,attr"`
+	Value string `xml:",chardata"`
+}
+
+// NameIdentifier uniquely identifies a creator or contributor, e.g.
+// through ROR or ORCID.
+type NameIdentifier struct {
+	Scheme    string `xml:"nameIdentifierScheme,attr"`
+	SchemeURI string `xml:"schemeURI,attr,omitempty"`
+	Value     string `xml:",chardata"`
+}
+
+// CreatorName is the name of a creator and whether it is a person or
+// an organization.
+type CreatorName struct {
+	NameType string `xml:"nameType,attr,omitempty"`
+	Value    string `xml:",chardata"`
+}
+
+// Creator is the main researcher or organization involved in
+// producing the resource.
+type Creator struct {
+	Name            CreatorName      `xml:"creatorName"`
+	GivenName       string           `xml:"givenName,omitempty"`
+	FamilyName      string           `xml:"familyName,omitempty"`
+	NameIdentifiers []NameIdentifier `xml:"nameIdentifier,omitempty"`
+}
+
+// Title is a name by which the resource is known.
+type Title struct {
+	Type  string `xml:"titleType,attr,omitempty"`
+	Lang  string `xml:"xml:lang,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+// Publisher is the entity that holds, archives, publishes or
+// distributes the resource.
+type Publisher struct {
+	Identifier       string `xml:"publisherIdentifier,attr,omitempty"`
+	IdentifierScheme string `xml:"publisherIdentifierScheme,attr,omitempty"`
+	SchemeURI        string `xml:"schemeURI,attr,omitempty"`
+	Value            string `xml:",chardata"`
+}
+
+// Subject is a keyword or classification code describing the
+// resource.
+type Subject struct {
+	Scheme string `xml:"subjectScheme,attr,omitempty"`
+	Value  string `xml:",chardata"`
+}
+
+// ResourceType describes the type of the resource. The general type
+// is taken from a controlled list.
+type ResourceType struct {
+	General string `xml:"resourceTypeGeneral,attr"`
+	Value   string `xml:",chardata"`
+}
+
+// Date is a date relevant to the resource.
+type Date struct {
+	Type  string `xml:"dateType,attr"`
+	Value string `xml:",chardata"`
+}
+
+// AlternateIdentifier is an identifier other than the DOI.
+type AlternateIdentifier struct {
+	Type  string `xml:"alternateIdentifierType,attr"`
+	Value string `xml:",chardata"`
+}
+
+// RelatedIdentifier identifies a resource related to this one.
+type RelatedIdentifier struct {
+	Type         string `xml:"relatedIdentifierType,attr"`
+	RelationType string `xml:"relationType,attr"`
+	Value        string `xml:",chardata"`
+}
+
+// Rights describes the license of the resource.
+type Rights struct {
+	URI              string `xml:"rightsURI,attr,omitempty"`
+	Identifier       string `xml:"rightsIdentifier,attr,omitempty"`
+	IdentifierScheme string `xml:"rightsIdentifierScheme,attr,omitempty"`
+	SchemeURI        string `xml:"schemeURI,attr,omitempty"`
+	Value            string `xml:",chardata"`
+}
+
+// Description is a free text description of the resource.
+type Description struct {
+	Type  string `xml:"descriptionType,attr"`
+	Value string `xml:",chardata"`
+}
+
+// Resource is the root of a DataCite metadata record.
+type Resource struct {
+	Identifier           *Identifier
+	Creators             []Creator
+	Titles               []Title
+	Publisher            Publisher
+	PublicationYear      string
+	ResourceType         ResourceType
+	Subjects             []Subject
+	Dates                []Date
+	AlternateIdentifiers []AlternateIdentifier
+	RelatedIdentifiers   []RelatedIdentifier
+	Formats              []string
+	RightsList           []Rights
+	Descriptions         []Description
+}
+
+// resourceXML is the XML document for a resource. Optional wrapper
+// elements are pointers so that they are left out when empty.
+type resourceXML struct {
+	XMLName              xml.Name      `xml:"resource"`
+	Xmlns                string        `xml:"xmlns,attr"`
+	XmlnsXSI             string        `xml:"xmlns:xsi,attr"`
+	SchemaLocation       string        `xml:"xsi:schemaLocation,attr"`
+	Identifier           *Identifier   `xml:"identifier,omitempty"`
+	Creators             []Creator     `xml:"creators>creator"`
+	Titles               []Title       `xml:"titles>title"`
+	Publisher            Publisher     `xml:"publisher"`
+	PublicationYear      string        `xml:"publicationYear"`
+	ResourceType         ResourceType  `xml:"resourceType"`
+	Subjects             *subjects     `xml:"subjects,omitempty"`
+	Dates                *dates        `xml:"dates,omitempty"`
+	AlternateIdentifiers *alternates   `xml:"alternateIdentifiers,omitempty"`
+	RelatedIdentifiers   *related      `xml:"relatedIdentifiers,omitempty"`
+	Formats              *formats      `xml:"formats,omitempty"`
+	RightsList           *rightsList   `xml:"rightsList,omitempty"`
+	Descriptions         *descriptions `xml:"descriptions,omitempty"`
+}
+
+type subjects struct {
+	Subject []Subject `xml:"subject"`
+}
+
+type dates struct {
+	Date []Date `xml:"date"`
+}
+
+type alternates struct {
+	AlternateIdentifier []AlternateIdentifier `xml:"alternateIdentifier"`
+}
+
+type related struct {
+	RelatedIdentifier []RelatedIdentifier `xml:"relatedIdentifier"`
+}
+
+type formats struct {
+	Format []string `xml:"format"`
+}
+
+type rightsList struct {
+	Rights []Rights `xml:"rights"`
+}
+
+type descriptions struct {
+	Description []Description `xml:"description"`
+}
+
+// wrap returns a wrapper element for a list or nil if the list is
+// empty.
+func wrap[T any, W any](list []T, wrapper func([]T) W) *W {
+	if len(list) == 0 {
+		return nil
+	}
+	wrapped := wrapper(list)
+	return &wrapped
+}
+
+// XML renders a complete DataCite XML document for the resource.
+func (resource Resource) XML() ([]byte, error) {
+	doc := resourceXML{
+		Xmlns:           Namespace,
+		XmlnsXSI:        xsiNamespace,
+		SchemaLocation:  fmt.Sprintf("%s %s", Namespace, SchemaLocation),
+		Identifier:      resource.Identifier,
+		Creators:        resource.Creators,
+		Titles:          resource.Titles,
+		Publisher:       resource.Publisher,
+		PublicationYear: resource.PublicationYear,
+		ResourceType:    resource.ResourceType,
+		Subjects:        wrap(resource.Subjects, func(list []Subject) subjects { return subjects{list} }),
+		Dates:           wrap(resource.Dates, func(list []Date) dates { return dates{list} }),
+		AlternateIdentifiers: wrap(resource.AlternateIdentifiers, func(list []AlternateIdentifier) alternates {
+			return alternates{list}
+		}),
+		RelatedIdentifiers: wrap(resource.RelatedIdentifiers, func(list []RelatedIdentifier) related {
+			return related{list}
+		}),
+		Formats:      wrap(resource.Formats, func(list []string) formats { return formats{list} }),
+		RightsList:   wrap(resource.RightsList, func(list []Rights) rightsList { return rightsList{list} }),
+		Descriptions: wrap(resource.Descriptions, func(list []Description) descriptions { return descriptions{list} }),
+	}
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error creating datacite xml: %w", err)
+	}
+	out := []byte(xml.Header)
+	out = append(out, data...)
+	return append(out, '\n'), nil
+}
@@ -0,0 +1,101 @@
+package datacite
+
+import (
+	"encoding/xml"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testResource returns a resource that meets the rule set.
+func testResource() Resource {
+	return Resource{
+		Identifier: &Identifier{Type: "DOI", Value: "10.5072/zenodo.1234"},
+		Creators: []Creator{
+			{
+				Name: CreatorName{NameType: "Organizational", Value: "FHNW"},
+				NameIdentifiers: []NameIdentifier{
+					{Scheme: "ROR", SchemeURI: "https://ror.org", Value: "https://ror.org/04mq2g308"},
+				},
+			},
+		},
+		Titles:             []Title{{Value: "Motet Cycles"}},
+		Publisher:          Publisher{Value: "FHNW"},
+		PublicationYear:    "2026",
+		ResourceType:       ResourceType{General: "Dataset", Value: "Dataset"},
+		Subjects:           []Subject{{Value: "motet"}},
+		RelatedIdentifiers: []RelatedIdentifier{{Type: "ARK", RelationType: "HasPart", Value: "ark:/15737/p657"}},
+	}
+}
+
+// TestXML ensures a resource is rendered in the DataCite namespace and
+// that empty optional wrappers are left out.
+func TestXML(t *testing.T) {
+	data, err := testResource().XML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := string(data)
+	for _, expected := range []string{
+		`<resource xmlns="http://datacite.org/schema/kernel-4"`,
+		`xsi:schemaLocation="http://datacite.org/schema/kernel-4 http://schema.datacite.org/meta/kernel-4.5/metadata.xsd"`,
+		`<identifier identifierType="DOI">10.5072/zenodo.1234</identifier>`,
+		`<nameIdentifier nameIdentifierScheme="ROR" schemeURI="https://ror.org">https://ror.org/04mq2g308</nameIdentifier>`,
+		`<relatedIdentifier relatedIdentifierType="ARK" relationType="HasPart">ark:/15737/p657</relatedIdentifier>`,
+	} {
+		if !strings.Contains(doc, expected) {
+			t.Errorf("xml does not contain: %s\n%s", expected, doc)
+		}
+	}
+	if strings.Contains(doc, "<rightsList>") || strings.Contains(doc, "<dates>") {
+		t.Errorf("empty wrappers should be left out:\n%s", doc)
+	}
+	var parsed struct {
+		XMLName xml.Name
+		Titles  []string `xml:"titles>title"`
+	}
+	if err := xml.Unmarshal(data, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if parsed.XMLName.Space != Namespace || !slices.Equal(parsed.Titles, []string{"Motet Cycles"}) {
+		t.Errorf("xml not parsed as expected: %+v", parsed)
+	}
+}
+
+var validateTests = []struct {
+	name   string
+	damage func(*Resource)
+	field  string
+}{
+	{"no identifier", func(res *Resource) { res.Identifier = nil }, "identifier"},
+	{"not a doi", func(res *Resource) { res.Identifier.Value = "ark:/1234" }, "identifier"},
+	{"no creators", func(res *Resource) { res.Creators = nil }, "creators/creator"},
+	{"no title", func(res *Resource) { res.Titles = nil }, "titles/title"},
+	{"no publisher", func(res *Resource) { res.Publisher = Publisher{} }, "publisher"},
+	{"bad year", func(res *Resource) { res.PublicationYear = "26" }, "publicationYear"},
+	{"no general type", func(res *Resource) { res.ResourceType.General = "" }, "resourceType/@resourceTypeGeneral"},
+	{"unknown general type", func(res *Resource) { res.ResourceType.General = "Motet" }, "resourceType/@resourceTypeGeneral"},
+	{"unknown name type", func(res *Resource) { res.Creators[0].Name.NameType = "Band" }, "creators/creator[0]/creatorName/@nameType"},
+	{"unknown relation", func(res *Resource) { res.RelatedIdentifiers[0].RelationType = "hasPart" }, "relatedIdentifiers/relatedIdentifier[0]/@relationType"},
+	{"no relation", func(res *Resource) { res.RelatedIdentifiers[0].RelationType = "" }, "relatedIdentifiers/relatedIdentifier[0]/@relationType"},
+	{"no date type", func(res *Resource) { res.Dates = []Date{{Value: "2026-01-01"}} }, "dates/date[0]/@dateType"},
+}
+
+// TestValidate ensures the rule set reports the offending element or
+// attribute.
+func TestValidate(t *testing.T) {
+	if problems := testResource().Validate(); len(problems) > 0 {
+		t.Fatalf("unexpected problems: %v", problems)
+	}
+	for _, test := range validateTests {
+		resource := testResource()
+		test.damage(&resource)
+		fields := []string{}
+		for _, problem := range resource.Validate() {
+			fields = append(fields, problem.Field)
+		}
+		if !slices.Contains(fields, test.field) {
+			t.Errorf("%s: problem not reported for: %s (%v)", test.name, test.field, fields)
+		}
+	}
+}
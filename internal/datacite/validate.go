@@ -0,0 +1,198 @@
+package datacite
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// rulesJSON is a rule set derived from the DataCite 4.5 XSD covering
+// the mandatory properties, value patterns, required attributes and
+// controlled vocabularies.
+//
+//go:embed rules.json
+var rulesJSON []byte
+
+// Rules describes the constraints a resource is validated against.
+// Paths are element paths relative to the resource element and
+// attributes are addressed as "path/@attribute".
+type Rules struct {
+	Schema       string              `json:"schema"`
+	Required     []string            `json:"required"`
+	Patterns     map[string]string   `json:"patterns"`
+	Attributes   map[string][]string `json:"attributes"`
+	Vocabularies map[string][]string `json:"vocabularies"`
+}
+
+// Problem describes a single way in which a resource does not meet
+// the rule set.
+type Problem struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (problem Problem) String() string {
+	return fmt.Sprintf("%s: %s", problem.Field, problem.Message)
+}
+
+// LoadRules returns the embedded rule set.
+func LoadRules() (Rules, error) {
+	var rules Rules
+	if err := json.Unmarshal(rulesJSON, &rules); err != nil {
+		return rules, fmt.Errorf("error parsing datacite rules: %w", err)
+	}
+	return rules, nil
+}
+
+// node is a single element of a resource with its attributes.
+type node struct {
+	path  string
+	field string
+	value string
+	attrs map[string]string
+}
+
+// nodes flattens a resource into its elements so that the rules can
+// be applied by path.
+func (resource Resource) nodes() []node {
+	nodes := []node{}
+	add := func(path string, idx int, value string, attrs map[string]string) {
+		field := path
+		if idx >= 0 {
+			field = fmt.Sprintf("%s[%d]", path, idx)
+		}
+		nodes = append(nodes, node{path: path, field: field, value: value, attrs: attrs})
+	}
+	if resource.Identifier != nil {
+		add("identifier", -1, resource.Identifier.Value, map[string]string{
+			"identifierType": resource.Identifier.Type,
+		})
+	}
+	for idx, creator := range resource.Creators {
+		add("creators/creator", idx, creator.Name.Value, nil)
+		field := fmt.Sprintf("creators/creator[%d]", idx)
+		if creator.Name.Value != "" {
+			nodes = append(nodes, node{
+				path:  "creators/creator/creatorName",
+				field: field + "/creatorName",
+				value: creator.Name.Value,
+				attrs: map[string]string{"nameType": creator.Name.NameType},
+			})
+		}
+		for nameIdx, nameID := range creator.NameIdentifiers {
+			nodes = append(nodes, node{
+				path:  "creators/creator/nameIdentifier",
+				field: fmt.Sprintf("%s/nameIdentifier[%d]", field, nameIdx),
+				value: nameID.Value,
+				attrs: map[string]string{"nameIdentifierScheme": nameID.Scheme},
+			})
+		}
+	}
+	for idx, title := range resource.Titles {
+		add("titles/title", idx, title.Value, map[string]string{"titleType": title.Type})
+	}
+	if resource.Publisher.Value != "" {
+		add("publisher", -1, resource.Publisher.Value, nil)
+	}
+	if resource.PublicationYear != "" {
+		add("publicationYear", -1, resource.PublicationYear, nil)
+	}
+	if resource.ResourceType.General != "" || resource.ResourceType.Value != "" {
+		add("resourceType", -1, resource.ResourceType.Value, map[string]string{
+			"resourceTypeGeneral": resource.ResourceType.General,
+		})
+	}
+	for idx, subject := range resource.Subjects {
+		add("subjects/subject", idx, subject.Value, nil)
+	}
+	for idx, date := range resource.Dates {
+		add("dates/date", idx, date.Value, map[string]string{"dateType": date.Type})
+	}
+	for idx, alt := range resource.AlternateIdentifiers {
+		add("alternateIdentifiers/alternateIdentifier", idx, alt.Value, map[string]string{
+			"alternateIdentifierType": alt.Type,
+		})
+	}
+	for idx, rel := range resource.RelatedIdentifiers {
+		add("relatedIdentifiers/relatedIdentifier", idx, rel.Value, map[string]string{
+			"relatedIdentifierType": rel.Type,
+			"relationType":          rel.RelationType,
+		})
+	}
+	for idx, rights := range resource.RightsList {
+		add("rightsList/rights", idx, rights.Value, nil)
+	}
+	for idx, desc := range resource.Descriptions {
+		add("descriptions/description", idx, desc.Value, map[string]string{"descriptionType": desc.Type})
+	}
+	return nodes
+}
+
+// Validate checks a resource against the embedded rule set. Every
+// problem names the offending element or attribute.
+func (resource Resource) Validate() []Problem {
+	rules, err := LoadRules()
+	if err != nil {
+		return []Problem{{Field: "rules", Message: err.Error()}}
+	}
+	return rules.Validate(resource)
+}
+
+// Validate checks a resource against the rule set.
+func (rules Rules) Validate(resource Resource) []Problem {
+	problems := []Problem{}
+	fail := func(field string, format string, args ...any) {
+		problems = append(problems, Problem{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+	nodes := resource.nodes()
+	for _, required := range rules.Required {
+		path, attr, _ := strings.Cut(required, "/@")
+		found := false
+		for _, node := range nodes {
+			if node.path != path {
+				continue
+			}
+			if attr == "" && strings.TrimSpace(node.value) != "" || attr != "" && node.attrs[attr] != "" {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail(required, "required by the schema")
+		}
+	}
+	for _, path := range slices.Sorted(maps.Keys(rules.Patterns)) {
+		pattern, err := regexp.Compile(rules.Patterns[path])
+		if err != nil {
+			fail(path, "invalid pattern in rule set: %s", err)
+			continue
+		}
+		for _, node := range nodes {
+			if node.path == path && node.value != "" && !pattern.MatchString(node.value) {
+				fail(node.field, "value does not match %s: '%s'", pattern, node.value)
+			}
+		}
+	}
+	for _, node := range nodes {
+		for _, attr := range rules.Attributes[node.path] {
+			if node.attrs[attr] == "" {
+				fail(fmt.Sprintf("%s/@%s", node.field, attr), "attribute is required")
+			}
+		}
+		for _, attr := range slices.Sorted(maps.Keys(node.attrs)) {
+			value := node.attrs[attr]
+			vocabulary, ok := rules.Vocabularies[attr]
+			if !ok || value == "" {
+				continue
+			}
+			if !slices.Contains(vocabulary, value) {
+				fail(fmt.Sprintf("%s/@%s", node.field, attr), "value is not in the controlled list: '%s'", value)
+			}
+		}
+	}
+	return problems
+}
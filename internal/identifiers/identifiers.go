@@ -0,0 +1,157 @@
+/*
+Package identifiers provides a registry of the persistent identifier
+schemes found in INK records. Each scheme has a syntax check and a
+resolver URL template. Schemes beyond the defaults can be added from a
+JSON config.
+*/
+package identifiers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/ross-spencer/zenodocfl/internal/types"
+)
+
+// placeholder is replaced with the identifier in resolver templates.
+const placeholder string = "{id}"
+
+// Scheme describes a persistent identifier scheme.
+type Scheme struct {
+	// Key used for the identifier in INK's extra metadata, also used
+	// as the identifier's type, e.g. ark.
+	Key string `json:"key"`
+	// Resolver is a URL template where {id} is replaced with the
+	// identifier, e.g. https://n2t.net/{id}.
+	Resolver string `json:"resolver"`
+	// Pattern is a regular expression identifiers must match.
+	Pattern string `json:"pattern"`
+
+	pattern *regexp.Regexp
+}
+
+// Valid reports whether a value meets the syntax of the scheme.
+func (scheme Scheme) Valid(value string) bool {
+	if scheme.pattern == nil {
+		return true
+	}
+	return scheme.pattern.MatchString(value)
+}
+
+// Resolve returns the resolver URL for a value.
+func (scheme Scheme) Resolve(value string) string {
+	return strings.ReplaceAll(scheme.Resolver, placeholder, value)
+}
+
+// Defaults are the schemes every registry starts with.
+var Defaults = []Scheme{
+	{
+		Key:      "ark",
+		Resolver: "https://n2t.net/{id}",
+		Pattern:  `^ark:/?[0-9a-z]+/\S+$`,
+	},
+	{
+		Key:      "handle",
+		Resolver: "https://hdl.handle.net/{id}",
+		Pattern:  `^[0-9][0-9.]*/\S+$`,
+	},
+	{
+		Key:      "doi",
+		Resolver: "https://doi.org/{id}",
+		Pattern:  `(?i)^10\.[0-9]{4,}(\.[0-9]+)*/\S+$`,
+	},
+	{
+		Key:      "urn:nbn",
+		Resolver: "https://nbn-resolving.org/{id}",
+		Pattern:  `(?i)^urn:nbn:[a-z0-9]{2,}(:[a-z0-9-]+)*:\S+$`,
+	},
+}
+
+// Registry holds the identifier schemes known to the workflow.
+type Registry struct {
+	schemes map[string]Scheme
+}
+
+// NewRegistry returns a registry containing the default schemes.
+func NewRegistry() *Registry {
+	registry := &Registry{schemes: map[string]Scheme{}}
+	for _, scheme := range Defaults {
+		if err := registry.Register(scheme); err != nil {
+			panic(err)
+		}
+	}
+	return registry
+}
+
+// Register adds a scheme to the registry replacing any scheme with
+// the same key.
+func (registry *Registry) Register(scheme Scheme) error {
+	scheme.Key = strings.ToLower(strings.TrimSpace(scheme.Key))
+	if scheme.Key == "" {
+		return fmt.Errorf("identifier scheme has no key")
+	}
+	if !strings.Contains(scheme.Resolver, placeholder) {
+		return fmt.Errorf("resolver for '%s' has no %s placeholder: '%s'", scheme.Key, placeholder, scheme.Resolver)
+	}
+	if scheme.Pattern != "" {
+		pattern, err := regexp.Compile(scheme.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern for '%s': %w", scheme.Key, err)
+		}
+		scheme.pattern = pattern
+	}
+	registry.schemes[scheme.Key] = scheme
+	return nil
+}
+
+// LoadConfig registers the schemes listed in a JSON config file.
+func (registry *Registry) LoadConfig(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading identifier config: %w", err)
+	}
+	var schemes []Scheme
+	if err := json.Unmarshal(data, &schemes); err != nil {
+		return fmt.Errorf("error parsing identifier config: %w", err)
+	}
+	for _, scheme := range schemes {
+		if err := registry.Register(scheme); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Lookup returns the scheme registered for a key.
+func (registry *Registry) Lookup(key string) (Scheme, bool) {
+	scheme, ok := registry.schemes[strings.ToLower(strings.TrimSpace(key))]
+	return scheme, ok
+}
+
+// Keys returns the keys of every registered scheme in order.
+func (registry *Registry) Keys() []string {
+	keys := []string{}
+	for key := range registry.schemes {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// Identifier checks a value against its scheme and returns it with
+// its resolver URL.
+func (registry *Registry) Identifier(key string, value string) (types.Identifier, error) {
+	scheme, ok := registry.Lookup(key)
+	if !ok {
+		return types.Identifier{}, fmt.Errorf("unknown identifier scheme: '%s'", key)
+	}
+	value = strings.TrimSpace(value)
+	if !scheme.Valid(value) {
+		return types.Identifier{}, fmt.Errorf("invalid %s identifier: '%s'", scheme.Key, value)
+	}
+	return types.Identifier{Type: scheme.Key, Name: value, Url: scheme.Resolve(value)}, nil
+}
@@ -0,0 +1,71 @@
+package identifiers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var identifierTests = []struct {
+	key      string
+	value    string
+	expected string
+	valid    bool
+}{
+	{"ark", "ark:/15737/p657-67kd-93sh", "https://n2t.net/ark:/15737/p657-67kd-93sh", true},
+	{"ARK", "ark:15737/p657-67kd-93sh", "https://n2t.net/ark:15737/p657-67kd-93sh", true},
+	{"ark", "15737/p657-67kd-93sh", "", false},
+	{"handle", "20.500.11806/med/3hjc-05sv-4w", "https://hdl.handle.net/20.500.11806/med/3hjc-05sv-4w", true},
+	{"handle", "med/3hjc-05sv-4w", "", false},
+	{"doi", "10.5281/zenodo.1234", "https://doi.org/10.5281/zenodo.1234", true},
+	{"doi", "10.12/zenodo.1234", "", false},
+	{"urn:nbn", "urn:nbn:ch:bel-123456", "https://nbn-resolving.org/urn:nbn:ch:bel-123456", true},
+	{"urn:nbn", "urn:nbn:de:101:1-201007284391", "https://nbn-resolving.org/urn:nbn:de:101:1-201007284391", true},
+	{"urn:nbn", "urn:isbn:0451450523", "", false},
+}
+
+// TestIdentifier ensures identifiers are checked against their scheme
+// and resolved.
+func TestIdentifier(t *testing.T) {
+	registry := NewRegistry()
+	for _, test := range identifierTests {
+		res, err := registry.Identifier(test.key, test.value)
+		if test.valid != (err == nil) {
+			t.Errorf("%s '%s' validity incorrect: %v", test.key, test.value, err)
+			continue
+		}
+		if res.Url != test.expected {
+			t.Errorf("%s not resolved: '%s' expected: '%s'", test.key, res.Url, test.expected)
+		}
+	}
+	if _, err := registry.Identifier("isbn", "0451450523"); err == nil {
+		t.Errorf("unknown scheme should return an error")
+	}
+}
+
+// TestLoadConfig ensures schemes can be added from a config file.
+func TestLoadConfig(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "identifiers.json")
+	os.WriteFile(config, []byte(`[
+		{"key": "gnd", "resolver": "https://d-nb.info/gnd/{id}", "pattern": "^[0-9X-]+$"}
+	]`), 0644)
+	registry := NewRegistry()
+	if err := registry.LoadConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	res, err := registry.Identifier("gnd", "118537458")
+	if err != nil || res.Url != "https://d-nb.info/gnd/118537458" || res.Type != "gnd" {
+		t.Errorf("configured scheme not used: %+v (%v)", res, err)
+	}
+	if len(registry.Keys()) != len(Defaults)+1 {
+		t.Errorf("defaults should be kept: %v", registry.Keys())
+	}
+	os.WriteFile(config, []byte(`[{"key": "gnd", "resolver": "https://d-nb.info/gnd/"}]`), 0644)
+	if err := NewRegistry().LoadConfig(config); err == nil {
+		t.Errorf("resolver without a placeholder should return an error")
+	}
+	os.WriteFile(config, []byte(`[{"key": "gnd", "resolver": "https://d-nb.info/gnd/{id}", "pattern": "("}]`), 0644)
+	if err := NewRegistry().LoadConfig(config); err == nil {
+		t.Errorf("invalid pattern should return an error")
+	}
+}
@@ -0,0 +1,273 @@
+package ocfl
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Storage layout extension names.
+//
+// See: https://ocfl.github.io/extensions/
+const (
+	FlatDirect       string = "0002-flat-direct-storage-layout"
+	HashAndIDNTuple  string = "0003-hash-and-id-n-tuple-storage-layout"
+	HashedNTuple     string = "0004-hashed-n-tuple-storage-layout"
+	layoutFile       string = "ocfl_layout.json"
+	extensionsDir    string = "extensions"
+	extensionsConfig string = "config.json"
+)
+
+// Layout maps object identifiers to paths within a storage root.
+type Layout interface {
+	// Name returns the extension name of the layout.
+	Name() string
+	// Description returns a short description for ocfl_layout.json.
+	Description() string
+	// ObjectPath returns the path of an object relative to the
+	// storage root using forward slashes.
+	ObjectPath(id string) (string, error)
+}
+
+// layoutDeclaration describes the contents of ocfl_layout.json.
+type layoutDeclaration struct {
+	Extension   string `json:"extension"`
+	Description string `json:"description"`
+}
+
+// flatDirect places objects directly beneath the storage root using
+// their identifier as the directory name.
+type flatDirect struct {
+	ExtensionName string `json:"extensionName"`
+}
+
+func (layout flatDirect) Name() string {
+	return FlatDirect
+}
+
+func (layout flatDirect) Description() string {
+	return "objects are stored directly beneath the storage root using their identifier"
+}
+
+func (layout flatDirect) ObjectPath(id string) (string, error) {
+	if id == "" || id == "." || id == ".." || strings.ContainsAny(id, "/\\") {
+		return "", fmt.Errorf("identifier cannot be used as an object path: '%s'", id)
+	}
+	return id, nil
+}
+
+// hashedTuple provides the configuration shared by the hash based
+// layouts.
+type hashedTuple struct {
+	ExtensionName   string `json:"extensionName"`
+	DigestAlgorithm string `json:"digestAlgorithm"`
+	TupleSize       int    `json:"tupleSize"`
+	NumberOfTuples  int    `json:"numberOfTuples"`
+	// ShortObjectRoot is only used by 0004.
+	ShortObjectRoot bool `json:"shortObjectRoot,omitempty"`
+}
+
+// layoutHash returns a hash for a layout's digest algorithm.
+func layoutHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case "md5":
+		return md5.New(), nil
+	case "sha1":
+		return sha1.New(), nil
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported layout digest algorithm: '%s'", algorithm)
+}
+
+// digest returns the hex encoded digest of an identifier.
+func (layout hashedTuple) digest(id string) (string, error) {
+	hash, err := layoutHash(layout.DigestAlgorithm)
+	if err != nil {
+		return "", err
+	}
+	hash.Write([]byte(id))
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// tuples returns the tuples for a digest and the remainder of the
+// digest once the tuples are removed.
+func (layout hashedTuple) tuples(digest string) ([]string, string, error) {
+	if layout.TupleSize*layout.NumberOfTuples > len(digest) {
+		return nil, "", fmt.Errorf("tuples exceed the length of the digest: %d", len(digest))
+	}
+	if (layout.TupleSize == 0) != (layout.NumberOfTuples == 0) {
+		return nil, "", fmt.Errorf("tupleSize and numberOfTuples must both be zero if either is")
+	}
+	tuples := []string{}
+	for idx := range layout.NumberOfTuples {
+		start := idx * layout.TupleSize
+		tuples = append(tuples, digest[start:start+layout.TupleSize])
+	}
+	return tuples, digest[layout.TupleSize*layout.NumberOfTuples:], nil
+}
+
+// hashAndIDNTuple is the 0003 storage layout.
+type hashAndIDNTuple struct {
+	hashedTuple
+}
+
+func (layout hashAndIDNTuple) Name() string {
+	return HashAndIDNTuple
+}
+
+func (layout hashAndIDNTuple) Description() string {
+	return "hashed n-tuple directories followed by the encoded object identifier"
+}
+
+func (layout hashAndIDNTuple) ObjectPath(id string) (string, error) {
+	digest, err := layout.digest(id)
+	if err != nil {
+		return "", err
+	}
+	tuples, _, err := layout.tuples(digest)
+	if err != nil {
+		return "", err
+	}
+	encoded := encodeID(id)
+	const maxLength int = 100
+	if len(encoded) > maxLength {
+		encoded = fmt.Sprintf("%s-%s", encoded[:maxLength], digest)
+	}
+	return path.Join(append(tuples, encoded)...), nil
+}
+
+// encodeID percent-encodes every character of an identifier that is
+// not alphanumeric, a hyphen or an underscore.
+func encodeID(id string) string {
+	var encoded strings.Builder
+	for _, char := range []byte(id) {
+		switch {
+		case char >= 'a' && char <= 'z',
+			char >= 'A' && char <= 'Z',
+			char >= '0' && char <= '9',
+			char == '-', char == '_':
+			encoded.WriteByte(char)
+		default:
+			fmt.Fprintf(&encoded, "%%%02x", char)
+		}
+	}
+	return encoded.String()
+}
+
+// hashedNTuple is the 0004 storage layout.
+type hashedNTuple struct {
+	hashedTuple
+}
+
+func (layout hashedNTuple) Name() string {
+	return HashedNTuple
+}
+
+func (layout hashedNTuple) Description() string {
+	return "hashed n-tuple directories followed by the object identifier's digest"
+}
+
+func (layout hashedNTuple) ObjectPath(id string) (string, error) {
+	digest, err := layout.digest(id)
+	if err != nil {
+		return "", err
+	}
+	tuples, remainder, err := layout.tuples(digest)
+	if err != nil {
+		return "", err
+	}
+	if layout.ShortObjectRoot && remainder != "" {
+		return path.Join(append(tuples, remainder)...), nil
+	}
+	return path.Join(append(tuples, digest)...), nil
+}
+
+// NewLayout returns a storage layout with the extension's default
+// configuration.
+func NewLayout(name string) (Layout, error) {
+	tuple := hashedTuple{
+		ExtensionName:   name,
+		DigestAlgorithm: "sha256",
+		TupleSize:       3,
+		NumberOfTuples:  3,
+	}
+	switch name {
+	case FlatDirect:
+		return flatDirect{ExtensionName: name}, nil
+	case HashAndIDNTuple:
+		return hashAndIDNTuple{tuple}, nil
+	case HashedNTuple:
+		return hashedNTuple{tuple}, nil
+	}
+	return nil, fmt.Errorf("unsupported storage layout: '%s'", name)
+}
+
+// readLayout reads the storage layout declared in a storage root. A
+// storage root without ocfl_layout.json is treated as flat-direct.
+func readLayout(root string) (Layout, error) {
+	data, err := os.ReadFile(filepath.Join(root, layoutFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return NewLayout(FlatDirect)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading storage layout: %w", err)
+	}
+	var declaration layoutDeclaration
+	if err := json.Unmarshal(data, &declaration); err != nil {
+		return nil, fmt.Errorf("error parsing storage layout: %w", err)
+	}
+	layout, err := NewLayout(declaration.Extension)
+	if err != nil {
+		return nil, err
+	}
+	config, err := os.ReadFile(filepath.Join(root, extensionsDir, declaration.Extension, extensionsConfig))
+	if errors.Is(err, os.ErrNotExist) {
+		return layout, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading storage layout config: %w", err)
+	}
+	switch layout := layout.(type) {
+	case hashAndIDNTuple:
+		err = json.Unmarshal(config, &layout.hashedTuple)
+		return layout, err
+	case hashedNTuple:
+		err = json.Unmarshal(config, &layout.hashedTuple)
+		return layout, err
+	}
+	return layout, nil
+}
+
+// writeLayout writes ocfl_layout.json and the layout's extension
+// configuration to the storage root.
+func writeLayout(root string, layout Layout) error {
+	declaration, err := json.MarshalIndent(layoutDeclaration{layout.Name(), layout.Description()}, "", " ")
+	if err != nil {
+		return fmt.Errorf("error creating storage layout: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, layoutFile), append(declaration, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing storage layout: %w", err)
+	}
+	config, err := json.MarshalIndent(layout, "", " ")
+	if err != nil {
+		return fmt.Errorf("error creating storage layout config: %w", err)
+	}
+	configDir := filepath.Join(root, extensionsDir, layout.Name())
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		return fmt.Errorf("error creating extension directory: %w", err)
+	}
+	return os.WriteFile(filepath.Join(configDir, extensionsConfig), append(config, '\n'), 0644)
+}
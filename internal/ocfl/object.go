@@ -0,0 +1,306 @@
+package ocfl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Commit describes who is responsible for a version and why it was
+// created.
+type Commit struct {
+	Message string
+	User    User
+	Created time.Time
+}
+
+// version returns the version block for a commit.
+func (commit Commit) version(state map[string][]string) Version {
+	created := commit.Created
+	if created.IsZero() {
+		created = time.Now()
+	}
+	version := Version{
+		Created: created.UTC().Format(time.RFC3339),
+		State:   state,
+		Message: commit.Message,
+	}
+	if commit.User.Name != "" {
+		user := commit.User
+		version.User = &user
+	}
+	return version
+}
+
+// ErrUnchanged is returned when a new version would have the same
+// state as the head of the object.
+var ErrUnchanged = errors.New("object state is unchanged")
+
+// CreateObject writes the contents of the src directory as version v1
+// of a new OCFL object at objectPath.
+func CreateObject(objectPath string, id string, src string, commit Commit) (Inventory, error) {
+	if _, err := os.Stat(objectPath); err == nil {
+		return Inventory{}, fmt.Errorf("object path already exists: %s", objectPath)
+	}
+	inv := Inventory{
+		ID:               id,
+		Type:             InventoryType,
+		DigestAlgorithm:  DigestAlgorithm,
+		Head:             versionName(1),
+		ContentDirectory: ContentDirectory,
+		Manifest:         map[string][]string{},
+		Versions:         map[string]Version{},
+	}
+	if err := os.MkdirAll(objectPath, 0755); err != nil {
+		return inv, fmt.Errorf("error creating object: %w (%s)", err, objectPath)
+	}
+	err := os.WriteFile(
+		filepath.Join(objectPath, ObjectNamaste),
+		[]byte(namasteContent(ObjectNamaste)),
+		0644,
+	)
+	if err != nil {
+		return inv, fmt.Errorf("error writing namaste: %w", err)
+	}
+	state, err := stateOf(src)
+	if err != nil {
+		return inv, err
+	}
+	if err := addContent(objectPath, inv.Head, src, state, inv.Manifest); err != nil {
+		return inv, err
+	}
+	inv.Versions[inv.Head] = commit.version(state)
+	if err := writeInventory(objectPath, inv); err != nil {
+		return inv, err
+	}
+	return inv, nil
+}
+
+// AddVersion writes the contents of the src directory as the next
+// version of the object at objectPath. Content already in the object
+// is deduplicated through the manifest's digests. ErrUnchanged is
+// returned if the state is identical to the head version.
+func AddVersion(objectPath string, src string, commit Commit) (Inventory, error) {
+	inv, err := ReadInventory(objectPath)
+	if err != nil {
+		return inv, err
+	}
+	if inv.DigestAlgorithm != DigestAlgorithm {
+		return inv, fmt.Errorf("unsupported digest algorithm: %s", inv.DigestAlgorithm)
+	}
+	num, err := versionNumber(inv.Head)
+	if err != nil {
+		return inv, err
+	}
+	state, err := stateOf(src)
+	if err != nil {
+		return inv, err
+	}
+	if sameState(state, inv.Versions[inv.Head].State) {
+		return inv, ErrUnchanged
+	}
+	head := versionName(num + 1)
+	if _, err := os.Stat(filepath.Join(objectPath, head)); err == nil {
+		return inv, fmt.Errorf("version directory already exists: %s", head)
+	}
+	if err := os.MkdirAll(filepath.Join(objectPath, head), 0755); err != nil {
+		return inv, fmt.Errorf("error creating version: %w (%s)", err, head)
+	}
+	if err := addContent(objectPath, head, src, state, inv.Manifest); err != nil {
+		return inv, err
+	}
+	inv.Head = head
+	inv.Versions[head] = commit.version(state)
+	if err := writeInventory(objectPath, inv); err != nil {
+		return inv, err
+	}
+	return inv, nil
+}
+
+// versionNumber returns the number of a version name, e.g. 2 for v2.
+func versionNumber(version string) (int, error) {
+	if !strings.HasPrefix(version, "v") {
+		return 0, fmt.Errorf("invalid version name: '%s'", version)
+	}
+	num, err := strconv.Atoi(version[1:])
+	if err != nil || num < 1 {
+		return 0, fmt.Errorf("invalid version name: '%s'", version)
+	}
+	return num, nil
+}
+
+// stateOf returns the state of the src directory without copying
+// any content.
+func stateOf(src string) (map[string][]string, error) {
+	state := map[string][]string{}
+	files, err := listFiles(src)
+	if err != nil {
+		return state, err
+	}
+	for _, logical := range files {
+		source := filepath.Join(src, filepath.FromSlash(logical))
+		digest, err := FileDigest(source)
+		if err != nil {
+			return state, fmt.Errorf("error hashing file: %w (%s)", err, source)
+		}
+		state[digest] = append(state[digest], logical)
+	}
+	return state, nil
+}
+
+// sameState compares two version states.
+func sameState(a map[string][]string, b map[string][]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for digest, paths := range a {
+		other, ok := b[digest]
+		if !ok {
+			return false
+		}
+		paths = slices.Sorted(slices.Values(paths))
+		other = slices.Sorted(slices.Values(other))
+		if !slices.Equal(paths, other) {
+			return false
+		}
+	}
+	return true
+}
+
+// listFiles returns the logical paths of every file below src using
+// forward slashes as separators.
+func listFiles(src string) ([]string, error) {
+	files := []string{}
+	err := filepath.WalkDir(src, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(src, filePath)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return files, fmt.Errorf("error listing object content: %w (%s)", err, src)
+	}
+	slices.Sort(files)
+	return files, nil
+}
+
+// addContent copies the files of a version's state from src into
+// the version's content directory, adding new digests to the
+// manifest. Content already in the manifest is not copied again.
+func addContent(objectPath string, version string, src string, state map[string][]string, manifest map[string][]string) error {
+	digests := slices.Sorted(maps.Keys(state))
+	for _, digest := range digests {
+		if _, ok := manifest[digest]; ok {
+			continue
+		}
+		logical := state[digest][0]
+		contentPath := path.Join(version, ContentDirectory, logical)
+		err := copyFile(
+			filepath.Join(src, filepath.FromSlash(logical)),
+			filepath.Join(objectPath, filepath.FromSlash(contentPath)),
+		)
+		if err != nil {
+			return err
+		}
+		manifest[digest] = []string{contentPath}
+	}
+	return nil
+}
+
+// copyFile copies a file from src to dst creating any directories
+// along the way.
+func copyFile(src string, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("error creating content directory: %w (%s)", err, dst)
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("error opening file: %w (%s)", err, src)
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("error creating file: %w (%s)", err, dst)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("error copying file: %w (%s)", err, dst)
+	}
+	return out.Close()
+}
+
+// writeInventory writes the inventory and its sidecar to the object
+// root and to the head version directory.
+func writeInventory(objectPath string, inv Inventory) error {
+	data, err := json.MarshalIndent(inv, "", " ")
+	if err != nil {
+		return fmt.Errorf("error creating inventory: %w", err)
+	}
+	sidecar := fmt.Sprintf("%s %s\n", bytesDigest(data), InventoryFile)
+	for _, dir := range []string{objectPath, filepath.Join(objectPath, inv.Head)} {
+		err := os.WriteFile(filepath.Join(dir, InventoryFile), data, 0644)
+		if err != nil {
+			return fmt.Errorf("error writing inventory: %w (%s)", err, dir)
+		}
+		err = os.WriteFile(
+			filepath.Join(dir, fmt.Sprintf("%s.%s", InventoryFile, DigestAlgorithm)),
+			[]byte(sidecar),
+			0644,
+		)
+		if err != nil {
+			return fmt.Errorf("error writing inventory sidecar: %w (%s)", err, dir)
+		}
+	}
+	return nil
+}
+
+// ReadInventory reads the root inventory of the object at the given
+// path.
+func ReadInventory(objectPath string) (Inventory, error) {
+	var inv Inventory
+	data, err := os.ReadFile(filepath.Join(objectPath, InventoryFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return inv, fmt.Errorf("object has no inventory: %s", objectPath)
+		}
+		return inv, fmt.Errorf("error reading inventory: %w", err)
+	}
+	if err := json.Unmarshal(data, &inv); err != nil {
+		return inv, fmt.Errorf("error parsing inventory: %w", err)
+	}
+	return inv, nil
+}
+
+// ContentPath returns the path of the content file, relative to the
+// object root, for a logical path in the given version.
+func (inv Inventory) ContentPath(version string, logical string) (string, bool) {
+	for digest, paths := range inv.Versions[version].State {
+		if !slices.Contains(paths, logical) {
+			continue
+		}
+		content, ok := inv.Manifest[digest]
+		if !ok || len(content) < 1 {
+			return "", false
+		}
+		return content[0], true
+	}
+	return "", false
+}
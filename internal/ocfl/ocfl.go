@@ -0,0 +1,102 @@
+/* ocfl provides the structures needed to write crates as OCFL 1.1
+objects.
+
+An object on disk looks as follows:
+
+	<object>/
+	├── 0=ocfl_object_1.1
+	├── inventory.json
+	├── inventory.json.sha512
+	└── v1/
+	    ├── inventory.json
+	    ├── inventory.json.sha512
+	    └── content/
+	        └── ...
+
+See: https://ocfl.io/1.1/spec/
+*/
+
+package ocfl
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	// RootNamaste declares a directory to be an OCFL storage root.
+	RootNamaste string = "0=ocfl_1.1"
+	// ObjectNamaste declares a directory to be an OCFL object.
+	ObjectNamaste string = "0=ocfl_object_1.1"
+	// InventoryType is the inventory type for OCFL 1.1.
+	InventoryType string = "https://ocfl.io/1.1/spec/#inventory"
+	// DigestAlgorithm is the digest algorithm used for content.
+	DigestAlgorithm string = "sha512"
+	// InventoryFile is the name of the inventory in an object.
+	InventoryFile string = "inventory.json"
+	// ContentDirectory is the default name of the content directory.
+	ContentDirectory string = "content"
+	// ObjectURN prefixes a crate identifier to give the identifier of
+	// its object in a storage root whose layout encodes identifiers,
+	// e.g. urn:zenodocfl:FHNW-01KHBQ3V2A7J8Y0Z5X6N4M1P9R.
+	ObjectURN string = "urn:zenodocfl:"
+)
+
+// User describes the agent responsible for a version.
+type User struct {
+	Name    string `json:"name"`
+	Address string `json:"address,omitempty"`
+}
+
+// Version describes a single version block in the inventory.
+type Version struct {
+	Created string              `json:"created"`
+	State   map[string][]string `json:"state"`
+	Message string              `json:"message,omitempty"`
+	User    *User               `json:"user,omitempty"`
+}
+
+// Inventory describes an OCFL object, its content and versions.
+type Inventory struct {
+	ID               string              `json:"id"`
+	Type             string              `json:"type"`
+	DigestAlgorithm  string              `json:"digestAlgorithm"`
+	Head             string              `json:"head"`
+	ContentDirectory string              `json:"contentDirectory,omitempty"`
+	Manifest         map[string][]string `json:"manifest"`
+	Versions         map[string]Version  `json:"versions"`
+}
+
+// namasteContent returns the content of a namaste file.
+func namasteContent(namaste string) string {
+	return fmt.Sprintf("%s\n", namaste[2:])
+}
+
+// versionName returns the name of a version directory, e.g. v1.
+func versionName(num int) string {
+	return fmt.Sprintf("v%d", num)
+}
+
+// FileDigest returns the hex encoded sha512 digest of the given file,
+// the digest content is addressed by in an object.
+func FileDigest(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha512.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// bytesDigest returns the hex encoded sha512 digest of the given data.
+func bytesDigest(data []byte) string {
+	sum := sha512.Sum512(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,309 @@
+package ocfl
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// makeTestCrate creates a small crate-like directory to add to an
+// object.
+func makeTestCrate(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		filePath := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(filePath), 0755)
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+var testCrate = map[string]string{
+	"ro-crate-metadata.json":       "{}\n",
+	"records/motetcycle-0955.json": "{\"a\": 1}\n",
+	"media/M001.xml":               "<mei/>\n",
+	"posters/M001.png":             "<mei/>\n",
+}
+
+// TestCreateObject ensures that an object is written with its
+// namaste, inventories and sidecars, and that duplicate content is
+// only stored once.
+func TestCreateObject(t *testing.T) {
+	src := makeTestCrate(t, testCrate)
+	root := filepath.Join(t.TempDir(), "root")
+	layout, _ := NewLayout(FlatDirect)
+	if _, err := InitStorageRoot(root, layout); err != nil {
+		t.Fatal(err)
+	}
+	objectPath := filepath.Join(root, "FHNW-1234")
+	inv, err := CreateObject(objectPath, "FHNW-1234", src, Commit{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{
+		"0=ocfl_object_1.1",
+		"inventory.json",
+		"inventory.json.sha512",
+		"v1/inventory.json",
+		"v1/inventory.json.sha512",
+		"v1/content/ro-crate-metadata.json",
+	} {
+		if _, err := os.Stat(filepath.Join(objectPath, name)); err != nil {
+			t.Errorf("expected object file missing: %s", name)
+		}
+	}
+	if inv.Head != "v1" {
+		t.Errorf("head should be v1: %s", inv.Head)
+	}
+	if len(inv.Manifest) != 3 {
+		t.Errorf("manifest should deduplicate content: %d entries", len(inv.Manifest))
+	}
+	if len(inv.Versions["v1"].State) != 3 {
+		t.Errorf("state should have three digests: %d", len(inv.Versions["v1"].State))
+	}
+	sidecar, _ := os.ReadFile(filepath.Join(objectPath, "inventory.json.sha512"))
+	data, _ := os.ReadFile(filepath.Join(objectPath, "inventory.json"))
+	if !strings.HasPrefix(string(sidecar), bytesDigest(data)) {
+		t.Errorf("sidecar doesn't match inventory: %s", sidecar)
+	}
+	if _, err := CreateObject(objectPath, "FHNW-1234", src, Commit{}); err == nil {
+		t.Errorf("existing object should not be overwritten")
+	}
+}
+
+// TestInitStorageRoot ensures we do not claim an existing directory
+// as a storage root.
+func TestInitStorageRoot(t *testing.T) {
+	dir := makeTestCrate(t, map[string]string{"file.txt": "data"})
+	layout, _ := NewLayout(FlatDirect)
+	if _, err := InitStorageRoot(dir, layout); err == nil {
+		t.Errorf("non-empty directory should not become a storage root")
+	}
+}
+
+// TestAddVersion ensures new versions are added to an object and that
+// unchanged content is deduplicated through the manifest.
+func TestAddVersion(t *testing.T) {
+	src := makeTestCrate(t, testCrate)
+	objectPath := filepath.Join(t.TempDir(), "FHNW-1234")
+	commit := Commit{Message: "test", User: User{Name: "INK-crater/test"}}
+	if _, err := CreateObject(objectPath, "FHNW-1234", src, commit); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AddVersion(objectPath, src, commit); err != ErrUnchanged {
+		t.Errorf("unchanged crate should not create a version: %v", err)
+	}
+	os.WriteFile(filepath.Join(src, "ro-crate-metadata.json"), []byte("{\"v\": 2}\n"), 0644)
+	inv, err := AddVersion(objectPath, src, commit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.Head != "v2" {
+		t.Errorf("head should be v2: %s", inv.Head)
+	}
+	if len(inv.Manifest) != 4 {
+		t.Errorf("manifest should only add changed content: %d entries", len(inv.Manifest))
+	}
+	entries, _ := os.ReadDir(filepath.Join(objectPath, "v2", "content"))
+	if len(entries) != 1 {
+		t.Errorf("v2 should only contain changed content: %d entries", len(entries))
+	}
+	version := inv.Versions["v2"]
+	if version.Message != "test" || version.User == nil || version.User.Name != "INK-crater/test" {
+		t.Errorf("version block incomplete: %+v", version)
+	}
+	contentPath, ok := inv.ContentPath("v2", "media/M001.xml")
+	if !ok || contentPath != "v1/content/media/M001.xml" {
+		t.Errorf("unchanged content should resolve to v1: %s", contentPath)
+	}
+	stored, _ := ReadInventory(objectPath)
+	if stored.Head != "v2" {
+		t.Errorf("root inventory should be updated: %s", stored.Head)
+	}
+}
+
+// hasCode reports whether a result contains the given issue code.
+func hasCode(issues []Issue, code string) bool {
+	for _, issue := range issues {
+		if issue.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// makeTestObject creates a two version object for validation.
+func makeTestObject(t *testing.T) string {
+	t.Helper()
+	src := makeTestCrate(t, testCrate)
+	root := filepath.Join(t.TempDir(), "root")
+	layout, _ := NewLayout(FlatDirect)
+	InitStorageRoot(root, layout)
+	objectPath := filepath.Join(root, "FHNW-1234")
+	commit := Commit{Message: "test", User: User{Name: "test", Address: "mailto:test@example.com"}}
+	if _, err := CreateObject(objectPath, "FHNW-1234", src, commit); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(src, "media", "M002.xml"), []byte("<mei>2</mei>"), 0644)
+	if _, err := AddVersion(objectPath, src, commit); err != nil {
+		t.Fatal(err)
+	}
+	return objectPath
+}
+
+// TestValidateObject ensures objects written by this package are valid
+// and that common problems are reported with their OCFL codes.
+func TestValidateObject(t *testing.T) {
+	objectPath := makeTestObject(t)
+	results := Validate(filepath.Dir(objectPath))
+	if len(results) != 2 {
+		t.Fatalf("expected storage root and object results: %d", len(results))
+	}
+	for _, result := range results {
+		if !result.Valid() {
+			t.Errorf("object should be valid: %v", result.Errors)
+		}
+	}
+	if !hasCode(results[1].Warnings, "W005") {
+		t.Errorf("non-URI id should be warned about: %v", results[1].Warnings)
+	}
+
+	var tests = []struct {
+		code   string
+		damage func(objectPath string)
+	}{
+		{"E092", func(objectPath string) {
+			os.WriteFile(filepath.Join(objectPath, "v1", "content", "media", "M001.xml"), []byte("changed"), 0644)
+		}},
+		{"E023", func(objectPath string) {
+			os.WriteFile(filepath.Join(objectPath, "v2", "content", "extra.txt"), []byte("extra"), 0644)
+		}},
+		{"E060", func(objectPath string) {
+			os.WriteFile(filepath.Join(objectPath, "inventory.json.sha512"), []byte("abc inventory.json\n"), 0644)
+		}},
+		{"E001", func(objectPath string) {
+			os.WriteFile(filepath.Join(objectPath, "notes.txt"), []byte("notes"), 0644)
+		}},
+		{"E007", func(objectPath string) {
+			os.WriteFile(filepath.Join(objectPath, ObjectNamaste), []byte("ocfl"), 0644)
+		}},
+		{"E063", func(objectPath string) {
+			os.Remove(filepath.Join(objectPath, "inventory.json"))
+		}},
+		{"E046", func(objectPath string) {
+			os.RemoveAll(filepath.Join(objectPath, "v2"))
+		}},
+	}
+	for _, test := range tests {
+		objectPath := makeTestObject(t)
+		test.damage(objectPath)
+		result := ValidateObject(objectPath)
+		if !hasCode(result.Errors, test.code) {
+			t.Errorf("expected error %s, got: %v", test.code, result.Errors)
+		}
+	}
+}
+
+// TestValidateStorageRoot ensures stray files in the storage root are
+// reported.
+func TestValidateStorageRoot(t *testing.T) {
+	objectPath := makeTestObject(t)
+	root := filepath.Dir(objectPath)
+	os.WriteFile(filepath.Join(root, "stray.txt"), []byte("stray"), 0644)
+	results := ValidateStorageRoot(root)
+	if !hasCode(results[0].Errors, "E072") {
+		t.Errorf("expected error E072, got: %v", results[0].Errors)
+	}
+	if results := ValidateStorageRoot(t.TempDir()); !hasCode(results[0].Errors, "E069") {
+		t.Errorf("expected error E069, got: %v", results[0].Errors)
+	}
+}
+
+var layoutTests = []struct {
+	layout   string
+	id       string
+	expected string
+}{
+	{FlatDirect, "FHNW-1234", "FHNW-1234"},
+	{HashAndIDNTuple, "object-01", "3c0/ff4/240/object-01"},
+	{HashAndIDNTuple, "..hor/rib:le-$id", "487/326/d8c/%2e%2ehor%2frib%3ale-%24id"},
+	{HashedNTuple, "object-01", "3c0/ff4/240/3c0ff4240c1e116dba14c7627f2319b58aa3d77606d0d90dfc6161608ac987d4"},
+	{HashedNTuple, "..hor/rib:le-$id", "487/326/d8c/487326d8c2a3c0b885e23da1469b4d6671fd4e76978924b4443e9e3c316cda6d"},
+}
+
+// TestLayouts ensures object paths match the examples given in the
+// storage layout extensions.
+func TestLayouts(t *testing.T) {
+	for _, test := range layoutTests {
+		layout, err := NewLayout(test.layout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := layout.ObjectPath(test.id)
+		if err != nil {
+			t.Errorf("unexpected error for '%s': %s", test.id, err)
+		}
+		if res != test.expected {
+			t.Errorf("%s path incorrect: '%s' expected: '%s'", test.layout, res, test.expected)
+		}
+	}
+	flat, _ := NewLayout(FlatDirect)
+	if _, err := flat.ObjectPath("a/b"); err == nil {
+		t.Errorf("flat-direct should reject identifiers with separators")
+	}
+}
+
+// TestStorageRootLayout ensures the layout is recorded in the storage
+// root and used to resolve and list objects.
+func TestStorageRootLayout(t *testing.T) {
+	src := makeTestCrate(t, testCrate)
+	layout, _ := NewLayout(HashedNTuple)
+	root, err := InitStorageRoot(filepath.Join(t.TempDir(), "root"), layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened, err := OpenStorageRoot(root.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened.Layout.Name() != HashedNTuple {
+		t.Errorf("layout not read from storage root: %s", opened.Layout.Name())
+	}
+	for _, id := range []string{"FHNW-2", "FHNW-1", ObjectURN + "FHNW-01M55HRTDAWP24CJQ5B4CCZHAA"} {
+		objectPath, _ := opened.ObjectPath(id)
+		if _, err := CreateObject(objectPath, id, src, Commit{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	objectPath, err := opened.ResolveObject("FHNW-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(objectPath, root.Path) || filepath.Base(objectPath) == "FHNW-1" {
+		t.Errorf("object not placed by layout: %s", objectPath)
+	}
+	if _, err := opened.ResolveObject("FHNW-3"); err == nil {
+		t.Errorf("missing object should not resolve")
+	}
+	urnPath, _ := opened.ObjectPath(ObjectURN + "FHNW-01M55HRTDAWP24CJQ5B4CCZHAA")
+	resolved, err := opened.ResolveObject("FHNW-01M55HRTDAWP24CJQ5B4CCZHAA")
+	if err != nil || resolved != urnPath {
+		t.Errorf("object should resolve by its bare identifier: %s (%v)", resolved, err)
+	}
+	objects, err := opened.Objects()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 3 || objects[0].ID != "FHNW-1" || objects[0].Head != "v1" {
+		t.Errorf("objects not listed correctly: %+v", objects)
+	}
+	for _, result := range Validate(root.Path) {
+		if !result.Valid() {
+			t.Errorf("storage root should be valid: %v", result.Errors)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package ocfl
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// StorageRoot is an OCFL storage root and the layout used to place
+// objects within it.
+type StorageRoot struct {
+	Path   string
+	Layout Layout
+}
+
+// ObjectInfo summarizes an object found in a storage root.
+type ObjectInfo struct {
+	ID   string `json:"id"`
+	Head string `json:"head"`
+	Path string `json:"path"`
+}
+
+// IsStorageRoot reports whether the given path is an OCFL storage
+// root.
+func IsStorageRoot(root string) bool {
+	_, err := os.Stat(filepath.Join(root, RootNamaste))
+	return err == nil
+}
+
+// InitStorageRoot creates an OCFL storage root at the given path
+// using the given layout. An existing storage root is opened instead
+// and keeps the layout it was created with.
+func InitStorageRoot(root string, layout Layout) (StorageRoot, error) {
+	if IsStorageRoot(root) {
+		return OpenStorageRoot(root)
+	}
+	entries, err := os.ReadDir(root)
+	if err == nil && len(entries) > 0 {
+		return StorageRoot{}, fmt.Errorf("directory is not an OCFL storage root: %s", root)
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return StorageRoot{}, fmt.Errorf("error creating storage root: %w (%s)", err, root)
+	}
+	if err := writeLayout(root, layout); err != nil {
+		return StorageRoot{}, err
+	}
+	err = os.WriteFile(filepath.Join(root, RootNamaste), []byte(namasteContent(RootNamaste)), 0644)
+	if err != nil {
+		return StorageRoot{}, fmt.Errorf("error writing namaste: %w", err)
+	}
+	return StorageRoot{Path: root, Layout: layout}, nil
+}
+
+// OpenStorageRoot opens an existing storage root reading its layout.
+func OpenStorageRoot(root string) (StorageRoot, error) {
+	if !IsStorageRoot(root) {
+		return StorageRoot{}, fmt.Errorf("directory is not an OCFL storage root: %s", root)
+	}
+	layout, err := readLayout(root)
+	if err != nil {
+		return StorageRoot{}, err
+	}
+	return StorageRoot{Path: root, Layout: layout}, nil
+}
+
+// ObjectPath returns the path of the object with the given identifier
+// whether or not it exists.
+func (root StorageRoot) ObjectPath(id string) (string, error) {
+	rel, err := root.Layout.ObjectPath(id)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root.Path, filepath.FromSlash(rel)), nil
+}
+
+// ResolveObject returns the path of an existing object with the given
+// identifier. A crate identifier also resolves the object identified by
+// its URN.
+func (root StorageRoot) ResolveObject(id string) (string, error) {
+	objectPath, err := root.resolveObject(id)
+	if err == nil || strings.HasPrefix(id, ObjectURN) {
+		return objectPath, err
+	}
+	if objectPath, urnErr := root.resolveObject(ObjectURN + id); urnErr == nil {
+		return objectPath, nil
+	}
+	return "", err
+}
+
+// resolveObject returns the path of an existing object with exactly the
+// given identifier.
+func (root StorageRoot) resolveObject(id string) (string, error) {
+	objectPath, err := root.ObjectPath(id)
+	if err != nil {
+		return "", err
+	}
+	inv, err := ReadInventory(objectPath)
+	if err != nil {
+		return "", fmt.Errorf("object not found: '%s'", id)
+	}
+	if inv.ID != id {
+		return "", fmt.Errorf("object at '%s' has a different identifier: '%s'", objectPath, inv.ID)
+	}
+	return objectPath, nil
+}
+
+// Objects walks the storage root and returns every object within it
+// ordered by identifier.
+func (root StorageRoot) Objects() ([]ObjectInfo, error) {
+	objects := []ObjectInfo{}
+	paths, err := FindObjects(root.Path)
+	if err != nil {
+		return objects, err
+	}
+	for _, objectPath := range paths {
+		inv, err := ReadInventory(objectPath)
+		if err != nil {
+			return objects, err
+		}
+		objects = append(objects, ObjectInfo{ID: inv.ID, Head: inv.Head, Path: objectPath})
+	}
+	slices.SortFunc(objects, func(a, b ObjectInfo) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return objects, nil
+}
+
+// FindObjects walks a storage root and returns the path of every
+// object within it.
+func FindObjects(root string) ([]string, error) {
+	objects := []string{}
+	err := filepath.WalkDir(root, func(dirPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if dirPath == filepath.Join(root, extensionsDir) {
+			return filepath.SkipDir
+		}
+		if _, err := os.Stat(filepath.Join(dirPath, ObjectNamaste)); err == nil {
+			objects = append(objects, dirPath)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return objects, fmt.Errorf("error walking storage root: %w (%s)", err, root)
+	}
+	return objects, nil
+}
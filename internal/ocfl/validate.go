@@ -0,0 +1,546 @@
+package ocfl
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"maps"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Issue describes a single problem found during validation using the
+// OCFL validation codes.
+//
+// See: https://ocfl.io/1.1/spec/validation-codes.html
+type Issue struct {
+	Code    string `json:"code"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+// String(er) for an issue.
+func (issue Issue) String() string {
+	if issue.Path == "" {
+		return fmt.Sprintf("[%s] %s", issue.Code, issue.Message)
+	}
+	return fmt.Sprintf("[%s] %s (%s)", issue.Code, issue.Message, issue.Path)
+}
+
+// Result collects the errors and warnings for an object or storage
+// root.
+type Result struct {
+	Path     string  `json:"path"`
+	Errors   []Issue `json:"errors"`
+	Warnings []Issue `json:"warnings"`
+}
+
+// Valid reports whether validation found no errors. Warnings do not
+// make an object invalid.
+func (result Result) Valid() bool {
+	return len(result.Errors) == 0
+}
+
+// validator holds the state needed while validating an object.
+type validator struct {
+	objectPath string
+	result     *Result
+}
+
+func (v *validator) error(code string, path string, format string, args ...any) {
+	v.result.Errors = append(v.result.Errors, Issue{code, path, fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) warning(code string, path string, format string, args ...any) {
+	v.result.Warnings = append(v.result.Warnings, Issue{code, path, fmt.Sprintf(format, args...)})
+}
+
+// newHash returns a hash for the given OCFL digest algorithm.
+func newHash(algorithm string) (hash.Hash, bool) {
+	switch algorithm {
+	case "sha512":
+		return sha512.New(), true
+	case "sha256":
+		return sha256.New(), true
+	}
+	return nil, false
+}
+
+// digestWith returns the hex encoded digest of the given file using
+// the given algorithm.
+func digestWith(filePath string, algorithm string) (string, error) {
+	hash, ok := newHash(algorithm)
+	if !ok {
+		return "", fmt.Errorf("unsupported digest algorithm: %s", algorithm)
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// ValidateObject validates the OCFL object at the given path.
+func ValidateObject(objectPath string) Result {
+	result := Result{Path: objectPath, Errors: []Issue{}, Warnings: []Issue{}}
+	v := validator{objectPath: objectPath, result: &result}
+	v.validateNamaste()
+	data, inv, ok := v.readInventory(InventoryFile)
+	if !ok {
+		return result
+	}
+	if !v.validateInventory(inv, InventoryFile) {
+		return result
+	}
+	v.validateSidecar(InventoryFile, data, inv.DigestAlgorithm)
+	versions := v.validateVersionSequence(inv)
+	v.validateObjectRoot(inv)
+	for _, version := range versions {
+		v.validateVersionDir(inv, data, version)
+	}
+	v.validateContent(inv)
+	return result
+}
+
+// validateNamaste checks the object's conformance declaration.
+func (v *validator) validateNamaste() {
+	entries, err := os.ReadDir(v.objectPath)
+	if err != nil {
+		v.error("E003", "", "cannot read object root: %s", err)
+		return
+	}
+	count := 0
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), "0=") {
+			count++
+		}
+	}
+	if count != 1 {
+		v.error("E003", "", "object root must contain exactly one conformance declaration, found: %d", count)
+	}
+	data, err := os.ReadFile(filepath.Join(v.objectPath, ObjectNamaste))
+	if err != nil {
+		v.error("E003", ObjectNamaste, "conformance declaration is missing")
+		return
+	}
+	if string(data) != namasteContent(ObjectNamaste) {
+		v.error("E007", ObjectNamaste, "conformance declaration content must be '%s' followed by a newline", ObjectNamaste[2:])
+	}
+}
+
+// readInventory reads an inventory, relative to the object root,
+// checking that it is well-formed and has the required keys.
+func (v *validator) readInventory(name string) ([]byte, Inventory, bool) {
+	var inv Inventory
+	errorCount := len(v.result.Errors)
+	data, err := os.ReadFile(filepath.Join(v.objectPath, filepath.FromSlash(name)))
+	if err != nil {
+		if name == InventoryFile {
+			v.error("E063", name, "object has no inventory")
+		} else {
+			v.warning("W010", name, "version directory should contain an inventory")
+		}
+		return data, inv, false
+	}
+	keys := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &keys); err != nil {
+		v.error("E033", name, "inventory is not valid JSON: %s", err)
+		return data, inv, false
+	}
+	for _, key := range []string{"id", "type", "digestAlgorithm", "head"} {
+		if _, ok := keys[key]; !ok {
+			v.error("E036", name, "inventory is missing required key: '%s'", key)
+		}
+	}
+	for _, key := range []string{"manifest", "versions"} {
+		if _, ok := keys[key]; !ok {
+			v.error("E041", name, "inventory is missing required block: '%s'", key)
+		}
+	}
+	if err := json.Unmarshal(data, &inv); err != nil {
+		v.error("E033", name, "inventory does not follow the OCFL structure: %s", err)
+		return data, inv, false
+	}
+	return data, inv, len(v.result.Errors) == errorCount
+}
+
+// validateInventory checks the values of an inventory.
+func (v *validator) validateInventory(inv Inventory, name string) bool {
+	ok := true
+	if inv.ID == "" {
+		v.error("E036", name, "inventory id must not be empty")
+		ok = false
+	} else if parsed, err := url.Parse(inv.ID); err != nil || parsed.Scheme == "" {
+		v.warning("W005", name, "inventory id should be a URI: '%s'", inv.ID)
+	}
+	if inv.Type != InventoryType {
+		v.error("E038", name, "inventory type must be '%s': '%s'", InventoryType, inv.Type)
+	}
+	switch inv.DigestAlgorithm {
+	case DigestAlgorithm:
+	case "sha256":
+		v.warning("W004", name, "sha512 should be used as the digest algorithm")
+	default:
+		v.error("E025", name, "digest algorithm must be sha512 or sha256: '%s'", inv.DigestAlgorithm)
+		ok = false
+	}
+	if inv.ContentDirectory != "" {
+		if strings.Contains(inv.ContentDirectory, "/") || inv.ContentDirectory == "." || inv.ContentDirectory == ".." {
+			v.error("E017", name, "invalid content directory: '%s'", inv.ContentDirectory)
+			ok = false
+		}
+	}
+	if len(inv.Versions) == 0 {
+		v.error("E008", name, "object must have at least one version")
+		ok = false
+	}
+	seen := map[string]string{}
+	for digest, paths := range inv.Manifest {
+		lower := strings.ToLower(digest)
+		if other, exists := seen[lower]; exists {
+			v.error("E096", name, "digest appears more than once in the manifest: '%s' '%s'", digest, other)
+		}
+		seen[lower] = digest
+		for _, contentPath := range paths {
+			if !validPath(contentPath) {
+				v.error("E099", name, "invalid content path: '%s'", contentPath)
+			}
+		}
+	}
+	referenced := map[string]bool{}
+	for _, version := range slices.Sorted(maps.Keys(inv.Versions)) {
+		block := inv.Versions[version]
+		if _, err := time.Parse(time.RFC3339, block.Created); err != nil {
+			v.error("E049", name, "version %s created must be an RFC3339 timestamp: '%s'", version, block.Created)
+		}
+		if block.State == nil {
+			v.error("E048", name, "version %s must have a state block", version)
+		}
+		if block.Message == "" || block.User == nil {
+			v.warning("W007", name, "version %s should include a message and user", version)
+		}
+		if block.User != nil {
+			if block.User.Address == "" {
+				v.warning("W008", name, "version %s user should have an address", version)
+			} else if parsed, err := url.Parse(block.User.Address); err != nil || parsed.Scheme == "" {
+				v.warning("W009", name, "version %s user address should be a URI: '%s'", version, block.User.Address)
+			}
+		}
+		for digest, paths := range block.State {
+			referenced[strings.ToLower(digest)] = true
+			if _, ok := seen[strings.ToLower(digest)]; !ok {
+				v.error("E050", name, "version %s state digest not in manifest: '%s'", version, digest)
+			}
+			for _, logical := range paths {
+				if !validPath(logical) {
+					v.error("E053", name, "version %s has an invalid logical path: '%s'", version, logical)
+				}
+			}
+		}
+	}
+	for digest := range inv.Manifest {
+		if !referenced[strings.ToLower(digest)] {
+			v.error("E107", name, "manifest digest not referenced in any version state: '%s'", digest)
+		}
+	}
+	return ok
+}
+
+// validPath checks that content and logical paths are relative and
+// contain no empty, '.' or '..' segments.
+func validPath(value string) bool {
+	if value == "" || strings.HasPrefix(value, "/") || strings.HasSuffix(value, "/") {
+		return false
+	}
+	for _, segment := range strings.Split(value, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// validateSidecar checks the inventory sidecar, relative to the object
+// root, against the inventory data.
+func (v *validator) validateSidecar(name string, data []byte, algorithm string) {
+	sidecarName := fmt.Sprintf("%s.%s", name, algorithm)
+	sidecar, err := os.ReadFile(filepath.Join(v.objectPath, filepath.FromSlash(sidecarName)))
+	if err != nil {
+		v.error("E058", sidecarName, "inventory sidecar is missing")
+		return
+	}
+	fields := strings.Fields(string(sidecar))
+	if len(fields) != 2 || fields[1] != InventoryFile {
+		v.error("E061", sidecarName, "sidecar must contain the digest followed by '%s'", InventoryFile)
+		return
+	}
+	hash, ok := newHash(algorithm)
+	if !ok {
+		return
+	}
+	hash.Write(data)
+	if !strings.EqualFold(fields[0], hex.EncodeToString(hash.Sum(nil))) {
+		v.error("E060", sidecarName, "inventory digest does not match sidecar")
+	}
+}
+
+// validateVersionSequence checks the version names in the inventory
+// and returns them in order.
+func (v *validator) validateVersionSequence(inv Inventory) []string {
+	type version struct {
+		name string
+		num  int
+	}
+	versions := []version{}
+	widths := map[int]bool{}
+	for name := range inv.Versions {
+		num, err := versionNumber(name)
+		if err != nil {
+			v.error("E046", "", "invalid version directory name: '%s'", name)
+			continue
+		}
+		if strings.HasPrefix(name, "v0") {
+			v.warning("W001", "", "version directory names should not be zero-padded: '%s'", name)
+			widths[len(name)] = true
+		} else {
+			widths[0] = true
+		}
+		versions = append(versions, version{name, num})
+	}
+	if len(widths) > 1 {
+		v.error("E012", "", "all version directories must use the same naming convention")
+	}
+	slices.SortFunc(versions, func(a, b version) int { return a.num - b.num })
+	names := []string{}
+	for idx, version := range versions {
+		if version.num != idx+1 {
+			v.error("E009", "", "version sequence must start at 1 and be continuous, found: '%s'", version.name)
+			break
+		}
+		names = append(names, version.name)
+	}
+	if len(versions) > 0 && inv.Head != versions[len(versions)-1].name {
+		v.error("E040", InventoryFile, "head must be the highest version: '%s'", inv.Head)
+	}
+	return names
+}
+
+// validateObjectRoot checks that the object root contains only the
+// files and directories OCFL allows.
+func (v *validator) validateObjectRoot(inv Inventory) {
+	entries, err := os.ReadDir(v.objectPath)
+	if err != nil {
+		return
+	}
+	allowed := []string{
+		ObjectNamaste,
+		InventoryFile,
+		fmt.Sprintf("%s.%s", InventoryFile, inv.DigestAlgorithm),
+		"logs",
+		"extensions",
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if slices.Contains(allowed, name) {
+			continue
+		}
+		if _, ok := inv.Versions[name]; ok && entry.IsDir() {
+			continue
+		}
+		v.error("E001", name, "unexpected file or directory in object root")
+	}
+	for name := range inv.Versions {
+		if _, err := os.Stat(filepath.Join(v.objectPath, name)); err != nil {
+			v.error("E046", name, "version directory is missing")
+		}
+	}
+}
+
+// validateVersionDir checks a version directory and the inventory it
+// contains against the root inventory.
+func (v *validator) validateVersionDir(inv Inventory, rootData []byte, version string) {
+	contentDir := contentDirectory(inv)
+	entries, err := os.ReadDir(filepath.Join(v.objectPath, version))
+	if err != nil {
+		return
+	}
+	sidecarName := fmt.Sprintf("%s.%s", InventoryFile, inv.DigestAlgorithm)
+	for _, entry := range entries {
+		name := entry.Name()
+		switch {
+		case name == InventoryFile, name == sidecarName:
+		case name == contentDir && entry.IsDir():
+		case entry.IsDir():
+			v.warning("W002", path.Join(version, name), "version directory should only contain the content directory")
+		default:
+			v.error("E015", path.Join(version, name), "unexpected file in version directory")
+		}
+	}
+	name := path.Join(version, InventoryFile)
+	data, versionInv, ok := v.readInventory(name)
+	if !ok {
+		return
+	}
+	v.validateSidecar(name, data, versionInv.DigestAlgorithm)
+	if version == inv.Head {
+		if !bytes.Equal(data, rootData) {
+			v.error("E064", name, "head version inventory must be identical to the root inventory")
+		}
+		return
+	}
+	if versionInv.ContentDirectory != inv.ContentDirectory {
+		v.error("E019", name, "content directory must not change between versions")
+	}
+	for prior, block := range versionInv.Versions {
+		current, ok := inv.Versions[prior]
+		if !ok || !sameState(normalizeState(block.State), normalizeState(current.State)) {
+			v.error("E066", name, "version %s state differs from the root inventory", prior)
+			continue
+		}
+		if block.Created != current.Created || block.Message != current.Message {
+			v.warning("W011", name, "version %s metadata differs from the root inventory", prior)
+		}
+	}
+}
+
+// normalizeState lowercases the digests of a state so states can be
+// compared across inventories.
+func normalizeState(state map[string][]string) map[string][]string {
+	resolved := map[string][]string{}
+	for digest, paths := range state {
+		resolved[strings.ToLower(digest)] = paths
+	}
+	return resolved
+}
+
+// contentDirectory returns the content directory used by an object.
+func contentDirectory(inv Inventory) string {
+	if inv.ContentDirectory == "" {
+		return ContentDirectory
+	}
+	return inv.ContentDirectory
+}
+
+// validateContent checks the fixity of every content file and that
+// every file in a content directory is in the manifest.
+func (v *validator) validateContent(inv Inventory) {
+	manifest := map[string]string{}
+	for digest, paths := range inv.Manifest {
+		for _, contentPath := range paths {
+			manifest[contentPath] = digest
+		}
+	}
+	contentDir := contentDirectory(inv)
+	onDisk := map[string]bool{}
+	for version := range inv.Versions {
+		dir := filepath.Join(v.objectPath, version, contentDir)
+		filepath.WalkDir(dir, func(filePath string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() {
+				return nil
+			}
+			rel, _ := filepath.Rel(v.objectPath, filePath)
+			rel = filepath.ToSlash(rel)
+			onDisk[rel] = true
+			if _, ok := manifest[rel]; !ok {
+				v.error("E023", rel, "content file is not in the manifest")
+			}
+			return nil
+		})
+	}
+	for _, contentPath := range slices.Sorted(maps.Keys(manifest)) {
+		digest := manifest[contentPath]
+		if !onDisk[contentPath] {
+			v.error("E092", contentPath, "manifest content path does not exist")
+			continue
+		}
+		actual, err := digestWith(filepath.Join(v.objectPath, filepath.FromSlash(contentPath)), inv.DigestAlgorithm)
+		if err != nil {
+			v.error("E092", contentPath, "cannot compute digest: %s", err)
+			continue
+		}
+		if !strings.EqualFold(actual, digest) {
+			v.error("E092", contentPath, "content digest does not match the manifest")
+		}
+	}
+}
+
+// ValidateStorageRoot validates a storage root and every object in
+// it. The first result describes the storage root itself.
+func ValidateStorageRoot(root string) []Result {
+	result := Result{Path: root, Errors: []Issue{}, Warnings: []Issue{}}
+	results := []Result{}
+	data, err := os.ReadFile(filepath.Join(root, RootNamaste))
+	if err != nil {
+		result.Errors = append(result.Errors, Issue{"E069", RootNamaste, "storage root conformance declaration is missing"})
+		return append(results, result)
+	}
+	if string(data) != namasteContent(RootNamaste) {
+		result.Errors = append(result.Errors, Issue{"E069", RootNamaste, fmt.Sprintf("conformance declaration content must be '%s' followed by a newline", RootNamaste[2:])})
+	}
+	objects := []string{}
+	filepath.WalkDir(root, func(dirPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, dirPath)
+		rel = filepath.ToSlash(rel)
+		if !entry.IsDir() {
+			if !strings.Contains(rel, "/") && rootFile(rel) {
+				return nil
+			}
+			result.Errors = append(result.Errors, Issue{"E072", rel, "file is not part of an OCFL object"})
+			return nil
+		}
+		if rel == "extensions" {
+			return filepath.SkipDir
+		}
+		if _, err := os.Stat(filepath.Join(dirPath, ObjectNamaste)); err == nil {
+			objects = append(objects, dirPath)
+			return filepath.SkipDir
+		}
+		entries, _ := os.ReadDir(dirPath)
+		if len(entries) == 0 {
+			result.Errors = append(result.Errors, Issue{"E073", rel, "storage root must not contain empty directories"})
+		}
+		return nil
+	})
+	results = append(results, result)
+	for _, objectPath := range objects {
+		results = append(results, ValidateObject(objectPath))
+	}
+	return results
+}
+
+// rootFile reports whether a file is allowed at the top of a storage
+// root.
+func rootFile(name string) bool {
+	switch name {
+	case RootNamaste, "ocfl_layout.json", "ocfl_1.1.md", "ocfl_1.1.txt", "ocfl_1.1.html":
+		return true
+	}
+	return false
+}
+
+// Validate validates either a storage root or an object depending on
+// the conformance declaration found at the given path.
+func Validate(target string) []Result {
+	if IsStorageRoot(target) {
+		return ValidateStorageRoot(target)
+	}
+	return []Result{ValidateObject(target)}
+}
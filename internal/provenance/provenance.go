@@ -0,0 +1,123 @@
+/*
+Package provenance records the runs of the workflow's apps, lister,
+gather and crater, so that a crate can describe how it was produced.
+Each app appends its run to the runs of the app before it and hands
+them on alongside its output.
+*/
+package provenance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Ext is the extension of a provenance file written alongside an
+// app's output, e.g. demo.provenance next to demo.manifest.
+const Ext string = ".provenance"
+
+// Run describes a single run of an app.
+type Run struct {
+	// App is the name of the app, e.g. INK-lister.
+	App string `json:"app"`
+	// Version and Commit are set at build time using ldflags.
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+	// StartTime and EndTime are RFC3339 timestamps in UTC.
+	StartTime string `json:"start_time"`
+	EndTime   string `json:"end_time"`
+	// Url is the INK search or collection URL used.
+	Url string `json:"url,omitempty"`
+	// Inputs and Outputs are the names of the files read and written
+	// by the run.
+	Inputs  []string `json:"inputs,omitempty"`
+	Outputs []string `json:"outputs,omitempty"`
+}
+
+// timestamp returns the current time in the format used for runs.
+func timestamp() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+// Start returns a new run of an app starting now.
+func Start(app string, version string, commit string) Run {
+	return Run{
+		App:       app,
+		Version:   version,
+		Commit:    commit,
+		StartTime: timestamp(),
+	}
+}
+
+// Finish records the end time of the run.
+func (run *Run) Finish() {
+	run.EndTime = timestamp()
+}
+
+// AddInputs records the files read by the run by name.
+func (run *Run) AddInputs(paths ...string) {
+	for _, path := range paths {
+		if path != "" {
+			run.Inputs = append(run.Inputs, filepath.Base(path))
+		}
+	}
+}
+
+// AddOutputs records the files written by the run by name.
+func (run *Run) AddOutputs(paths ...string) {
+	for _, path := range paths {
+		if path != "" {
+			run.Outputs = append(run.Outputs, filepath.Base(path))
+		}
+	}
+}
+
+// Path returns the provenance file belonging to an app's output, e.g.
+// demo.provenance for demo.manifest.
+func Path(output string) string {
+	return strings.TrimSuffix(output, filepath.Ext(output)) + Ext
+}
+
+// LastURL returns the most recent INK URL recorded by the runs.
+func LastURL(runs []Run) string {
+	for idx := len(runs) - 1; idx >= 0; idx-- {
+		if runs[idx].Url != "" {
+			return runs[idx].Url
+		}
+	}
+	return ""
+}
+
+// Read reads the runs from a provenance file. A missing file means
+// the earlier apps recorded no provenance and no runs are returned.
+func Read(path string) ([]Run, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading provenance: %w (%s)", err, path)
+	}
+	var runs []Run
+	if err := json.Unmarshal(data, &runs); err != nil {
+		return nil, fmt.Errorf("error parsing provenance: %w (%s)", err, path)
+	}
+	return runs, nil
+}
+
+// Write writes the runs to a provenance file.
+func Write(path string, runs []Run) error {
+	data, err := json.MarshalIndent(runs, "", " ")
+	if err != nil {
+		return fmt.Errorf("error encoding provenance: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing provenance: %w (%s)", err, path)
+	}
+	return nil
+}
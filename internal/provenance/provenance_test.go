@@ -0,0 +1,45 @@
+package provenance
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// TestRuns ensures runs are handed on between apps through provenance
+// files.
+func TestRuns(t *testing.T) {
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "demo.manifest")
+	if Path(manifest) != filepath.Join(dir, "demo.provenance") {
+		t.Errorf("unexpected provenance path: %s", Path(manifest))
+	}
+	runs, err := Read(Path(manifest))
+	if err != nil || runs != nil {
+		t.Fatalf("a missing provenance file should give no runs: %v %v", runs, err)
+	}
+
+	lister := Start("INK-lister", "1.0.0", "abc123")
+	lister.Url = "https://ink.sammlung.cc/table/de?search=motetcycle"
+	lister.AddOutputs(manifest, filepath.Join(dir, "demo.allowlist"), "")
+	lister.Finish()
+	gather := Start("INK-gather", "1.0.0", "abc123")
+	gather.AddInputs(manifest)
+	gather.Finish()
+	if err := Write(Path(manifest), []Run{lister, gather}); err != nil {
+		t.Fatal(err)
+	}
+	runs, err = Read(Path(manifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0].App != "INK-lister" || runs[0].StartTime == "" || runs[0].EndTime == "" {
+		t.Fatalf("runs not read back: %+v", runs)
+	}
+	if !slices.Equal(runs[0].Outputs, []string{"demo.manifest", "demo.allowlist"}) || !slices.Equal(runs[1].Inputs, []string{"demo.manifest"}) {
+		t.Errorf("files should be recorded by name: %+v", runs)
+	}
+	if LastURL(runs) != lister.Url {
+		t.Errorf("expected the lister's URL: %s", LastURL(runs))
+	}
+}
@@ -0,0 +1,190 @@
+package rocrate
+
+import (
+	"cmp"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+)
+
+// Entry is a contextual entity summarised by its @id and name, e.g. a
+// publisher or license.
+type Entry struct {
+	ID   string   `json:"id"`
+	Name string   `json:"name,omitempty"`
+	Type []string `json:"type,omitempty"`
+}
+
+// Identifier summarises a persistent identifier described by the
+// crate.
+type Identifier struct {
+	ID         string `json:"id"`
+	PropertyID string `json:"property_id,omitempty"`
+	Value      string `json:"value,omitempty"`
+	URL        string `json:"url,omitempty"`
+}
+
+// Directory summarises the files on disk within a directory of the
+// crate, "." is the top of the crate.
+type Directory struct {
+	Path  string `json:"path"`
+	Files int    `json:"files"`
+	Size  int64  `json:"size"`
+}
+
+// Summary is an overview of a crate.
+type Summary struct {
+	Path          string         `json:"path"`
+	Version       string         `json:"version,omitempty"`
+	ID            string         `json:"id,omitempty"`
+	Name          string         `json:"name,omitempty"`
+	Description   string         `json:"description,omitempty"`
+	Identifier    []string       `json:"identifier,omitempty"`
+	DatePublished string         `json:"date_published,omitempty"`
+	Keywords      string         `json:"keywords,omitempty"`
+	Licenses      []Entry        `json:"licenses"`
+	Publishers    []Entry        `json:"publishers"`
+	Identifiers   []Identifier   `json:"identifiers"`
+	Types         map[string]int `json:"types"`
+	Files         int            `json:"files"`
+	Size          int64          `json:"size"`
+	Directories   []Directory    `json:"directories"`
+	Missing       []string       `json:"missing"`
+	Unlisted      []string       `json:"unlisted"`
+}
+
+// entry summarises the entity an @id points at, entities that aren't
+// described are summarised by their @id alone.
+func (metadata Metadata) entry(value Value) Entry {
+	if value.ID == "" {
+		return Entry{ID: value.Text}
+	}
+	node, ok := metadata.Node(value.ID)
+	if !ok {
+		return Entry{ID: value.ID}
+	}
+	return Entry{ID: node.ID, Name: string(node.Name), Type: node.Type}
+}
+
+// Inspect summarises the crate in a directory: the root data entity,
+// its publishers, licenses and identifiers, the number of entities of
+// each @type and the files on disk, including any that are missing or
+// unlisted. The path is the crate's directory or its metadata file.
+func Inspect(cratePath string) (Summary, error) {
+	metadata, err := Load(cratePath)
+	summary := Summary{
+		Path:        metadata.Dir,
+		Licenses:    []Entry{},
+		Publishers:  []Entry{},
+		Identifiers: []Identifier{},
+		Types:       map[string]int{},
+		Directories: []Directory{},
+		Missing:     []string{},
+		Unlisted:    []string{},
+	}
+	if err != nil {
+		return summary, err
+	}
+	summary.Version = metadata.Version()
+	if root, ok := metadata.Root(); ok {
+		summary.ID = root.ID
+		summary.Name = string(root.Name)
+		summary.Description = string(root.Description)
+		summary.DatePublished = string(root.DatePublished)
+		summary.Keywords = string(root.Keywords)
+		for _, id := range root.Identifier {
+			summary.Identifier = append(summary.Identifier, id.String())
+		}
+		for _, license := range root.License {
+			summary.Licenses = append(summary.Licenses, metadata.entry(license))
+		}
+		for _, publisher := range root.Publisher {
+			summary.Publishers = append(summary.Publishers, metadata.entry(publisher))
+		}
+	}
+	listed := []string{}
+	dirs := []string{}
+	for _, node := range metadata.Graph {
+		for _, nodeType := range node.Type {
+			summary.Types[nodeType]++
+		}
+		if node.HasType("PropertyValue") {
+			summary.Identifiers = append(summary.Identifiers, Identifier{
+				ID:         node.ID,
+				PropertyID: string(node.PropertyID),
+				Value:      string(node.Value),
+				URL:        string(node.URL),
+			})
+		}
+		for _, id := range slices.Concat([]string{node.ID}, node.HasPart.IDs()) {
+			if !IsDataPath(id) || id == MetadataName || slices.Contains(listed, id) {
+				continue
+			}
+			listed = append(listed, id)
+			if cleanID(id) != "." && !exists(dataPath(metadata.Dir, id)) {
+				summary.Missing = append(summary.Missing, id)
+			}
+		}
+		if node.HasType("Dataset") && IsDataPath(node.ID) {
+			dirs = append(dirs, node.ID)
+		}
+	}
+	summary.Unlisted = unlistedFiles(metadata.Dir, listed, dirs)
+	summary.Files, summary.Size, summary.Directories = diskUsage(metadata.Dir)
+	return summary, nil
+}
+
+// diskUsage returns the number and size of the files in a crate in
+// total and by the directory containing them.
+func diskUsage(dir string) (int, int64, []Directory) {
+	var files int
+	var size int64
+	directories := []Directory{}
+	index := map[string]int{}
+	filepath.WalkDir(dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return nil
+		}
+		parent := path.Dir(filepath.ToSlash(rel))
+		idx, ok := index[parent]
+		if !ok {
+			directories = append(directories, Directory{Path: parent})
+			idx = len(directories) - 1
+			index[parent] = idx
+		}
+		directories[idx].Files++
+		directories[idx].Size += info.Size()
+		files++
+		size += info.Size()
+		return nil
+	})
+	slices.SortFunc(directories, func(a, b Directory) int {
+		return cmp.Compare(a.Path, b.Path)
+	})
+	return files, size, directories
+}
+
+// FormatSize returns a size in bytes in decimal units, e.g. 1.2 MB.
+func FormatSize(size int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	value := float64(size)
+	idx := 0
+	for value >= 1000 && idx < len(units)-1 {
+		value /= 1000
+		idx++
+	}
+	if idx == 0 {
+		return strconv.FormatInt(size, 10) + " B"
+	}
+	return strconv.FormatFloat(value, 'f', 1, 64) + " " + units[idx]
+}
@@ -0,0 +1,203 @@
+package rocrate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Text is a property value read as text. Lists of values, e.g.
+// keywords, are joined and numbers are formatted.
+type Text string
+
+// UnmarshalJSON allows text to be given as a string, a number or a
+// list.
+func (text *Text) UnmarshalJSON(data []byte) error {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	*text = Text(textOf(value))
+	return nil
+}
+
+// textOf returns a JSON value as text.
+func textOf(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case []any:
+		items := []string{}
+		for _, item := range value {
+			if item := textOf(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return strings.Join(items, ", ")
+	case map[string]any:
+		if id, ok := value["@id"].(string); ok {
+			return id
+		}
+		return textOf(value["@value"])
+	}
+	return fmt.Sprint(value)
+}
+
+// Types are the @type of an entity, given as a single type or a list.
+type Types []string
+
+// UnmarshalJSON allows @type to be given as a string or a list.
+func (types *Types) UnmarshalJSON(data []byte) error {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	*types = stringList(value)
+	return nil
+}
+
+// Value is a single property value, either a reference to another
+// entity or text.
+type Value struct {
+	ID   string `json:"@id,omitempty"`
+	Text string `json:"text,omitempty"`
+}
+
+// String returns the referenced @id or the text of the value.
+func (value Value) String() string {
+	if value.ID != "" {
+		return value.ID
+	}
+	return value.Text
+}
+
+// Values are the values of a property which may be given as a single
+// value or a list.
+type Values []Value
+
+// UnmarshalJSON allows a property to be given as text, a reference or
+// a list of either.
+func (values *Values) UnmarshalJSON(data []byte) error {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	*values = valuesOf(value)
+	return nil
+}
+
+// valuesOf returns a JSON value as property values.
+func valuesOf(value any) Values {
+	switch value := value.(type) {
+	case nil:
+		return nil
+	case []any:
+		values := Values{}
+		for _, item := range value {
+			values = append(values, valuesOf(item)...)
+		}
+		return values
+	case map[string]any:
+		if id, ok := value["@id"].(string); ok {
+			return Values{{ID: id}}
+		}
+	}
+	return Values{{Text: textOf(value)}}
+}
+
+// IDs returns the @id of every referenced entity.
+func (values Values) IDs() []string {
+	ids := []string{}
+	for _, value := range values {
+		if value.ID != "" {
+			ids = append(ids, value.ID)
+		}
+	}
+	return ids
+}
+
+// Node is an entity of the crate's @graph read into the properties
+// used by crater and common to most crates.
+type Node struct {
+	ID             string `json:"@id"`
+	Type           Types  `json:"@type"`
+	Name           Text   `json:"name"`
+	Description    Text   `json:"description"`
+	DatePublished  Text   `json:"datePublished"`
+	Keywords       Text   `json:"keywords"`
+	License        Values `json:"license"`
+	Publisher      Values `json:"publisher"`
+	Identifier     Values `json:"identifier"`
+	About          Values `json:"about"`
+	ConformsTo     Values `json:"conformsTo"`
+	HasPart        Values `json:"hasPart"`
+	SameAs         Values `json:"sameAs"`
+	URL            Text   `json:"url"`
+	ContentURL     Text   `json:"contentUrl"`
+	SHA256         Text   `json:"sha256"`
+	ContentSize    Text   `json:"contentSize"`
+	EncodingFormat Text   `json:"encodingFormat"`
+	PropertyID     Text   `json:"propertyID"`
+	Value          Text   `json:"value"`
+}
+
+// HasType reports whether the node has the given @type.
+func (node Node) HasType(nodeType string) bool {
+	return slices.Contains(node.Type, nodeType)
+}
+
+// Metadata is the RO-Crate metadata of a crate read into typed nodes.
+type Metadata struct {
+	// Dir is the directory containing the crate.
+	Dir     string `json:"-"`
+	Context any    `json:"@context"`
+	Graph   []Node `json:"@graph"`
+}
+
+// Node returns the node with the given @id.
+func (metadata Metadata) Node(id string) (Node, bool) {
+	for _, node := range metadata.Graph {
+		if node.ID == id {
+			return node, true
+		}
+	}
+	return Node{}, false
+}
+
+// Root returns the root data entity the metadata descriptor is about.
+func (metadata Metadata) Root() (Node, bool) {
+	descriptor, ok := metadata.Node(MetadataName)
+	if !ok {
+		return Node{}, false
+	}
+	about := descriptor.About.IDs()
+	if len(about) == 0 {
+		return Node{}, false
+	}
+	return metadata.Node(about[0])
+}
+
+// Version returns the version of RO-Crate declared by the @context.
+func (metadata Metadata) Version() string {
+	return Crate{Context: metadata.Context}.Version()
+}
+
+// Load reads the metadata of the crate in a directory into typed
+// nodes. The path is the crate's directory or its metadata file.
+func Load(path string) (Metadata, error) {
+	metadata := Metadata{Dir: CrateDir(path)}
+	metadataPath := filepath.Join(metadata.Dir, MetadataName)
+	data, err := os.ReadFile(metadataPath)
+	if err != nil {
+		return metadata, fmt.Errorf("error reading crate metadata: %w (%s)", err, metadataPath)
+	}
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return metadata, fmt.Errorf("error parsing crate metadata: %w (%s)", err, metadataPath)
+	}
+	return metadata, nil
+}
@@ -0,0 +1,244 @@
+/*
+Package rocrate reads RO-Crates written by crater, and by other tools,
+so that they can be checked before they are sent to Zenodo.
+
+The crate's graph is kept as generic JSON-LD so that crates with
+entities and properties crater doesn't write can still be read.
+
+See: https://www.researchobject.org/ro-crate/specification/1.1/
+*/
+package rocrate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// MetadataName is the name of the RO-Crate metadata file.
+const MetadataName string = "ro-crate-metadata.json"
+
+// PreviewName is the name of the optional HTML preview of a crate.
+const PreviewName string = "ro-crate-preview.html"
+
+// specPrefix is the start of the permalinks of the RO-Crate
+// specification, e.g. https://w3id.org/ro/crate/1.1.
+const specPrefix string = "https://w3id.org/ro/crate/"
+
+// Versions are the versions of RO-Crate understood by this package.
+var Versions = []string{"1.1", "1.2"}
+
+// Entity is a single entity of the crate's @graph.
+type Entity map[string]any
+
+// ID returns the @id of the entity.
+func (entity Entity) ID() string {
+	id, _ := entity["@id"].(string)
+	return id
+}
+
+// Types returns the @type of the entity which may be a single type or
+// a list of types.
+func (entity Entity) Types() []string {
+	return stringList(entity["@type"])
+}
+
+// HasType reports whether the entity has the given @type.
+func (entity Entity) HasType(entityType string) bool {
+	return slices.Contains(entity.Types(), entityType)
+}
+
+// Refs returns the @id of every entity a property points at.
+func (entity Entity) Refs(property string) []string {
+	return refs(entity[property])
+}
+
+// Crate is the metadata of a RO-Crate.
+type Crate struct {
+	// Dir is the directory containing the crate.
+	Dir     string
+	Context any
+	Graph   []Entity
+}
+
+// Entity returns the entity with the given @id.
+func (crate Crate) Entity(id string) (Entity, bool) {
+	for _, entity := range crate.Graph {
+		if entity.ID() == id {
+			return entity, true
+		}
+	}
+	return nil, false
+}
+
+// Contexts returns the @context of the crate as a list of strings,
+// embedded contexts are ignored.
+func (crate Crate) Contexts() []string {
+	return stringList(crate.Context)
+}
+
+// Version returns the version of RO-Crate declared by the crate's
+// @context, e.g. 1.1.
+func (crate Crate) Version() string {
+	for _, context := range crate.Contexts() {
+		for _, version := range Versions {
+			if context == fmt.Sprintf("%s%s/context", specPrefix, version) {
+				return version
+			}
+		}
+	}
+	return ""
+}
+
+// CrateDir returns the directory of a crate given either the
+// directory or its metadata file.
+func CrateDir(path string) string {
+	if filepath.Base(path) == MetadataName {
+		return filepath.Dir(path)
+	}
+	return path
+}
+
+// Read reads the metadata of the crate in a directory.
+func Read(path string) (Crate, error) {
+	crate := Crate{Dir: CrateDir(path)}
+	metadataPath := filepath.Join(crate.Dir, MetadataName)
+	data, err := os.ReadFile(metadataPath)
+	if err != nil {
+		return crate, fmt.Errorf("error reading crate metadata: %w (%s)", err, metadataPath)
+	}
+	var doc struct {
+		Context any      `json:"@context"`
+		Graph   []Entity `json:"@graph"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return crate, fmt.Errorf("error parsing crate metadata: %w (%s)", err, metadataPath)
+	}
+	crate.Context = doc.Context
+	crate.Graph = doc.Graph
+	return crate, nil
+}
+
+// stringList returns a value that is either a string or a list of
+// strings as a list.
+func stringList(value any) []string {
+	switch value := value.(type) {
+	case string:
+		return []string{value}
+	case []any:
+		values := []string{}
+		for _, item := range value {
+			if item, ok := item.(string); ok {
+				values = append(values, item)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// refs returns the @id of every reference in a property's value,
+// e.g. {"@id": "./"} or [{"@id": "a"}, {"@id": "b"}].
+func refs(value any) []string {
+	switch value := value.(type) {
+	case map[string]any:
+		if id, ok := value["@id"].(string); ok {
+			return []string{id}
+		}
+	case []any:
+		ids := []string{}
+		for _, item := range value {
+			ids = append(ids, refs(item)...)
+		}
+		return ids
+	}
+	return nil
+}
+
+// IsLocal reports whether an @id identifies something within the
+// crate, i.e. it is a relative path, a #fragment or a blank node,
+// rather than an absolute URI.
+func IsLocal(id string) bool {
+	if strings.HasPrefix(id, "_:") || strings.HasPrefix(id, "#") {
+		return true
+	}
+	parsed, err := url.Parse(id)
+	return err == nil && parsed.Scheme == ""
+}
+
+// IsDataPath reports whether an @id is the relative path of a file or
+// directory in the crate.
+func IsDataPath(id string) bool {
+	return IsLocal(id) && !strings.HasPrefix(id, "_:") && !strings.HasPrefix(id, "#")
+}
+
+// DataPath returns the path on disk of a data entity.
+func (crate Crate) DataPath(id string) string {
+	return dataPath(crate.Dir, id)
+}
+
+// dataPath returns the path on disk of a data entity in a crate's
+// directory.
+func dataPath(dir string, id string) string {
+	return filepath.Join(dir, filepath.FromSlash(cleanID(id)))
+}
+
+// exists reports whether a path exists on disk.
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// cleanID returns the data entity @id as a clean relative path.
+func cleanID(id string) string {
+	decoded, err := url.PathUnescape(id)
+	if err != nil {
+		decoded = id
+	}
+	return path.Clean(decoded)
+}
+
+// unlistedFiles returns the files on disk, relative to the crate,
+// that are neither listed nor within a listed directory. The metadata
+// and preview are always listed. The root data entity does not list
+// the files within it.
+func unlistedFiles(dir string, listed []string, dirs []string) []string {
+	known := map[string]bool{MetadataName: true, PreviewName: true}
+	for _, id := range listed {
+		known[cleanID(id)] = true
+	}
+	prefixes := []string{}
+	for _, id := range dirs {
+		if cleaned := cleanID(id); cleaned != "." {
+			prefixes = append(prefixes, cleaned+"/")
+		}
+	}
+	files := []string{}
+	filepath.WalkDir(dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if known[rel] {
+			return nil
+		}
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(rel, prefix) {
+				return nil
+			}
+		}
+		files = append(files, rel)
+		return nil
+	})
+	return files
+}
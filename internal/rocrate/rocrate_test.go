@@ -0,0 +1,253 @@
+package rocrate
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// testMetadata is a small valid crate as written by crater.
+const testMetadata string = `{
+ "@context": "https://w3id.org/ro/crate/1.1/context",
+ "@graph": [
+  {"@id": "ro-crate-metadata.json", "@type": "CreativeWork", "about": {"@id": "./"}, "conformsTo": {"@id": "https://w3id.org/ro/crate/1.1"}},
+  {
+   "@id": "./",
+   "@type": "Dataset",
+   "name": "Motet Cycles",
+   "description": "The Motet Cycles project.",
+   "datePublished": "2026-02-13",
+   "license": {"@id": "https://creativecommons.org/publicdomain/zero/1.0/"},
+   "publisher": [{"@id": "https://ror.org/04mq2g308"}],
+   "hasPart": [{"@id": "records/motetcycle-0955.json"}],
+   "mentions": [{"@id": "#motetcycle-0955"}]
+  },
+  {"@id": "https://creativecommons.org/publicdomain/zero/1.0/", "@type": "CreativeWork", "name": "CC0 1.0"},
+  {"@id": "https://ror.org/04mq2g308", "@type": "Organization", "name": "FHNW"},
+  {"@id": "records/motetcycle-0955.json", "@type": "File", "encodingFormat": "application/json", "contentSize": "9"},
+  {"@id": "#motetcycle-0955", "@type": "CreativeWork", "subjectOf": {"@id": "records/motetcycle-0955.json"}}
+ ]
+}`
+
+// makeTestCrate writes a crate with the given metadata returning its
+// directory.
+func makeTestCrate(t *testing.T, metadata string) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		MetadataName:                   metadata,
+		PreviewName:                    "<html></html>",
+		"records/motetcycle-0955.json": "{\"a\": 1}\n",
+	}
+	for name, content := range files {
+		filePath := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(filePath), 0755)
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// modify returns the test metadata changed by the given function with
+// any extra entities added to the graph.
+func modify(t *testing.T, change func(graph []map[string]any), extra ...map[string]any) string {
+	t.Helper()
+	var crate map[string]any
+	json.Unmarshal([]byte(testMetadata), &crate)
+	graph := []map[string]any{}
+	for _, entity := range crate["@graph"].([]any) {
+		graph = append(graph, entity.(map[string]any))
+	}
+	change(graph)
+	crate["@graph"] = append(graph, extra...)
+	data, err := json.Marshal(crate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// checks returns the checks of the issues in a report.
+func checks(report Report) []string {
+	found := []string{}
+	for _, issue := range report.Issues {
+		found = append(found, issue.Check)
+	}
+	return found
+}
+
+// TestValidate ensures a valid crate has no issues at any level and
+// that the metadata file can be given instead of the directory.
+func TestValidate(t *testing.T) {
+	dir := makeTestCrate(t, testMetadata)
+	for _, path := range []string{dir, filepath.Join(dir, MetadataName)} {
+		report := Validate(path, Optional)
+		if !report.Valid() || report.Version != "1.1" || report.Path != dir {
+			t.Errorf("crate should be valid: %+v", report)
+		}
+	}
+}
+
+var invalidTests = []struct {
+	name     string
+	change   func(graph []map[string]any)
+	level    Severity
+	expected []string
+}{
+	{
+		"descriptor not about the root",
+		func(graph []map[string]any) { delete(graph[0], "about") },
+		Required,
+		[]string{"descriptor"},
+	},
+	{
+		"root not a dataset and missing properties",
+		func(graph []map[string]any) {
+			graph[1]["@type"] = "Collection"
+			delete(graph[1], "description")
+			delete(graph[1], "license")
+		},
+		Required,
+		[]string{"root", "root", "license"},
+	},
+	{
+		"datePublished",
+		func(graph []map[string]any) { graph[1]["datePublished"] = "13 February 2026" },
+		Required,
+		[]string{"datePublished"},
+	},
+	{
+		"datePublished precision",
+		func(graph []map[string]any) { graph[1]["datePublished"] = "2026" },
+		Recommended,
+		[]string{"datePublished"},
+	},
+	{
+		"missing hasPart file",
+		func(graph []map[string]any) {
+			graph[1]["hasPart"] = []any{map[string]any{"@id": "records/missing.json"}}
+		},
+		Required,
+		// the missing file is also not described by an entity.
+		[]string{"hasPart", "dangling"},
+	},
+	{
+		"dangling reference",
+		func(graph []map[string]any) { graph[5]["citation"] = map[string]any{"@id": "#motetcycle-0399"} },
+		Required,
+		[]string{"dangling"},
+	},
+	{
+		"publisher and license not described",
+		func(graph []map[string]any) {
+			graph[1]["license"] = "https://creativecommons.org/publicdomain/zero/1.0/"
+			graph[3]["@type"] = "Thing"
+		},
+		Recommended,
+		[]string{"license", "publisher"},
+	},
+	{
+		"recommendations not reported at REQUIRED",
+		func(graph []map[string]any) { delete(graph[1], "publisher") },
+		Required,
+		[]string{},
+	},
+}
+
+// TestValidateInvalid ensures problems are reported at their severity.
+func TestValidateInvalid(t *testing.T) {
+	for _, test := range invalidTests {
+		dir := makeTestCrate(t, modify(t, test.change))
+		report := Validate(dir, test.level)
+		if !slices.Equal(checks(report), test.expected) {
+			t.Errorf("%s: expected %v got: %v", test.name, test.expected, report.Issues)
+		}
+	}
+}
+
+// TestValidateFiles ensures files on disk are listed in the crate and
+// that the absence of the metadata is reported.
+func TestValidateFiles(t *testing.T) {
+	dir := makeTestCrate(t, testMetadata)
+	os.WriteFile(filepath.Join(dir, "media.xml"), []byte("<mei/>"), 0644)
+	os.Remove(filepath.Join(dir, PreviewName))
+	if report := Validate(dir, Required); !report.Valid() {
+		t.Errorf("unlisted files are a recommendation: %v", report.Issues)
+	}
+	report := Validate(dir, Optional)
+	if !slices.Equal(checks(report), []string{"unlisted", "preview"}) || report.Issues[0].Entity != "media.xml" {
+		t.Errorf("unlisted file not reported: %v", report.Issues)
+	}
+	report = Validate(t.TempDir(), Required)
+	if !slices.Equal(checks(report), []string{"metadata"}) {
+		t.Errorf("missing metadata not reported: %v", report.Issues)
+	}
+	if _, err := ParseSeverity("mandatory"); err == nil {
+		t.Error("expected an error for an unknown severity")
+	}
+}
+
+// TestLoad ensures properties given as a single value or a list are
+// read into typed nodes.
+func TestLoad(t *testing.T) {
+	dir := makeTestCrate(t, modify(t, func(graph []map[string]any) {
+		graph[1]["@type"] = []any{"Dataset", "RepositoryCollection"}
+		graph[1]["keywords"] = []any{"renaissance", "motet"}
+		graph[1]["identifier"] = "FHNW-1234"
+		graph[4]["contentSize"] = 9
+	}))
+	metadata, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, ok := metadata.Root()
+	if !ok || !slices.Equal(root.Type, Types{"Dataset", "RepositoryCollection"}) || root.Keywords != "renaissance, motet" {
+		t.Errorf("root not read: %+v", root)
+	}
+	if !slices.Equal(root.Identifier, Values{{Text: "FHNW-1234"}}) || !slices.Equal(root.Publisher.IDs(), []string{"https://ror.org/04mq2g308"}) {
+		t.Errorf("root values not read: %+v", root)
+	}
+	if file, _ := metadata.Node("records/motetcycle-0955.json"); file.ContentSize != "9" {
+		t.Errorf("numbers should be read as text: %+v", file)
+	}
+}
+
+// TestInspect ensures a crate is summarised and that missing and
+// unlisted files are found.
+func TestInspect(t *testing.T) {
+	dir := makeTestCrate(t, modify(t, func(graph []map[string]any) {
+		graph[1]["hasPart"] = []any{
+			map[string]any{"@id": "records/motetcycle-0955.json"},
+			map[string]any{"@id": "media/M001.xml"},
+		}
+	}, map[string]any{"@id": "#ark:/15737/p657", "@type": "PropertyValue", "propertyID": "ark", "value": "ark:/15737/p657"}))
+	os.WriteFile(filepath.Join(dir, "records", "notes.txt"), []byte("notes"), 0644)
+	summary, err := Inspect(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Name != "Motet Cycles" || summary.Version != "1.1" || summary.DatePublished != "2026-02-13" {
+		t.Errorf("root metadata not summarised: %+v", summary)
+	}
+	if len(summary.Publishers) != 1 || summary.Publishers[0].Name != "FHNW" || summary.Licenses[0].Name != "CC0 1.0" {
+		t.Errorf("publishers and licenses not summarised: %+v %+v", summary.Publishers, summary.Licenses)
+	}
+	if summary.Types["CreativeWork"] != 3 || summary.Types["File"] != 1 {
+		t.Errorf("entities not counted: %v", summary.Types)
+	}
+	if !slices.Equal(summary.Missing, []string{"media/M001.xml"}) || !slices.Equal(summary.Unlisted, []string{"records/notes.txt"}) {
+		t.Errorf("missing and unlisted files not found: %v %v", summary.Missing, summary.Unlisted)
+	}
+	if len(summary.Identifiers) != 1 || summary.Identifiers[0].PropertyID != "ark" || summary.Identifiers[0].Value != "ark:/15737/p657" {
+		t.Errorf("identifiers not summarised: %+v", summary.Identifiers)
+	}
+	if summary.Files != 4 || len(summary.Directories) != 2 || summary.Directories[1] != (Directory{"records", 2, 14}) {
+		t.Errorf("disk usage incorrect: %d %+v", summary.Files, summary.Directories)
+	}
+	if _, err := Inspect(t.TempDir()); err == nil {
+		t.Error("expected an error for a directory without a crate")
+	}
+}
@@ -0,0 +1,357 @@
+package rocrate
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Severity is the level of a requirement of the RO-Crate
+// specification, following the MUST, SHOULD and MAY of the
+// specification.
+type Severity string
+
+const (
+	Required    Severity = "REQUIRED"
+	Recommended Severity = "RECOMMENDED"
+	Optional    Severity = "OPTIONAL"
+)
+
+// severities are ordered from the most to the least severe.
+var severities = []Severity{Required, Recommended, Optional}
+
+// ParseSeverity returns the severity with the given name, e.g.
+// required.
+func ParseSeverity(name string) (Severity, error) {
+	severity := Severity(strings.ToUpper(strings.TrimSpace(name)))
+	if !slices.Contains(severities, severity) {
+		return "", fmt.Errorf("unknown severity: '%s' (use REQUIRED, RECOMMENDED or OPTIONAL)", name)
+	}
+	return severity, nil
+}
+
+// Includes reports whether validating at this level includes checks
+// of the given severity, e.g. RECOMMENDED includes REQUIRED.
+func (level Severity) Includes(severity Severity) bool {
+	return slices.Index(severities, severity) <= slices.Index(severities, level)
+}
+
+// Issue describes a single problem found during validation.
+type Issue struct {
+	Severity Severity `json:"severity"`
+	Check    string   `json:"check"`
+	Entity   string   `json:"entity,omitempty"`
+	Message  string   `json:"message"`
+}
+
+// String(er) for an issue.
+func (issue Issue) String() string {
+	if issue.Entity == "" {
+		return fmt.Sprintf("[%s] %s: %s", issue.Severity, issue.Check, issue.Message)
+	}
+	return fmt.Sprintf("[%s] %s: %s (%s)", issue.Severity, issue.Check, issue.Message, issue.Entity)
+}
+
+// Report collects the issues found in a crate.
+type Report struct {
+	Path    string   `json:"path"`
+	Version string   `json:"version,omitempty"`
+	Level   Severity `json:"level"`
+	Issues  []Issue  `json:"issues"`
+}
+
+// Valid reports whether validation found no issues at the level
+// validated.
+func (report Report) Valid() bool {
+	return len(report.Issues) == 0
+}
+
+// validator holds the state needed while validating a crate.
+type validator struct {
+	crate  Crate
+	report *Report
+}
+
+func (v *validator) issue(severity Severity, check string, entity string, format string, args ...any) {
+	if !v.report.Level.Includes(severity) {
+		return
+	}
+	v.report.Issues = append(v.report.Issues, Issue{severity, check, entity, fmt.Sprintf(format, args...)})
+}
+
+// Validate checks a crate against the RO-Crate specification reporting
+// the issues at the given level and above. The path is the crate's
+// directory or its metadata file.
+func Validate(path string, level Severity) Report {
+	report := Report{Path: CrateDir(path), Level: level, Issues: []Issue{}}
+	crate, err := Read(path)
+	v := validator{crate: crate, report: &report}
+	if err != nil {
+		v.issue(Required, "metadata", MetadataName, "%s", err)
+		return report
+	}
+	report.Version = crate.Version()
+	v.validateContext()
+	v.validateGraph()
+	root, ok := v.validateDescriptor()
+	if ok {
+		v.validateRoot(root)
+	}
+	v.validateReferences()
+	v.validateDataEntities()
+	v.validateUnlisted()
+	if !exists(filepath.Join(crate.Dir, PreviewName)) {
+		v.issue(Optional, "preview", PreviewName, "crate has no HTML preview")
+	}
+	return report
+}
+
+// validateContext checks the crate declares a version of RO-Crate in
+// its @context.
+func (v *validator) validateContext() {
+	if v.crate.Context == nil {
+		v.issue(Required, "context", "", "crate has no @context")
+		return
+	}
+	if v.crate.Version() == "" {
+		v.issue(Required, "context", "", "@context does not reference a RO-Crate context: %v", v.crate.Context)
+	}
+}
+
+// validateGraph checks the graph is flat with a unique @id for every
+// entity.
+func (v *validator) validateGraph() {
+	if len(v.crate.Graph) == 0 {
+		v.issue(Required, "graph", "", "crate has no @graph")
+	}
+	seen := map[string]bool{}
+	for idx, entity := range v.crate.Graph {
+		id := entity.ID()
+		if id == "" {
+			v.issue(Required, "graph", "", "entity %d has no @id", idx)
+			continue
+		}
+		if seen[id] {
+			v.issue(Required, "graph", id, "@id is used by more than one entity")
+		}
+		seen[id] = true
+		if len(entity.Types()) == 0 {
+			v.issue(Required, "graph", id, "entity has no @type")
+		}
+	}
+}
+
+// validateDescriptor checks the metadata descriptor returning the root
+// data entity it is about.
+func (v *validator) validateDescriptor() (Entity, bool) {
+	descriptor, ok := v.crate.Entity(MetadataName)
+	if !ok {
+		v.issue(Required, "descriptor", MetadataName, "crate has no metadata descriptor")
+		return nil, false
+	}
+	if !descriptor.HasType("CreativeWork") {
+		v.issue(Required, "descriptor", MetadataName, "metadata descriptor must be a CreativeWork: %v", descriptor.Types())
+	}
+	conforms := descriptor.Refs("conformsTo")
+	spec := slices.IndexFunc(conforms, func(id string) bool {
+		return strings.HasPrefix(id, specPrefix)
+	})
+	if spec < 0 {
+		v.issue(Required, "descriptor", MetadataName, "metadata descriptor must conform to a version of RO-Crate: %v", conforms)
+	} else if version := strings.TrimPrefix(conforms[spec], specPrefix); v.crate.Version() != "" && strings.TrimSuffix(version, "/") != v.crate.Version() {
+		v.issue(Recommended, "descriptor", MetadataName, "metadata descriptor conforms to RO-Crate %s but the @context is %s", version, v.crate.Version())
+	}
+	about := descriptor.Refs("about")
+	if len(about) != 1 {
+		v.issue(Required, "descriptor", MetadataName, "metadata descriptor must be about the root data entity")
+		return nil, false
+	}
+	root, ok := v.crate.Entity(about[0])
+	if !ok {
+		v.issue(Required, "root", about[0], "root data entity is not described")
+		return nil, false
+	}
+	return root, true
+}
+
+// validateRoot checks the root data entity and its required
+// properties.
+func (v *validator) validateRoot(root Entity) {
+	id := root.ID()
+	if !strings.HasSuffix(id, "/") {
+		v.issue(Required, "root", id, "root data entity @id must end with '/'")
+	} else if id != "./" {
+		v.issue(Recommended, "root", id, "root data entity @id should be './'")
+	}
+	if !root.HasType("Dataset") {
+		v.issue(Required, "root", id, "root data entity must be a Dataset: %v", root.Types())
+	}
+	for _, property := range []string{"name", "description"} {
+		if text, _ := root[property].(string); strings.TrimSpace(text) == "" {
+			v.issue(Required, "root", id, "root data entity has no %s", property)
+		}
+	}
+	v.validateDatePublished(root)
+	v.validateLicense(root)
+	v.validatePublisher(root)
+	for _, part := range root.Refs("hasPart") {
+		if IsDataPath(part) && !exists(v.crate.DataPath(part)) {
+			v.issue(Required, "hasPart", part, "file listed in hasPart does not exist")
+		}
+	}
+}
+
+// datePrecisions are the ISO 8601 formats accepted for datePublished
+// from the most to the least precise.
+var datePrecisions = []struct {
+	layout string
+	day    bool
+}{
+	{time.RFC3339, true},
+	{"2006-01-02T15:04:05", true},
+	{"2006-01-02", true},
+	{"2006-01", false},
+	{"2006", false},
+}
+
+// validateDatePublished checks datePublished is an ISO 8601 date
+// given to at least the precision of a day.
+func (v *validator) validateDatePublished(root Entity) {
+	date, _ := root["datePublished"].(string)
+	if date == "" {
+		v.issue(Required, "datePublished", root.ID(), "root data entity has no datePublished")
+		return
+	}
+	for _, precision := range datePrecisions {
+		if _, err := time.Parse(precision.layout, date); err != nil {
+			continue
+		}
+		if !precision.day {
+			v.issue(Recommended, "datePublished", root.ID(), "datePublished should be at least the precision of a day: '%s'", date)
+		}
+		return
+	}
+	v.issue(Required, "datePublished", root.ID(), "datePublished is not an ISO 8601 date: '%s'", date)
+}
+
+// validateLicense checks the root data entity has a license that is
+// described by a contextual entity.
+func (v *validator) validateLicense(root Entity) {
+	value, ok := root["license"]
+	if !ok {
+		v.issue(Required, "license", root.ID(), "root data entity has no license")
+		return
+	}
+	licenses := root.Refs("license")
+	if len(licenses) == 0 {
+		if text, _ := value.(string); strings.TrimSpace(text) == "" {
+			v.issue(Required, "license", root.ID(), "root data entity has no license")
+			return
+		}
+		v.issue(Recommended, "license", root.ID(), "license should reference a contextual entity: '%v'", value)
+		return
+	}
+	for _, license := range licenses {
+		entity, ok := v.crate.Entity(license)
+		if !ok {
+			v.issue(Recommended, "license", license, "license should be described by a contextual entity")
+			continue
+		}
+		if text, _ := entity["name"].(string); text == "" {
+			v.issue(Optional, "license", license, "license has no name")
+		}
+	}
+}
+
+// validatePublisher checks the root data entity has a publisher that
+// is described as an organization or person.
+func (v *validator) validatePublisher(root Entity) {
+	publishers := root.Refs("publisher")
+	if len(publishers) == 0 {
+		v.issue(Recommended, "publisher", root.ID(), "root data entity should have a publisher")
+		return
+	}
+	for _, publisher := range publishers {
+		entity, ok := v.crate.Entity(publisher)
+		if !ok {
+			// reported as a dangling reference if local.
+			if !IsLocal(publisher) {
+				v.issue(Recommended, "publisher", publisher, "publisher should be described by a contextual entity")
+			}
+			continue
+		}
+		if !entity.HasType("Organization") && !entity.HasType("Person") {
+			v.issue(Recommended, "publisher", publisher, "publisher should be an Organization or Person: %v", entity.Types())
+		}
+	}
+}
+
+// validateReferences checks every local @id referenced by an entity is
+// described in the graph.
+func (v *validator) validateReferences() {
+	for _, entity := range v.crate.Graph {
+		for property, value := range entity {
+			if strings.HasPrefix(property, "@") {
+				continue
+			}
+			for _, id := range refs(value) {
+				if !IsLocal(id) {
+					continue
+				}
+				if _, ok := v.crate.Entity(id); !ok {
+					v.issue(Required, "dangling", entity.ID(), "%s references an entity that is not described: '%s'", property, id)
+				}
+			}
+		}
+	}
+}
+
+// validateDataEntities checks every File and Dataset with a relative
+// path exists on disk and that files are described well enough to be
+// reused.
+func (v *validator) validateDataEntities() {
+	for _, entity := range v.crate.Graph {
+		id := entity.ID()
+		if id == MetadataName || !IsDataPath(id) || id == "./" {
+			continue
+		}
+		switch {
+		case entity.HasType("File"):
+			if !exists(v.crate.DataPath(id)) {
+				v.issue(Required, "file", id, "file does not exist")
+			}
+			if format, _ := entity["encodingFormat"].(string); format == "" {
+				v.issue(Recommended, "file", id, "file should have an encodingFormat")
+			}
+			if _, ok := entity["contentSize"]; !ok {
+				v.issue(Optional, "file", id, "file has no contentSize")
+			}
+		case entity.HasType("Dataset"):
+			if !exists(v.crate.DataPath(id)) {
+				v.issue(Required, "dataset", id, "directory does not exist")
+			}
+		}
+	}
+}
+
+// validateUnlisted checks every file on disk is listed in the crate,
+// either by a data entity or as part of a listed directory.
+func (v *validator) validateUnlisted() {
+	listed := []string{}
+	dirs := []string{}
+	for _, entity := range v.crate.Graph {
+		for _, id := range slices.Concat([]string{entity.ID()}, entity.Refs("hasPart")) {
+			if IsDataPath(id) {
+				listed = append(listed, id)
+			}
+		}
+		if entity.HasType("Dataset") && IsDataPath(entity.ID()) {
+			dirs = append(dirs, entity.ID())
+		}
+	}
+	for _, file := range unlistedFiles(v.crate.Dir, listed, dirs) {
+		v.issue(Recommended, "unlisted", file, "file is in the crate but not listed in its metadata")
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"log"
 	"slices"
+
+	"github.com/ross-spencer/zenodocfl/internal/provenance"
 )
 
 /* Lister types */
@@ -38,17 +40,22 @@ func (r MediathekRecord) String() string {
 type Item struct {
 	// The item title.
 	Label string `json:"label"`
+	// Signature / slug of the record in INK.
+	Signature string `json:"signature,omitempty"`
+	// Url of the record outside of INK.
+	Url string `json:"url,omitempty"`
 	// The file used to create the record.
 	File string `json:"file"`
 	// License belonging to the item.
 	License string `json:"license"`
 	// Publisher of the item.
 	Publisher string `json:"publisher"`
+	// Type of the record in INK, e.g. motet. Cycles and other
+	// collections have no type.
+	Type string `json:"type,omitempty"`
 	// Relationship describes relationships to an item one way or
-	// another. The direction of relationship is not yet
-	// determined.
-	//
-	// NB. likely hasPart in RO-CRATE.
+	// another. INK doesn't record the direction, it follows from
+	// the types of the item and the related record.
 	Relationship []Relationship `json:"relationships"`
 	// Meedia describes media associated with a record.
 	//
@@ -56,6 +63,9 @@ type Item struct {
 	Media []Media `json:"media,omitempty"`
 	// Identifiers associated with the record.
 	Identifiers []Identifier `json:"identifiers"`
+	// Persons are the composers, authors and other contributors
+	// associated with the record.
+	Persons []Person `json:"persons,omitempty"`
 	// Poster provides an image associated with a record. The basee
 	// record has a poster and relations often do as well.
 	Poster Poster `json:"poster"`
@@ -66,9 +76,11 @@ type Item struct {
 }
 
 type Relationship struct {
-	Label  string `json:"label"`
-	Url    string `json:"url"`
-	Poster Poster `json:"poster"`
+	Label     string `json:"label"`
+	Signature string `json:"signature,omitempty"`
+	Url       string `json:"url"`
+	Type      string `json:"type,omitempty"`
+	Poster    Poster `json:"poster"`
 }
 
 type Media struct {
@@ -77,6 +89,12 @@ type Media struct {
 	Url      string `json:"url"`
 }
 
+type Person struct {
+	Name        string       `json:"name"`
+	Role        string       `json:"role"`
+	Identifiers []Identifier `json:"identifiers,omitempty"`
+}
+
 type Identifier struct {
 	Type string `json:"type"`
 	Name string `json:"name"`
@@ -107,6 +125,9 @@ type Collection struct {
 	itemURLs   []string
 	MediaURLs  []string `json:"media_urls"`
 	PosterURLs []string `json:"poster_urls"`
+	// Provenance describes the lister and gather runs that produced
+	// the collection.
+	Provenance []provenance.Run `json:"provenance,omitempty"`
 }
 
 // addItem determines if an item should be added to a slice for
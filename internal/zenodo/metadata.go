@@ -0,0 +1,156 @@
+package zenodo
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// UploadTypes lists the upload types accepted by Zenodo.
+var UploadTypes = []string{
+	"publication",
+	"poster",
+	"presentation",
+	"dataset",
+	"image",
+	"video",
+	"software",
+	"lesson",
+	"physicalobject",
+	"other",
+}
+
+// PublicationTypes lists the publication types accepted by Zenodo.
+var PublicationTypes = []string{
+	"annotationcollection",
+	"book",
+	"section",
+	"conferencepaper",
+	"datamanagementplan",
+	"article",
+	"patent",
+	"preprint",
+	"deliverable",
+	"milestone",
+	"proposal",
+	"report",
+	"softwaredocumentation",
+	"taxonomictreatment",
+	"technicalnote",
+	"thesis",
+	"workingpaper",
+	"other",
+}
+
+// ImageTypes lists the image types accepted by Zenodo.
+var ImageTypes = []string{
+	"figure",
+	"plot",
+	"drawing",
+	"diagram",
+	"photo",
+	"other",
+}
+
+// AccessRights lists the access rights accepted by Zenodo.
+var AccessRights = []string{
+	"open",
+	"embargoed",
+	"restricted",
+	"closed",
+}
+
+// Relations lists the relations accepted for related identifiers.
+var Relations = []string{
+	"isCitedBy",
+	"cites",
+	"isSupplementTo",
+	"isSupplementedBy",
+	"isContinuedBy",
+	"continues",
+	"isDescribedBy",
+	"describes",
+	"hasMetadata",
+	"isMetadataFor",
+	"isNewVersionOf",
+	"isPreviousVersionOf",
+	"isPartOf",
+	"hasPart",
+	"isReferencedBy",
+	"references",
+	"isDocumentedBy",
+	"documents",
+	"isCompiledBy",
+	"compiles",
+	"isVariantFormOf",
+	"isOriginalFormof",
+	"isIdenticalTo",
+	"isAlternateIdentifier",
+	"isReviewedBy",
+	"reviews",
+	"isDerivedFrom",
+	"isSourceOf",
+	"requires",
+	"isRequiredBy",
+	"isObsoletedBy",
+	"obsoletes",
+}
+
+// Validate checks metadata against the rules Zenodo applies when a
+// deposition is published so that problems are found before anything
+// is uploaded. Every error names the offending field.
+func (metadata Metadata) Validate() []FieldError {
+	errors := []FieldError{}
+	fail := func(field string, format string, args ...any) {
+		errors = append(errors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+	if !slices.Contains(UploadTypes, metadata.UploadType) {
+		fail("metadata.upload_type", "invalid upload type: '%s'", metadata.UploadType)
+	}
+	if metadata.UploadType == "publication" && !slices.Contains(PublicationTypes, metadata.PublicationType) {
+		fail("metadata.publication_type", "invalid publication type: '%s'", metadata.PublicationType)
+	}
+	if metadata.UploadType == "image" && !slices.Contains(ImageTypes, metadata.ImageType) {
+		fail("metadata.image_type", "invalid image type: '%s'", metadata.ImageType)
+	}
+	if metadata.Title == "" {
+		fail("metadata.title", "title is required")
+	}
+	if metadata.Description == "" {
+		fail("metadata.description", "description is required")
+	}
+	if len(metadata.Creators) == 0 {
+		fail("metadata.creators", "at least one creator is required")
+	}
+	for idx, creator := range metadata.Creators {
+		if creator.Name == "" {
+			fail(fmt.Sprintf("metadata.creators[%d].name", idx), "creator name is required")
+		}
+	}
+	if metadata.PublicationDate != "" {
+		if _, err := time.Parse(time.DateOnly, metadata.PublicationDate); err != nil {
+			fail("metadata.publication_date", "date must be YYYY-MM-DD: '%s'", metadata.PublicationDate)
+		}
+	}
+	if metadata.AccessRight != "" && !slices.Contains(AccessRights, metadata.AccessRight) {
+		fail("metadata.access_right", "invalid access right: '%s'", metadata.AccessRight)
+	}
+	if (metadata.AccessRight == "open" || metadata.AccessRight == "embargoed") && metadata.License == "" {
+		fail("metadata.license", "a license is required for %s access", metadata.AccessRight)
+	}
+	for idx, keyword := range metadata.Keywords {
+		if keyword == "" {
+			fail(fmt.Sprintf("metadata.keywords[%d]", idx), "keywords must not be empty")
+		}
+	}
+	for idx, related := range metadata.RelatedIdentifiers {
+		field := fmt.Sprintf("metadata.related_identifiers[%d]", idx)
+		if related.Identifier == "" {
+			fail(field+".identifier", "identifier is required")
+		}
+		if !slices.Contains(Relations, related.Relation) {
+			fail(field+".relation", "invalid relation: '%s'", related.Relation)
+		}
+	}
+	return errors
+}
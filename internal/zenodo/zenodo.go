@@ -0,0 +1,319 @@
+/* zenodo provides a client for the Zenodo deposition API used to
+publish crates.
+
+A crate is published in the following steps:
+
+ 1. create a deposition.
+ 2. upload every crate part to the deposition's bucket.
+ 3. set the deposition metadata.
+ 4. optionally, publish the deposition.
+
+See: https://developers.zenodo.org/
+*/
+
+package zenodo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// ProductionURL is the base URL of Zenodo.
+	ProductionURL string = "https://zenodo.org"
+	// SandboxURL is the base URL of the Zenodo sandbox used for
+	// testing.
+	SandboxURL string = "https://sandbox.zenodo.org"
+	// TokenEnv is the environment variable a token is read from if
+	// a token file isn't provided.
+	TokenEnv string = "ZENODO_TOKEN"
+	// depositions is the path of the deposition API.
+	depositions string = "/api/deposit/depositions"
+)
+
+// Creator describes a creator of a deposition.
+type Creator struct {
+	Name        string `json:"name"`
+	Affiliation string `json:"affiliation,omitempty"`
+	ORCID       string `json:"orcid,omitempty"`
+}
+
+// RelatedIdentifier links a deposition to another resource.
+type RelatedIdentifier struct {
+	Identifier   string `json:"identifier"`
+	Relation     string `json:"relation"`
+	Scheme       string `json:"scheme,omitempty"`
+	ResourceType string `json:"resource_type,omitempty"`
+}
+
+// Metadata describes the deposition metadata.
+type Metadata struct {
+	UploadType         string              `json:"upload_type"`
+	PublicationType    string              `json:"publication_type,omitempty"`
+	ImageType          string              `json:"image_type,omitempty"`
+	Title              string              `json:"title"`
+	Description        string              `json:"description"`
+	Creators           []Creator           `json:"creators"`
+	PublicationDate    string              `json:"publication_date,omitempty"`
+	AccessRight        string              `json:"access_right,omitempty"`
+	License            string              `json:"license,omitempty"`
+	Keywords           []string            `json:"keywords,omitempty"`
+	RelatedIdentifiers []RelatedIdentifier `json:"related_identifiers,omitempty"`
+	Version            string              `json:"version,omitempty"`
+}
+
+// Links provides the API links of a deposition.
+type Links struct {
+	Self        string `json:"self,omitempty"`
+	HTML        string `json:"html,omitempty"`
+	Bucket      string `json:"bucket,omitempty"`
+	Publish     string `json:"publish,omitempty"`
+	NewVersion  string `json:"newversion,omitempty"`
+	LatestDraft string `json:"latest_draft,omitempty"`
+	Latest      string `json:"latest,omitempty"`
+}
+
+// File describes a file belonging to a deposition.
+type File struct {
+	ID       string `json:"id,omitempty"`
+	Key      string `json:"key,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// MD5 returns the file's md5 checksum without an algorithm prefix.
+func (file File) MD5() string {
+	return strings.TrimPrefix(file.Checksum, "md5:")
+}
+
+// Name returns the file's name whichever API returned it.
+func (file File) Name() string {
+	if file.Key != "" {
+		return file.Key
+	}
+	return file.Filename
+}
+
+// Deposition describes a Zenodo deposition.
+type Deposition struct {
+	ID           int      `json:"id"`
+	ConceptRecID string   `json:"conceptrecid,omitempty"`
+	DOI          string   `json:"doi,omitempty"`
+	ConceptDOI   string   `json:"conceptdoi,omitempty"`
+	State        string   `json:"state,omitempty"`
+	Submitted    bool     `json:"submitted"`
+	Links        Links    `json:"links"`
+	Metadata     Metadata `json:"metadata"`
+	Files        []File   `json:"files,omitempty"`
+}
+
+// FieldError describes a problem with a single metadata field.
+type FieldError struct {
+	Field    string   `json:"field"`
+	Messages []string `json:"messages,omitempty"`
+	Message  string   `json:"message,omitempty"`
+}
+
+// APIError is returned when Zenodo responds with an error status.
+type APIError struct {
+	Status  int          `json:"status"`
+	Message string       `json:"message"`
+	Errors  []FieldError `json:"errors,omitempty"`
+}
+
+func (err *APIError) Error() string {
+	if len(err.Errors) == 0 {
+		return fmt.Sprintf("zenodo error (%d): %s", err.Status, err.Message)
+	}
+	fields := []string{}
+	for _, field := range err.Errors {
+		message := field.Message
+		if message == "" {
+			message = strings.Join(field.Messages, ", ")
+		}
+		fields = append(fields, fmt.Sprintf("%s: %s", field.Field, message))
+	}
+	return fmt.Sprintf("zenodo error (%d): %s (%s)", err.Status, err.Message, strings.Join(fields, "; "))
+}
+
+// Client talks to the Zenodo deposition API.
+type Client struct {
+	BaseURL   string
+	Token     string
+	UserAgent string
+	HTTP      *http.Client
+}
+
+// NewClient returns a client for the Zenodo instance at baseURL.
+func NewClient(baseURL string, token string) *Client {
+	return &Client{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		Token:   token,
+		HTTP:    &http.Client{Timeout: 10 * time.Minute},
+	}
+}
+
+// LoadToken returns an access token from the given file, or from the
+// TokenEnv environment variable if no file is given.
+func LoadToken(tokenFile string) (string, error) {
+	if tokenFile != "" {
+		data, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return "", fmt.Errorf("error reading token file: %w", err)
+		}
+		token := strings.TrimSpace(string(data))
+		if token == "" {
+			return "", fmt.Errorf("token file is empty: %s", tokenFile)
+		}
+		return token, nil
+	}
+	token := strings.TrimSpace(os.Getenv(TokenEnv))
+	if token == "" {
+		return "", fmt.Errorf("no token provided, set %s or provide a token file", TokenEnv)
+	}
+	return token, nil
+}
+
+// endpoint returns a URL for the given API path.
+func (client *Client) endpoint(path string, args ...any) string {
+	return client.BaseURL + fmt.Sprintf(path, args...)
+}
+
+// do sends a request to Zenodo decoding the response into out if it
+// isn't nil.
+func (client *Client) do(method string, target string, contentType string, body io.Reader, out any) error {
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w (%s)", err, target)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", client.Token))
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if client.UserAgent != "" {
+		req.Header.Set("User-Agent", client.UserAgent)
+	}
+	resp, err := client.HTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("error connecting to zenodo: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading zenodo response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &APIError{}
+		if json.Unmarshal(data, apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(data))
+		}
+		apiErr.Status = resp.StatusCode
+		return apiErr
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("error parsing zenodo response: %w", err)
+	}
+	return nil
+}
+
+// doJSON sends a JSON body to Zenodo.
+func (client *Client) doJSON(method string, target string, in any, out any) error {
+	body := []byte("{}")
+	if in != nil {
+		var err error
+		body, err = json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("error creating request body: %w", err)
+		}
+	}
+	return client.do(method, target, "application/json", bytes.NewReader(body), out)
+}
+
+// CreateDeposition creates a new, empty, deposition.
+func (client *Client) CreateDeposition() (Deposition, error) {
+	var dep Deposition
+	err := client.doJSON(http.MethodPost, client.endpoint(depositions), nil, &dep)
+	return dep, err
+}
+
+// GetDeposition retrieves a deposition.
+func (client *Client) GetDeposition(id int) (Deposition, error) {
+	var dep Deposition
+	err := client.do(http.MethodGet, client.endpoint("%s/%d", depositions, id), "", nil, &dep)
+	return dep, err
+}
+
+// UpdateMetadata sets the metadata of a deposition.
+func (client *Client) UpdateMetadata(id int, metadata Metadata) (Deposition, error) {
+	var dep Deposition
+	body := struct {
+		Metadata Metadata `json:"metadata"`
+	}{metadata}
+	err := client.doJSON(http.MethodPut, client.endpoint("%s/%d", depositions, id), body, &dep)
+	return dep, err
+}
+
+// Upload streams data to a deposition's bucket using the given file
+// name.
+func (client *Client) Upload(bucket string, name string, data io.Reader) (File, error) {
+	var file File
+	if bucket == "" {
+		return file, errors.New("deposition has no bucket to upload to")
+	}
+	target := fmt.Sprintf("%s/%s", strings.TrimSuffix(bucket, "/"), url.PathEscape(name))
+	err := client.do(http.MethodPut, target, "application/octet-stream", data, &file)
+	return file, err
+}
+
+// UploadFile uploads a file from disk to a deposition's bucket.
+func (client *Client) UploadFile(bucket string, name string, path string) (File, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return File{}, fmt.Errorf("error opening file for upload: %w (%s)", err, path)
+	}
+	defer in.Close()
+	return client.Upload(bucket, name, in)
+}
+
+// Publish publishes a deposition. Published depositions cannot be
+// deleted.
+func (client *Client) Publish(id int) (Deposition, error) {
+	var dep Deposition
+	err := client.doJSON(http.MethodPost, client.endpoint("%s/%d/actions/publish", depositions, id), nil, &dep)
+	return dep, err
+}
+
+// NewVersion creates a new version of a published deposition and
+// returns the new draft. The draft starts with the files of the
+// published version.
+func (client *Client) NewVersion(id int) (Deposition, error) {
+	var dep Deposition
+	err := client.doJSON(http.MethodPost, client.endpoint("%s/%d/actions/newversion", depositions, id), nil, &dep)
+	if err != nil {
+		return dep, err
+	}
+	if dep.Links.LatestDraft == "" {
+		return dep, errors.New("zenodo did not return a draft for the new version")
+	}
+	var draft Deposition
+	err = client.do(http.MethodGet, dep.Links.LatestDraft, "", nil, &draft)
+	return draft, err
+}
+
+// DeleteFile removes a file from an unpublished deposition.
+func (client *Client) DeleteFile(id int, fileID string) error {
+	return client.do(http.MethodDelete, client.endpoint("%s/%d/files/%s", depositions, id, url.PathEscape(fileID)), "", nil, nil)
+}
@@ -0,0 +1,116 @@
+package zenodo_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ross-spencer/zenodocfl/internal/zenodo"
+	"github.com/ross-spencer/zenodocfl/internal/zenodo/zenodotest"
+)
+
+var testMetadata = zenodo.Metadata{
+	UploadType:  "dataset",
+	Title:       "Motet Cycles",
+	Description: "The Motet Cycles project.",
+	Creators:    []zenodo.Creator{{Name: "FHNW University of Applied Sciences and Arts"}},
+}
+
+// TestDeposit ensures a deposition can be created, uploaded to,
+// described and published.
+func TestDeposit(t *testing.T) {
+	server := zenodotest.NewServer("secret")
+	defer server.Close()
+	client := zenodo.NewClient(server.URL, "secret")
+	dep, err := client.CreateDeposition()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := client.Upload(dep.Links.Bucket, "ro-crate-metadata.json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Size != 2 || !strings.HasPrefix(file.Checksum, "md5:") {
+		t.Errorf("unexpected file response: %+v", file)
+	}
+	if _, err := client.UpdateMetadata(dep.ID, testMetadata); err != nil {
+		t.Fatal(err)
+	}
+	published, err := client.Publish(dep.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !published.Submitted || published.DOI == "" || published.ConceptDOI == "" {
+		t.Errorf("deposition not published: %+v", published)
+	}
+	if _, err := client.Upload(dep.Links.Bucket, "late.json", strings.NewReader("{}")); err == nil {
+		t.Errorf("published deposition should not accept uploads")
+	}
+}
+
+// TestAPIError ensures errors from Zenodo name the offending fields.
+func TestAPIError(t *testing.T) {
+	server := zenodotest.NewServer("secret")
+	defer server.Close()
+	client := zenodo.NewClient(server.URL, "secret")
+	dep, _ := client.CreateDeposition()
+	_, err := client.Publish(dep.ID)
+	var apiErr *zenodo.APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected an API error: %v", err)
+	}
+	if apiErr.Status != 400 || !strings.Contains(err.Error(), "metadata.title") {
+		t.Errorf("error should name the missing field: %s", err)
+	}
+	unauthorized := zenodo.NewClient(server.URL, "wrong")
+	if _, err := unauthorized.CreateDeposition(); !errors.As(err, &apiErr) || apiErr.Status != 401 {
+		t.Errorf("expected unauthorized error: %v", err)
+	}
+}
+
+// TestLoadToken ensures tokens are read from a file before the
+// environment.
+func TestLoadToken(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(tokenFile, []byte("from-file\n"), 0600)
+	t.Setenv(zenodo.TokenEnv, "from-env")
+	token, err := zenodo.LoadToken(tokenFile)
+	if err != nil || token != "from-file" {
+		t.Errorf("token not read from file: '%s' (%v)", token, err)
+	}
+	token, err = zenodo.LoadToken("")
+	if err != nil || token != "from-env" {
+		t.Errorf("token not read from environment: '%s' (%v)", token, err)
+	}
+	t.Setenv(zenodo.TokenEnv, "")
+	if _, err := zenodo.LoadToken(""); err == nil {
+		t.Errorf("missing token should return an error")
+	}
+}
+
+// TestValidate ensures metadata problems name the offending field.
+func TestValidate(t *testing.T) {
+	if errs := testMetadata.Validate(); len(errs) != 0 {
+		t.Errorf("metadata should be valid: %v", errs)
+	}
+	metadata := testMetadata
+	metadata.UploadType = "publication"
+	metadata.AccessRight = "open"
+	metadata.PublicationDate = "13/02/2026"
+	metadata.RelatedIdentifiers = []zenodo.RelatedIdentifier{{Identifier: "ark:/15737/p657", Relation: "contains"}}
+	fields := []string{}
+	for _, err := range metadata.Validate() {
+		fields = append(fields, err.Field)
+	}
+	expected := []string{
+		"metadata.publication_type",
+		"metadata.publication_date",
+		"metadata.license",
+		"metadata.related_identifiers[0].relation",
+	}
+	if strings.Join(fields, ",") != strings.Join(expected, ",") {
+		t.Errorf("unexpected validation fields: %v expected: %v", fields, expected)
+	}
+}
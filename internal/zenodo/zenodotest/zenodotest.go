@@ -0,0 +1,287 @@
+/* zenodotest provides an in-memory stand-in for the Zenodo deposition
+API so that clients can be tested without network access. */
+
+package zenodotest
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ross-spencer/zenodocfl/internal/zenodo"
+)
+
+// Server is an in-memory Zenodo deposition API.
+type Server struct {
+	*httptest.Server
+	// Token expected in the Authorization header of every request.
+	Token string
+	// Depositions created on the server keyed by ID.
+	Depositions map[int]*zenodo.Deposition
+	// Uploads records the content of every file keyed by bucket and
+	// then file name.
+	Uploads map[string]map[string][]byte
+	mu      sync.Mutex
+	nextID  int
+	buckets map[string]int
+}
+
+// NewServer starts a new stand-in server expecting the given token.
+func NewServer(token string) *Server {
+	server := &Server{
+		Token:       token,
+		Depositions: map[int]*zenodo.Deposition{},
+		Uploads:     map[string]map[string][]byte{},
+		nextID:      1000,
+		buckets:     map[string]int{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/deposit/depositions", server.create)
+	mux.HandleFunc("GET /api/deposit/depositions/{id}", server.get)
+	mux.HandleFunc("PUT /api/deposit/depositions/{id}", server.update)
+	mux.HandleFunc("POST /api/deposit/depositions/{id}/actions/publish", server.publish)
+	mux.HandleFunc("POST /api/deposit/depositions/{id}/actions/newversion", server.newVersion)
+	mux.HandleFunc("DELETE /api/deposit/depositions/{id}/files/{file}", server.deleteFile)
+	mux.HandleFunc("PUT /api/files/{bucket}/{key}", server.upload)
+	server.Server = httptest.NewServer(server.authorize(mux))
+	return server
+}
+
+// fail writes a Zenodo style error response.
+func fail(w http.ResponseWriter, status int, message string, errors ...zenodo.FieldError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(zenodo.APIError{Status: status, Message: message, Errors: errors})
+}
+
+// reply writes a JSON response.
+func reply(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// authorize checks the bearer token of every request.
+func (server *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != fmt.Sprintf("Bearer %s", server.Token) {
+			fail(w, http.StatusUnauthorized, "The server could not verify that you are authorized to access the URL requested.")
+			return
+		}
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// deposition returns the deposition named in the request path.
+func (server *Server) deposition(w http.ResponseWriter, r *http.Request) (*zenodo.Deposition, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		fail(w, http.StatusNotFound, "PID does not exist.")
+		return nil, false
+	}
+	dep, ok := server.Depositions[id]
+	if !ok {
+		fail(w, http.StatusNotFound, "PID does not exist.")
+		return nil, false
+	}
+	return dep, true
+}
+
+// newDeposition creates a deposition belonging to the given concept
+// record. A new concept record is created if none is given.
+func (server *Server) newDeposition(conceptID string) *zenodo.Deposition {
+	server.nextID++
+	id := server.nextID
+	if conceptID == "" {
+		conceptID = strconv.Itoa(id)
+		server.nextID++
+		id = server.nextID
+	}
+	bucket := fmt.Sprintf("bucket-%d", id)
+	server.buckets[bucket] = id
+	server.Uploads[bucket] = map[string][]byte{}
+	dep := &zenodo.Deposition{
+		ID:           id,
+		ConceptRecID: conceptID,
+		State:        "unsubmitted",
+		Links: zenodo.Links{
+			Self:    fmt.Sprintf("%s/api/deposit/depositions/%d", server.URL, id),
+			HTML:    fmt.Sprintf("%s/deposit/%d", server.URL, id),
+			Bucket:  fmt.Sprintf("%s/api/files/%s", server.URL, bucket),
+			Publish: fmt.Sprintf("%s/api/deposit/depositions/%d/actions/publish", server.URL, id),
+		},
+		Files: []zenodo.File{},
+	}
+	server.Depositions[id] = dep
+	return dep
+}
+
+func (server *Server) create(w http.ResponseWriter, r *http.Request) {
+	reply(w, http.StatusCreated, server.newDeposition(""))
+}
+
+func (server *Server) get(w http.ResponseWriter, r *http.Request) {
+	dep, ok := server.deposition(w, r)
+	if !ok {
+		return
+	}
+	reply(w, http.StatusOK, dep)
+}
+
+func (server *Server) update(w http.ResponseWriter, r *http.Request) {
+	dep, ok := server.deposition(w, r)
+	if !ok {
+		return
+	}
+	if dep.Submitted {
+		fail(w, http.StatusBadRequest, "Deposition is published and cannot be edited.")
+		return
+	}
+	var body struct {
+		Metadata zenodo.Metadata `json:"metadata"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		fail(w, http.StatusBadRequest, "Validation error.", zenodo.FieldError{Field: "metadata", Message: err.Error()})
+		return
+	}
+	dep.Metadata = body.Metadata
+	reply(w, http.StatusOK, dep)
+}
+
+// validate returns the errors Zenodo reports for incomplete metadata.
+func validate(metadata zenodo.Metadata) []zenodo.FieldError {
+	errors := []zenodo.FieldError{}
+	required := map[string]bool{
+		"metadata.upload_type": metadata.UploadType != "",
+		"metadata.title":       metadata.Title != "",
+		"metadata.description": metadata.Description != "",
+		"metadata.creators":    len(metadata.Creators) > 0,
+	}
+	for _, field := range []string{"metadata.upload_type", "metadata.title", "metadata.description", "metadata.creators"} {
+		if !required[field] {
+			errors = append(errors, zenodo.FieldError{Field: field, Message: "Missing data for required field."})
+		}
+	}
+	return errors
+}
+
+func (server *Server) publish(w http.ResponseWriter, r *http.Request) {
+	dep, ok := server.deposition(w, r)
+	if !ok {
+		return
+	}
+	if dep.Submitted {
+		fail(w, http.StatusBadRequest, "Deposition is already published.")
+		return
+	}
+	if errors := validate(dep.Metadata); len(errors) > 0 {
+		fail(w, http.StatusBadRequest, "Validation error.", errors...)
+		return
+	}
+	if len(dep.Files) == 0 {
+		fail(w, http.StatusBadRequest, "Validation error.", zenodo.FieldError{Field: "files", Message: "Minimum one file must be provided."})
+		return
+	}
+	dep.Submitted = true
+	dep.State = "done"
+	dep.DOI = fmt.Sprintf("10.5072/zenodo.%d", dep.ID)
+	dep.ConceptDOI = fmt.Sprintf("10.5072/zenodo.%s", dep.ConceptRecID)
+	dep.Links.Latest = fmt.Sprintf("%s/api/records/%d", server.URL, dep.ID)
+	reply(w, http.StatusAccepted, dep)
+}
+
+func (server *Server) upload(w http.ResponseWriter, r *http.Request) {
+	bucket := r.PathValue("bucket")
+	id, ok := server.buckets[bucket]
+	if !ok {
+		fail(w, http.StatusNotFound, "Bucket does not exist.")
+		return
+	}
+	dep := server.Depositions[id]
+	if dep.Submitted {
+		fail(w, http.StatusForbidden, "Bucket is locked.")
+		return
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		fail(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	key := r.PathValue("key")
+	sum := md5.Sum(data)
+	file := zenodo.File{
+		ID:       fmt.Sprintf("%s-%s", bucket, key),
+		Key:      key,
+		Size:     int64(len(data)),
+		Checksum: fmt.Sprintf("md5:%s", hex.EncodeToString(sum[:])),
+	}
+	server.Uploads[bucket][key] = data
+	files := []zenodo.File{}
+	for _, existing := range dep.Files {
+		if existing.Name() != key {
+			files = append(files, existing)
+		}
+	}
+	dep.Files = append(files, file)
+	reply(w, http.StatusCreated, file)
+}
+
+func (server *Server) newVersion(w http.ResponseWriter, r *http.Request) {
+	dep, ok := server.deposition(w, r)
+	if !ok {
+		return
+	}
+	if !dep.Submitted {
+		fail(w, http.StatusBadRequest, "Only published depositions can have new versions.")
+		return
+	}
+	draft := server.newDeposition(dep.ConceptRecID)
+	draft.Metadata = dep.Metadata
+	newBucket := strings.TrimPrefix(draft.Links.Bucket, fmt.Sprintf("%s/api/files/", server.URL))
+	oldBucket := strings.TrimPrefix(dep.Links.Bucket, fmt.Sprintf("%s/api/files/", server.URL))
+	for _, file := range dep.Files {
+		server.Uploads[newBucket][file.Name()] = server.Uploads[oldBucket][file.Name()]
+		file.ID = fmt.Sprintf("%s-%s", newBucket, file.Name())
+		draft.Files = append(draft.Files, file)
+	}
+	dep.Links.LatestDraft = draft.Links.Self
+	reply(w, http.StatusCreated, dep)
+}
+
+func (server *Server) deleteFile(w http.ResponseWriter, r *http.Request) {
+	dep, ok := server.deposition(w, r)
+	if !ok {
+		return
+	}
+	if dep.Submitted {
+		fail(w, http.StatusForbidden, "Deposition is published and cannot be edited.")
+		return
+	}
+	fileID := r.PathValue("file")
+	bucket := strings.TrimPrefix(dep.Links.Bucket, fmt.Sprintf("%s/api/files/", server.URL))
+	files := []zenodo.File{}
+	found := false
+	for _, file := range dep.Files {
+		if file.ID == fileID {
+			delete(server.Uploads[bucket], file.Name())
+			found = true
+			continue
+		}
+		files = append(files, file)
+	}
+	if !found {
+		fail(w, http.StatusNotFound, "File does not exist.")
+		return
+	}
+	dep.Files = files
+	w.WriteHeader(http.StatusNoContent)
+}
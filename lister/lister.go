@@ -22,6 +22,7 @@ import (
 	"os"
 
 	"github.com/ross-spencer/zenodocfl/internal/logformatter"
+	"github.com/ross-spencer/zenodocfl/internal/provenance"
 	"github.com/ross-spencer/zenodocfl/internal/types"
 	"golang.org/x/net/html"
 
@@ -155,6 +156,20 @@ func outputResults(urlList []types.MediathekRecord, output string, allowlist boo
 	}
 }
 
+// writeProvenance records the lister run alongside the manifest so
+// that it can be described in the RO-CRATE.
+func writeProvenance(run provenance.Run, inkURL string, output string, allowlist bool) {
+	run.Url = inkURL
+	run.AddOutputs(fmt.Sprintf("%s.manifest", output))
+	if allowlist {
+		run.AddOutputs(fmt.Sprintf("%s.allowlist", output))
+	}
+	run.Finish()
+	if err := provenance.Write(output+provenance.Ext, []provenance.Run{run}); err != nil {
+		log.Println("problem writing provenance:", err)
+	}
+}
+
 func main() {
 
 	logformatter.Set("lister", true)
@@ -176,6 +191,7 @@ func main() {
 		fmt.Fprintln(os.Stderr, "")
 		fmt.Fprintln(os.Stderr, "Output: [FILE] {manifest JSON}")
 		fmt.Fprintln(os.Stderr, "Output: [FILE] {allowlist JSON}")
+		fmt.Fprintln(os.Stderr, "Output: [FILE] {provenance JSON}")
 		fmt.Fprintln(os.Stderr, "Output: [STRING] {result JSON}")
 		fmt.Fprintln(os.Stderr, "Output: [STRING] {result allowlist}")
 		fmt.Fprintf(os.Stderr, "Output: [STRING] {version: '%s'}\n\n", agent)
@@ -183,6 +199,8 @@ func main() {
 		os.Exit(0)
 	}
 
+	run := provenance.Start("INK-lister", version, commit)
+
 	var inkURL string
 	if collection == 0 {
 		inkURL = makeINKSearchURL(lang, search, results)
@@ -206,4 +224,7 @@ func main() {
 
 	outputResults(urlList, output, allowlist)
 
+	if output != "" {
+		writeProvenance(run, inkURL, output, allowlist)
+	}
 }
@@ -0,0 +1,171 @@
+/*
+ocfler provides tools for working with the OCFL storage roots and
+objects written by `crater`.
+
+Subcommands:
+
+ 1. validate: validate a storage root or object reporting OCFL error
+    and warning codes (E0xx/W0xx).
+ 2. list: list the objects in a storage root with their head versions.
+*/
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/ross-spencer/zenodocfl/internal/logformatter"
+	"github.com/ross-spencer/zenodocfl/internal/ocfl"
+)
+
+var (
+	// app constants.
+	version = "dev-0.0.0"
+	commit  = "000000000000000000000000000000000baddeed"
+	date    = "1970-01-01T00:00:01Z"
+)
+
+var agent string = fmt.Sprintf("INK-ocfler/%s", version)
+
+// usage outputs the top-level usage for this app.
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage:  ")
+	fmt.Fprintln(os.Stderr, "        ocfler validate [-json] [-warnings] PATH")
+	fmt.Fprintln(os.Stderr, "        ocfler list [-json] [-id STRING] ROOT")
+	fmt.Fprintln(os.Stderr, "        ocfler -version")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Output: [STRING] {validation report}")
+	fmt.Fprintln(os.Stderr, "Output: [STRING] {object listing}")
+	fmt.Fprintf(os.Stderr, "Output: [STRING] {version: '%s'}\n\n", agent)
+}
+
+// validateCmd validates a storage root or object and exits non-zero
+// if any errors are found.
+func validateCmd(args []string) {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "output results as JSON")
+	warnings := flags.Bool("warnings", true, "report warnings")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		usage()
+		flags.Usage()
+		os.Exit(2)
+	}
+	results := ocfl.Validate(flags.Arg(0))
+	valid := true
+	for idx, result := range results {
+		if !result.Valid() {
+			valid = false
+		}
+		if !*warnings {
+			results[idx].Warnings = []ocfl.Issue{}
+		}
+	}
+	if *asJSON {
+		jsonOut, err := json.MarshalIndent(results, "", " ")
+		if err != nil {
+			log.Println("cannot output results as JSON:", err)
+			os.Exit(2)
+		}
+		fmt.Println(string(jsonOut))
+	} else {
+		printResults(results)
+	}
+	if !valid {
+		os.Exit(1)
+	}
+}
+
+// listCmd lists the objects in a storage root, or resolves a single
+// object from its identifier using the storage root's layout.
+func listCmd(args []string) {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "output results as JSON")
+	id := flags.String("id", "", "resolve a single object by its identifier or crate identifier")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		usage()
+		flags.Usage()
+		os.Exit(2)
+	}
+	root, err := ocfl.OpenStorageRoot(flags.Arg(0))
+	if err != nil {
+		log.Println("cannot open storage root:", err)
+		os.Exit(1)
+	}
+	var objects []ocfl.ObjectInfo
+	if *id != "" {
+		objectPath, err := root.ResolveObject(*id)
+		if err != nil {
+			log.Println("cannot resolve object:", err)
+			os.Exit(1)
+		}
+		inv, err := ocfl.ReadInventory(objectPath)
+		if err != nil {
+			log.Println("cannot read object:", err)
+			os.Exit(1)
+		}
+		objects = append(objects, ocfl.ObjectInfo{ID: inv.ID, Head: inv.Head, Path: objectPath})
+	} else {
+		objects, err = root.Objects()
+		if err != nil {
+			log.Println("cannot list objects:", err)
+			os.Exit(1)
+		}
+	}
+	if *asJSON {
+		jsonOut, err := json.MarshalIndent(objects, "", " ")
+		if err != nil {
+			log.Println("cannot output objects as JSON:", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonOut))
+		return
+	}
+	log.Printf("storage layout: %s", root.Layout.Name())
+	for _, object := range objects {
+		fmt.Printf("%s\t%s\t%s\n", object.ID, object.Head, object.Path)
+	}
+}
+
+// printResults outputs human readable validation results.
+func printResults(results []ocfl.Result) {
+	for _, result := range results {
+		status := "valid"
+		if !result.Valid() {
+			status = "invalid"
+		}
+		fmt.Printf("%s: %s\n", result.Path, status)
+		for _, issue := range result.Errors {
+			fmt.Printf("  ERROR   %s\n", issue)
+		}
+		for _, issue := range result.Warnings {
+			fmt.Printf("  WARNING %s\n", issue)
+		}
+	}
+}
+
+func main() {
+
+	logformatter.Set("ocfler", true)
+
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(0)
+	}
+
+	switch os.Args[1] {
+	case "validate":
+		validateCmd(os.Args[2:])
+	case "list":
+		listCmd(os.Args[2:])
+	case "-version", "--version":
+		fmt.Fprintf(os.Stderr, "%s (%s) commit: %s date: %s\n", agent, version, commit, date)
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,201 @@
+/*
+validater validates the RO-Crates written by `crater` before they are
+sent to Zenodo.
+
+Subcommands:
+
+ 1. validate: validate a crate against RO-Crate 1.1 at the REQUIRED,
+    RECOMMENDED or OPTIONAL level.
+ 2. inspect: summarise a crate, its root metadata, entities and files.
+
+Exit codes:
+
+	0: the crate is valid.
+	1: issues were found at the level validated.
+	2: usage error.
+*/
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ross-spencer/zenodocfl/internal/logformatter"
+	"github.com/ross-spencer/zenodocfl/internal/rocrate"
+)
+
+var (
+	// app constants.
+	version = "dev-0.0.0"
+	commit  = "000000000000000000000000000000000baddeed"
+	date    = "1970-01-01T00:00:01Z"
+)
+
+var agent string = fmt.Sprintf("INK-validater/%s", version)
+
+// usage outputs the top-level usage for this app.
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage:  ")
+	fmt.Fprintln(os.Stderr, "        validater validate [-json] [-level STRING] PATH")
+	fmt.Fprintln(os.Stderr, "        validater inspect [-json] PATH")
+	fmt.Fprintln(os.Stderr, "        validater -version")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Output: [STRING] {validation report}")
+	fmt.Fprintln(os.Stderr, "Output: [STRING] {crate summary}")
+	fmt.Fprintf(os.Stderr, "Output: [STRING] {version: '%s'}\n\n", agent)
+}
+
+// validateCmd validates a crate and exits non-zero if any issues are
+// found at the level requested.
+func validateCmd(args []string) {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "output results as JSON")
+	levelName := flags.String("level", string(rocrate.Required), "severity to validate to: REQUIRED, RECOMMENDED or OPTIONAL")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		usage()
+		flags.Usage()
+		os.Exit(2)
+	}
+	level, err := rocrate.ParseSeverity(*levelName)
+	if err != nil {
+		log.Println(err)
+		os.Exit(2)
+	}
+	report := rocrate.Validate(flags.Arg(0), level)
+	if *asJSON {
+		jsonOut, err := json.MarshalIndent(report, "", " ")
+		if err != nil {
+			log.Println("cannot output results as JSON:", err)
+			os.Exit(2)
+		}
+		fmt.Println(string(jsonOut))
+	} else {
+		printReport(report)
+	}
+	if !report.Valid() {
+		os.Exit(1)
+	}
+}
+
+// printReport outputs a human readable validation report.
+func printReport(report rocrate.Report) {
+	status := "valid"
+	if !report.Valid() {
+		status = "invalid"
+	}
+	crateVersion := report.Version
+	if crateVersion == "" {
+		crateVersion = "unknown"
+	}
+	fmt.Printf("%s: %s (RO-Crate %s, level: %s)\n", report.Path, status, crateVersion, report.Level)
+	for _, issue := range report.Issues {
+		fmt.Printf("  %s\n", issue)
+	}
+}
+
+// inspectCmd summarises a crate.
+func inspectCmd(args []string) {
+	flags := flag.NewFlagSet("inspect", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "output the summary as JSON")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		usage()
+		flags.Usage()
+		os.Exit(2)
+	}
+	summary, err := rocrate.Inspect(flags.Arg(0))
+	if err != nil {
+		log.Println("cannot inspect crate:", err)
+		os.Exit(1)
+	}
+	if *asJSON {
+		jsonOut, err := json.MarshalIndent(summary, "", " ")
+		if err != nil {
+			log.Println("cannot output summary as JSON:", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonOut))
+		return
+	}
+	printSummary(summary)
+}
+
+// entryString returns a contextual entity as name (id).
+func entryString(entry rocrate.Entry) string {
+	if entry.Name == "" {
+		return entry.ID
+	}
+	return fmt.Sprintf("%s (%s)", entry.Name, entry.ID)
+}
+
+// printSummary outputs a human readable summary of a crate.
+func printSummary(summary rocrate.Summary) {
+	out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer out.Flush()
+	fmt.Fprintf(out, "crate:\t%s (RO-Crate %s)\n", summary.Path, summary.Version)
+	fmt.Fprintf(out, "name:\t%s\n", summary.Name)
+	fmt.Fprintf(out, "description:\t%s\n", summary.Description)
+	fmt.Fprintf(out, "identifier:\t%s\n", strings.Join(summary.Identifier, ", "))
+	fmt.Fprintf(out, "published:\t%s\n", summary.DatePublished)
+	fmt.Fprintf(out, "keywords:\t%s\n", summary.Keywords)
+	for _, license := range summary.Licenses {
+		fmt.Fprintf(out, "license:\t%s\n", entryString(license))
+	}
+	for _, publisher := range summary.Publishers {
+		fmt.Fprintf(out, "publisher:\t%s\n", entryString(publisher))
+	}
+	fmt.Fprintf(out, "\nidentifiers:\t%d\n", len(summary.Identifiers))
+	for _, id := range summary.Identifiers {
+		fmt.Fprintf(out, "  %s\t%s\t%s\n", id.PropertyID, id.Value, id.URL)
+	}
+	fmt.Fprintf(out, "\nentities:\n")
+	types := []string{}
+	for entityType := range summary.Types {
+		types = append(types, entityType)
+	}
+	slices.Sort(types)
+	for _, entityType := range types {
+		fmt.Fprintf(out, "  %s\t%d\n", entityType, summary.Types[entityType])
+	}
+	fmt.Fprintf(out, "\nfiles:\t%d (%s)\n", summary.Files, rocrate.FormatSize(summary.Size))
+	for _, dir := range summary.Directories {
+		fmt.Fprintf(out, "  %s\t%d\t%s\n", dir.Path, dir.Files, rocrate.FormatSize(dir.Size))
+	}
+	fmt.Fprintf(out, "\nmissing:\t%d\n", len(summary.Missing))
+	for _, file := range summary.Missing {
+		fmt.Fprintf(out, "  %s\n", file)
+	}
+	fmt.Fprintf(out, "unlisted:\t%d\n", len(summary.Unlisted))
+	for _, file := range summary.Unlisted {
+		fmt.Fprintf(out, "  %s\n", file)
+	}
+}
+
+func main() {
+
+	logformatter.Set("validater", true)
+
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(0)
+	}
+
+	switch os.Args[1] {
+	case "validate":
+		validateCmd(os.Args[2:])
+	case "inspect":
+		inspectCmd(os.Args[2:])
+	case "-version", "--version":
+		fmt.Fprintf(os.Stderr, "%s (%s) commit: %s date: %s\n", agent, version, commit, date)
+	default:
+		usage()
+		os.Exit(2)
+	}
+}